@@ -1,19 +1,28 @@
 package apigateway
 
 import (
+	"context"
+	"math/big"
 	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	cmn "github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/apigateway/core/accounts"
+	"github.com/DSiSc/apigateway/core/bloombits"
 	"github.com/DSiSc/apigateway/log"
 	//	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
 	"github.com/go-kit/kit/log/term"
 	amino "github.com/tendermint/go-amino"
 
 	rpccore "github.com/DSiSc/apigateway/rpc/core"
+	rpcauth "github.com/DSiSc/apigateway/rpc/lib/auth"
+	rpclimit "github.com/DSiSc/apigateway/rpc/lib/limit"
+	rpcmetrics "github.com/DSiSc/apigateway/rpc/lib/metrics"
 	rpcserver "github.com/DSiSc/apigateway/rpc/lib/server"
+	"github.com/DSiSc/apigateway/version"
 	craftlog "github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/types"
 )
@@ -33,49 +42,400 @@ var colorFn = func(keyvals ...interface{}) term.FgBgColor {
 
 var logger = log.NewTMLoggerWithColorFn(log.NewSyncWriter(os.Stdout), colorFn)
 
-func StartRPC(listenAddr string, eventCenter types.EventCenter) ([]net.Listener, error) {
+// rpcConfig holds the optional settings of StartRPC.
+type rpcConfig struct {
+	auth      *rpcauth.Authenticator
+	limiter   *rpclimit.Limiter
+	exposed   map[string]methodFilter // by listen address
+	cors      *rpcserver.CORSConfig
+	metrics   []string // listen addresses serving /metrics, all if empty
+	metricsOn bool
+	logIndex  string   // directory of the log index, none if empty
+	gasCap    uint64   // rpccore.RPCGasCap if 0
+	minPrice  *big.Int // rpccore.MinGasPrice if nil
+	maxTxSize uint64   // rpccore.MaxTxSize if 0
+	replay    bool     // sets rpccore.ReceiptRevertReason
+	txQueue   int      // depth of the queue to the switch, the default if 0
+	txTimeout time.Duration
+	gasPrices []func(*rpccore.GasPriceOracle)
+	timeouts  map[string]time.Duration // deadlines by method, the route's if absent
+	signer    accounts.Signer          // signing is disabled if nil
+}
+
+// methodFilter holds the allow and deny patterns of rpcserver.FilterFuncMap.
+type methodFilter struct {
+	allow, deny []string
+}
+
+// MethodTimeout sets the deadline of each call of method, overriding its
+// default, like the 5s of eth_call and 20s of eth_estimateGas. A zero
+// timeout lets calls run without deadline.
+func MethodTimeout(method string, timeout time.Duration) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		if c.timeouts == nil {
+			c.timeouts = make(map[string]time.Duration)
+		}
+		c.timeouts[method] = timeout
+	}
+}
+
+// Authentication makes the RPC server authenticate its clients with auth and
+// reject the calls their policy doesn't allow, on HTTP and websocket alike.
+func Authentication(auth *rpcauth.Authenticator) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.auth = auth
+	}
+}
+
+// RateLimiting makes the RPC server limit the rate of calls of each client
+// with limiter. Clients are identified by their credentials if
+// Authentication is on too.
+func RateLimiting(limiter *rpclimit.Limiter) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.limiter = limiter
+	}
+}
+
+// CORS sets the origins browsers may call the RPC server from, over HTTP
+// and websocket. Without it, no cross-origin calls are allowed.
+func CORS(cors *rpcserver.CORSConfig) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.cors = cors
+	}
+}
+
+// ServeMetrics serves the metrics of the gateway at /metrics on the given
+// listen addresses, or on all of them if none are given.
+func ServeMetrics(listenAddrs ...string) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.metricsOn = true
+		c.metrics = append(c.metrics, listenAddrs...)
+	}
+}
+
+// servesMetrics reports whether the listener on listenAddr serves /metrics.
+func (c *rpcConfig) servesMetrics(listenAddr string) bool {
+	if !c.metricsOn {
+		return false
+	}
+	if len(c.metrics) == 0 {
+		return true
+	}
+	for _, addr := range c.metrics {
+		if addr == listenAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexLogs makes the gateway index the log blooms of committed blocks in
+// dir, so eth_getLogs skips the blocks that can't match. The index catches
+// up with the chain on start and resumes where it stopped.
+func IndexLogs(dir string) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.logIndex = dir
+	}
+}
+
+// CapGas sets the most gas eth_call and eth_estimateGas execute a
+// transaction with.
+func CapGas(gas uint64) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.gasCap = gas
+	}
+}
+
+// MinGasPrice sets the lowest gas price of the raw transactions accepted.
+func MinGasPrice(price *big.Int) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.minPrice = price
+	}
+}
+
+// MaxTxSize sets the size in bytes of the largest raw transaction accepted.
+func MaxTxSize(size uint64) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.maxTxSize = size
+	}
+}
+
+// ReplayRevertReasons makes eth_getTransactionReceipt replay the failed
+// transactions to give the reason they reverted with.
+func ReplayRevertReasons() func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.replay = true
+	}
+}
+
+// QueueTxs sets the depth of the queue of the transactions submitted to the
+// gossip switch, and how long submissions wait for room in it before failing.
+func QueueTxs(depth int, timeout time.Duration) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.txQueue, c.txTimeout = depth, timeout
+	}
+}
+
+// GasPriceOracle sets the options of the oracle suggesting gas prices from
+// the recent blocks, run when StartRPC is given an event center.
+func GasPriceOracle(options ...func(*rpccore.GasPriceOracle)) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.gasPrices = append(c.gasPrices, options...)
+	}
+}
+
+// Sign makes eth_sendTransaction sign with the keys of signer. With a key
+// store, eth_sign, eth_signTypedData_v4 and the personal methods are served
+// too, which should only be exposed on private listeners. Without a signer,
+// signing is disabled.
+func Sign(signer accounts.Signer) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.signer = signer
+	}
+}
+
+// SignWithTestKey makes eth_sendTransaction sign with the test key of the
+// wallet. Anyone holds that key, so it is for devnets only.
+func SignWithTestKey() func(*rpcConfig) {
+	return Sign(rpccore.TestKeySigner())
+}
+
+// ExposeMethods limits the methods served on listenAddr to those matching a
+// pattern of allow and none of deny, like "eth_", "eth_get*" or "net_version".
+// Listeners without ExposeMethods serve every method.
+func ExposeMethods(listenAddr string, allow, deny []string) func(*rpcConfig) {
+	return func(c *rpcConfig) {
+		c.exposed[listenAddr] = methodFilter{allow, deny}
+	}
+}
+
+// apiRoutes returns the methods served with signer, adding
+// rpccore.AccountRoutes to rpccore.Routes for a key store.
+func apiRoutes(signer accounts.Signer) map[string]*rpcserver.RPCFunc {
+	if ks, ok := signer.(*accounts.KeyStore); !ok || ks == nil {
+		return rpccore.Routes
+	}
+	routes := make(map[string]*rpcserver.RPCFunc, len(rpccore.Routes)+len(rpccore.AccountRoutes))
+	for name, f := range rpccore.Routes {
+		routes[name] = f
+	}
+	for name, f := range rpccore.AccountRoutes {
+		routes[name] = f
+	}
+	return routes
+}
+
+// shutdownTimeout is how long StopRPC waits for pending calls.
+const shutdownTimeout = 10 * time.Second
+
+// rpcServer is a server started by StartRPC and its websocket connections.
+type rpcServer struct {
+	server *rpcserver.Server
+	wm     *rpcserver.WebsocketManager
+}
+
+// rpcServers holds the servers of the listeners returned by StartRPC.
+var (
+	rpcServersMtx sync.Mutex
+	rpcServers    = make(map[net.Listener]*rpcServer)
+)
+
+func StartRPC(listenAddr string, eventCenter types.EventCenter, options ...func(*rpcConfig)) ([]net.Listener, error) {
+	config := &rpcConfig{exposed: make(map[string]methodFilter)}
+	for _, option := range options {
+		option(config)
+	}
 
 	listenAddrs := cmn.SplitAndTrim(listenAddr, ",", " ")
 	coreCodec := amino.NewCodec()
 	// TODO(peerlink): let's see wire.go
 	//ctypes.RegisterAmino(coreCodec)
 
+	if config.gasCap != 0 {
+		rpccore.RPCGasCap = config.gasCap
+	}
+	if config.minPrice != nil {
+		rpccore.MinGasPrice = config.minPrice
+	}
+	if config.maxTxSize != 0 {
+		rpccore.MaxTxSize = config.maxTxSize
+	}
+	if config.replay {
+		rpccore.ReceiptRevertReason = true
+	}
+	if config.txQueue > 0 {
+		timeout := config.txTimeout
+		if timeout <= 0 {
+			timeout = rpccore.DefaultTxQueueTimeout
+		}
+		rpccore.SetTxQueue(config.txQueue, timeout)
+	}
+	rpccore.SetSigner(config.signer)
+	if eventCenter != nil {
+		filters := rpccore.NewFilterManager(eventCenter)
+		filters.Start()
+		rpccore.SetFilterManager(filters)
+		oracle := rpccore.NewGasPriceOracle(eventCenter, config.gasPrices...)
+		oracle.Start()
+		rpccore.SetGasPriceOracle(oracle)
+		nonces := rpccore.NewNonceManager(eventCenter)
+		nonces.Start()
+		rpccore.SetNonceManager(nonces)
+	}
+	if config.logIndex != "" {
+		store, err := bloombits.OpenStore(config.logIndex, bloombits.DefaultSectionSize)
+		if err != nil {
+			stopIdleServices()
+			return nil, err
+		}
+		indexer := bloombits.NewIndexer(rpccore.NewBloomChain(), store, bloombits.FollowEvents(eventCenter))
+		if err := indexer.Start(); err != nil {
+			stopIdleServices()
+			return nil, err
+		}
+		rpccore.SetBloomIndexer(indexer)
+	}
+
 	// we may expose the rpc over both a unix and tcp socket
+	served := apiRoutes(config.signer)
 	listeners := make([]net.Listener, len(listenAddrs))
 	for i, listenAddr := range listenAddrs {
 		mux := http.NewServeMux()
 		rpcLogger := logger.With("module", "rpc-server")
-		wm := rpcserver.NewWebsocketManager(rpccore.Routes, coreCodec, rpcserver.ReadWait(5*time.Second), rpcserver.EventSubscriber(eventCenter))
+		// FilterFuncMap copies the routes even when nothing is filtered out,
+		// so rpc.discover isn't added to rpccore.Routes.
+		filter := config.exposed[listenAddr]
+		routes := rpcserver.FilterFuncMap(served, filter.allow, filter.deny)
+		for method, timeout := range config.timeouts {
+			if f, ok := routes[method]; ok {
+				routes[method] = f.WithTimeout(timeout)
+			}
+		}
+		openrpc := rpcserver.NewOpenRPCDocument(rpcserver.OpenRPCInfo{
+			Title:   "apigateway JSON-RPC API",
+			Version: version.Version,
+		}, routes, rpccore.MethodDocs)
+		// the document is filtered like the methods it describes
+		discover := rpcserver.MethodAllowed("rpc.discover", filter.allow, filter.deny)
+		if discover {
+			routes["rpc.discover"] = rpcserver.NewDiscoverFunc(openrpc)
+		}
+		var interceptors []rpcserver.Interceptor
+		if config.auth != nil {
+			interceptors = append(interceptors, config.auth.Interceptor())
+		}
+		if config.limiter != nil {
+			interceptors = append(interceptors, config.limiter.Interceptor())
+		}
+		wm := rpcserver.NewWebsocketManager(routes, coreCodec,
+			rpcserver.ReadWait(5*time.Second),
+			rpcserver.EventSubscriber(eventCenter),
+			rpcserver.Interceptors(interceptors...),
+		)
 		// TODO(peerlink): rpcserver get eventBus from input vars.
 		//rpcserver.EventSubscriber(n.eventBus))
 		wm.SetLogger(rpcLogger.With("protocol", "websocket"))
-		mux.HandleFunc("/websocket", wm.WebsocketHandler)
-		rpcserver.RegisterRPCFuncs(mux, rpccore.Routes, coreCodec, rpcLogger)
-		listener, err := rpcserver.StartHTTPServer(
+		wm.SetCORS(config.cors)
+		wsHandler := wm.WebsocketHandler
+		if config.auth != nil {
+			wsHandler = config.auth.UpgradeHandler(wsHandler)
+		}
+		mux.HandleFunc("/websocket", wsHandler)
+		if discover {
+			mux.Handle("/openrpc.json", rpcserver.OpenRPCHandler(openrpc))
+		}
+		if config.servesMetrics(listenAddr) {
+			mux.Handle("/metrics", rpcmetrics.DefaultRegistry.Handler())
+		}
+		rpcserver.RegisterRPCFuncs(mux, routes, coreCodec, rpcLogger, rpcserver.HTTPInterceptors(interceptors...))
+		server, err := rpcserver.StartServer(
 			listenAddr,
 			mux,
 			rpcLogger,
 			// TODO(peerlink): rpcserver.Config get MaxOpenConnections from input vars.
 			//rpcserver.Config{MaxOpenConnections: maxOpenConnections},
-			rpcserver.Config{},
+			rpcserver.Config{CORS: config.cors},
 		)
 		if err != nil {
+			// stops the services too unless servers of earlier calls run
+			if err := StopRPC(listeners[:i]); err != nil {
+				craftlog.Warn("Failed to stop rpc listeners, as: %v", err)
+			}
 			return nil, err
 		}
-		listeners[i] = listener
+		listeners[i] = server.Listener()
+		rpcServersMtx.Lock()
+		rpcServers[listeners[i]] = &rpcServer{server, wm}
+		rpcServersMtx.Unlock()
 	}
 	return listeners, nil
 }
 
-// StopRPC stop RPC server
+// stopIdleServices stops the services of the rpccore methods unless servers
+// started by StartRPC still run on them.
+func stopIdleServices() {
+	rpcServersMtx.Lock()
+	defer rpcServersMtx.Unlock()
+	if len(rpcServers) == 0 {
+		stopServices()
+	}
+}
+
+// stopServices stops the services StartRPC started for the rpccore methods.
+func stopServices() {
+	rpccore.SetFilterManager(nil)
+	rpccore.SetGasPriceOracle(nil)
+	rpccore.SetNonceManager(nil)
+	rpccore.SetBloomIndexer(nil)
+}
+
+// StopRPC stop RPC server, giving pending calls shutdownTimeout to complete.
 func StopRPC(rpcListeners []net.Listener) error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return ShutdownRPC(ctx, rpcListeners)
+}
+
+// ShutdownRPC shuts the RPC servers of rpcListeners down gracefully. They
+// stop accepting connections, answer the pending HTTP requests and close
+// the websocket connections once their pending calls are answered. The
+// services of the rpccore methods are stopped with the last server. It
+// returns when done, or when ctx expires.
+func ShutdownRPC(ctx context.Context, rpcListeners []net.Listener) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(rpcListeners))
+	for i, l := range rpcListeners {
+		rpcServersMtx.Lock()
+		s := rpcServers[l]
+		delete(rpcServers, l)
+		rpcServersMtx.Unlock()
 
-	for _, l := range rpcListeners {
 		//logger.Info("Closing rpc listener", "listener", l)
 		craftlog.InfoKV("Closing rpc listener", map[string]interface{}{"listener": l})
-		if err := l.Close(); err != nil {
+		if s == nil {
+			errs[i] = l.Close()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, s *rpcServer) {
+			defer wg.Done()
+			// http.Server.Shutdown doesn't wait for hijacked websocket
+			// connections, so both are shut down side by side.
+			wsErr := make(chan error, 1)
+			go func() { wsErr <- s.wm.Shutdown(ctx) }()
+			errs[i] = s.server.Shutdown(ctx)
+			if err := <-wsErr; errs[i] == nil {
+				errs[i] = err
+			}
+		}(i, s)
+	}
+	wg.Wait()
+	stopIdleServices()
+
+	for i, err := range errs {
+		if err != nil {
 			//logger.Error("Error closing listener", "listener", l, "err", err)
-			craftlog.ErrorKV("Error closing listener", map[string]interface{}{"listener": l, "err": err})
+			craftlog.ErrorKV("Error closing listener", map[string]interface{}{"listener": rpcListeners[i], "err": err})
 			return err
 		}
 	}
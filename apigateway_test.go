@@ -1,6 +1,11 @@
 package apigateway
 
 import (
+	"io/ioutil"
+	"os"
+
+	"github.com/DSiSc/apigateway/core/accounts"
+	rpccore "github.com/DSiSc/apigateway/rpc/core"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -35,3 +40,32 @@ func TestStartAndStopRPC(t *testing.T) {
 		require.Nil(t, errStop)
 	}
 }
+
+func TestAPIRoutes(t *testing.T) {
+	routes := apiRoutes(nil)
+	assert.Contains(t, routes, "eth_sendTransaction")
+	assert.NotContains(t, routes, "eth_sign")
+	assert.NotContains(t, apiRoutes(rpccore.TestKeySigner()), "personal_unlockAccount")
+
+	dir, err := ioutil.TempDir("", "keystore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ks, err := accounts.NewKeyStore(dir, accounts.ScryptParams(accounts.LightScryptN, accounts.LightScryptP))
+	require.NoError(t, err)
+	routes = apiRoutes(ks)
+	for name := range rpccore.AccountRoutes {
+		assert.Contains(t, routes, name)
+	}
+	assert.Contains(t, routes, "eth_sendTransaction")
+	assert.NotContains(t, rpccore.Routes, "eth_sign")
+}
+
+func TestStartRPCFails(t *testing.T) {
+	// the second listener fails on the address of the first, which is closed
+	_, err := StartRPC(tcpAddr+","+tcpAddr, nil)
+	require.Error(t, err)
+
+	listeners, err := StartRPC(tcpAddr, nil)
+	require.NoError(t, err)
+	require.NoError(t, StopRPC(listeners))
+}
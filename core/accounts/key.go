@@ -0,0 +1,195 @@
+package accounts
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/DSiSc/crypto-suite/crypto/sha3"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// StandardScryptN and StandardScryptP are the scrypt parameters of new
+	// keys, using 256MB of memory and about a second of CPU time.
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+	// LightScryptN and LightScryptP use 4MB of memory and about 100ms of
+	// CPU time, for tests and constrained hosts.
+	LightScryptN = 1 << 12
+	LightScryptP = 6
+
+	scryptR     = 8
+	scryptDKLen = 32
+	keyVersion  = 3
+)
+
+// ErrDecrypt is returned for a wrong passphrase.
+var ErrDecrypt = errors.New("could not decrypt key with given passphrase")
+
+// encryptedKey is a key in the Web3 Secret Storage format, version 3.
+type encryptedKey struct {
+	Address string     `json:"address"`
+	Crypto  cryptoJSON `json:"crypto"`
+	ID      string     `json:"id"`
+	Version int        `json:"version"`
+}
+
+type cryptoJSON struct {
+	Cipher       string                 `json:"cipher"`
+	CipherText   string                 `json:"ciphertext"`
+	CipherParams cipherParamsJSON       `json:"cipherparams"`
+	KDF          string                 `json:"kdf"`
+	KDFParams    map[string]interface{} `json:"kdfparams"`
+	MAC          string                 `json:"mac"`
+}
+
+type cipherParamsJSON struct {
+	IV string `json:"iv"`
+}
+
+// encryptKey encrypts the private key of address with passphrase, deriving
+// the encryption key with scrypt.
+func encryptKey(privateKey []byte, address [20]byte, passphrase string, scryptN, scryptP int) ([]byte, error) {
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	id := make([]byte, 16)
+	for _, b := range [][]byte{salt, iv, id} {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, errors.Wrap(err, "failed to read random bytes")
+		}
+	}
+	derivedKey, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptDKLen)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := aesCTRXOR(derivedKey[:16], privateKey, iv)
+	if err != nil {
+		return nil, err
+	}
+	// a version 4 UUID
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+
+	return json.Marshal(encryptedKey{
+		Address: hex.EncodeToString(address[:]),
+		Crypto: cryptoJSON{
+			Cipher:       "aes-128-ctr",
+			CipherText:   hex.EncodeToString(cipherText),
+			CipherParams: cipherParamsJSON{IV: hex.EncodeToString(iv)},
+			KDF:          "scrypt",
+			KDFParams: map[string]interface{}{
+				"n":     scryptN,
+				"r":     scryptR,
+				"p":     scryptP,
+				"dklen": scryptDKLen,
+				"salt":  hex.EncodeToString(salt),
+			},
+			MAC: hex.EncodeToString(keccak256(derivedKey[16:32], cipherText)),
+		},
+		ID:      fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]),
+		Version: keyVersion,
+	})
+}
+
+// decryptKey returns the private key of the encrypted key keyJSON, with its
+// scrypt or PBKDF2 derived key.
+func decryptKey(keyJSON []byte, passphrase string) ([]byte, error) {
+	var k encryptedKey
+	if err := json.Unmarshal(keyJSON, &k); err != nil {
+		return nil, errors.Wrap(err, "invalid key file")
+	}
+	if k.Version != keyVersion {
+		return nil, errors.Errorf("key version %d not supported", k.Version)
+	}
+	if k.Crypto.Cipher != "aes-128-ctr" {
+		return nil, errors.Errorf("cipher %s not supported", k.Crypto.Cipher)
+	}
+	mac, err := hex.DecodeString(k.Crypto.MAC)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid mac")
+	}
+	iv, err := hex.DecodeString(k.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid iv")
+	}
+	cipherText, err := hex.DecodeString(k.Crypto.CipherText)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ciphertext")
+	}
+	derivedKey, err := deriveKey(k.Crypto, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(keccak256(derivedKey[16:32], cipherText), mac) {
+		return nil, ErrDecrypt
+	}
+	return aesCTRXOR(derivedKey[:16], cipherText, iv)
+}
+
+func deriveKey(c cryptoJSON, passphrase string) ([]byte, error) {
+	salt, err := hex.DecodeString(stringParam(c.KDFParams, "salt"))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid salt")
+	}
+	dkLen := intParam(c.KDFParams, "dklen")
+	if dkLen < 32 {
+		return nil, errors.Errorf("derived key of %d bytes too short", dkLen)
+	}
+	switch c.KDF {
+	case "scrypt":
+		n, r, p := intParam(c.KDFParams, "n"), intParam(c.KDFParams, "r"), intParam(c.KDFParams, "p")
+		return scrypt.Key([]byte(passphrase), salt, n, r, p, dkLen)
+	case "pbkdf2":
+		if prf := stringParam(c.KDFParams, "prf"); prf != "hmac-sha256" {
+			return nil, errors.Errorf("pbkdf2 prf %s not supported", prf)
+		}
+		iter := intParam(c.KDFParams, "c")
+		if iter <= 0 {
+			return nil, errors.New("invalid pbkdf2 iteration count")
+		}
+		return pbkdf2.Key([]byte(passphrase), salt, iter, dkLen, sha256.New), nil
+	default:
+		return nil, errors.Errorf("kdf %s not supported", c.KDF)
+	}
+}
+
+func stringParam(params map[string]interface{}, name string) string {
+	s, _ := params[name].(string)
+	return s
+}
+
+// intParam returns the number name of params, 0 if not a number.
+func intParam(params map[string]interface{}, name string) int {
+	f, _ := params[name].(float64)
+	return int(f)
+}
+
+func aesCTRXOR(key, in, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.Errorf("iv of %d bytes, expected %d", len(iv), aes.BlockSize)
+	}
+	out := make([]byte, len(in))
+	cipher.NewCTR(block, iv).XORKeyStream(out, in)
+	return out, nil
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewKeccak256()
+	for _, b := range data {
+		h.Write(b)
+	}
+	return h.Sum(nil)
+}
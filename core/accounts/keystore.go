@@ -0,0 +1,259 @@
+package accounts
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	wtypes "github.com/DSiSc/wallet/core/types"
+	"github.com/pkg/errors"
+)
+
+// KeyStore is a Signer of the keys stored in a directory, one file per key
+// encrypted with its passphrase. Keys sign once unlocked, until locked
+// again.
+type KeyStore struct {
+	dir     string
+	scryptN int
+	scryptP int
+
+	mtx      sync.Mutex
+	files    map[types.Address]string
+	unlocked map[types.Address]*unlockedKey
+}
+
+type unlockedKey struct {
+	key   *ecdsa.PrivateKey
+	timer *time.Timer // locks the key, nil if unlocked until locked
+}
+
+// NewKeyStore opens the key store in dir, creating it if needed.
+func NewKeyStore(dir string, options ...func(*KeyStore)) (*KeyStore, error) {
+	ks := &KeyStore{
+		dir:      dir,
+		scryptN:  StandardScryptN,
+		scryptP:  StandardScryptP,
+		files:    make(map[types.Address]string),
+		unlocked: make(map[types.Address]*unlockedKey),
+	}
+	for _, option := range options {
+		option(ks)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", dir)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		address, err := readAddress(path)
+		if err != nil {
+			log.Warn("Skipping key file %s, as: %v", path, err)
+			continue
+		}
+		ks.files[address] = path
+	}
+	return ks, nil
+}
+
+// ScryptParams sets the scrypt parameters new keys are encrypted with.
+func ScryptParams(n, p int) func(*KeyStore) {
+	return func(ks *KeyStore) {
+		ks.scryptN, ks.scryptP = n, p
+	}
+}
+
+// readAddress returns the address of the key file at path.
+func readAddress(path string) (types.Address, error) {
+	keyJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return types.Address{}, err
+	}
+	var k encryptedKey
+	if err := json.Unmarshal(keyJSON, &k); err != nil {
+		return types.Address{}, errors.Wrap(err, "invalid key file")
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(k.Address, "0x"))
+	if err != nil || len(b) != len(types.Address{}) {
+		return types.Address{}, errors.Errorf("invalid address %q", k.Address)
+	}
+	var address types.Address
+	copy(address[:], b)
+	return address, nil
+}
+
+// Accounts implements Signer, in the order of their files, that is of
+// creation for the accounts created by the key store.
+func (ks *KeyStore) Accounts() []types.Address {
+	ks.mtx.Lock()
+	defer ks.mtx.Unlock()
+	addresses := make([]types.Address, 0, len(ks.files))
+	for address := range ks.files {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return ks.files[addresses[i]] < ks.files[addresses[j]]
+	})
+	return addresses
+}
+
+// NewAccount generates a key, stores it encrypted with passphrase and
+// returns its address. The account is locked.
+func (ks *KeyStore) NewAccount(passphrase string) (types.Address, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return types.Address{}, errors.Wrap(err, "failed to generate key")
+	}
+	address := types.Address(crypto.PubkeyToAddress(key.PublicKey))
+	keyJSON, err := encryptKey(crypto.FromECDSA(key), address, passphrase, ks.scryptN, ks.scryptP)
+	if err != nil {
+		return types.Address{}, err
+	}
+	// the file name of geth, so the files sort by creation
+	name := fmt.Sprintf("UTC--%s--%x", time.Now().UTC().Format("2006-01-02T15-04-05.000000000Z"), address[:])
+	path := filepath.Join(ks.dir, name)
+	// write to a temporary file first so a crash never leaves a partial key
+	if err := ioutil.WriteFile(path+".tmp", keyJSON, 0600); err != nil {
+		return types.Address{}, errors.Wrap(err, "failed to write key")
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return types.Address{}, errors.Wrap(err, "failed to write key")
+	}
+	ks.mtx.Lock()
+	ks.files[address] = path
+	ks.mtx.Unlock()
+	return address, nil
+}
+
+// Unlock decrypts the key of address with passphrase so it signs, for
+// timeout, or until locked if timeout is 0. Unlocking an unlocked account
+// resets its timeout.
+func (ks *KeyStore) Unlock(address types.Address, passphrase string, timeout time.Duration) error {
+	key, err := ks.decrypt(address, passphrase)
+	if err != nil {
+		return err
+	}
+
+	ks.mtx.Lock()
+	defer ks.mtx.Unlock()
+	ks.lock(address)
+	u := &unlockedKey{key: key}
+	if timeout > 0 {
+		u.timer = time.AfterFunc(timeout, func() {
+			ks.mtx.Lock()
+			defer ks.mtx.Unlock()
+			if ks.unlocked[address] == u {
+				delete(ks.unlocked, address)
+			}
+		})
+	}
+	ks.unlocked[address] = u
+	return nil
+}
+
+// decrypt returns the key of address, decrypted with passphrase.
+func (ks *KeyStore) decrypt(address types.Address, passphrase string) (*ecdsa.PrivateKey, error) {
+	ks.mtx.Lock()
+	path, ok := ks.files[address]
+	ks.mtx.Unlock()
+	if !ok {
+		return nil, ErrUnknownAccount
+	}
+	keyJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// decrypting takes a while, not holding ks.mtx
+	b, err := decryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.ToECDSA(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid key")
+	}
+	if types.Address(crypto.PubkeyToAddress(key.PublicKey)) != address {
+		return nil, errors.Errorf("key file %s holds the key of another address", path)
+	}
+	return key, nil
+}
+
+// Lock locks the key of address.
+func (ks *KeyStore) Lock(address types.Address) error {
+	ks.mtx.Lock()
+	defer ks.mtx.Unlock()
+	if _, ok := ks.files[address]; !ok {
+		return ErrUnknownAccount
+	}
+	ks.lock(address)
+	return nil
+}
+
+func (ks *KeyStore) lock(address types.Address) {
+	if u, ok := ks.unlocked[address]; ok {
+		if u.timer != nil {
+			u.timer.Stop()
+		}
+		delete(ks.unlocked, address)
+	}
+}
+
+// unlockedKey returns the key of address if unlocked.
+func (ks *KeyStore) unlockedKey(address types.Address) (*ecdsa.PrivateKey, error) {
+	ks.mtx.Lock()
+	defer ks.mtx.Unlock()
+	if _, ok := ks.files[address]; !ok {
+		return nil, ErrUnknownAccount
+	}
+	u := ks.unlocked[address]
+	if u == nil {
+		return nil, ErrLocked
+	}
+	return u.key, nil
+}
+
+// SignTx implements Signer, with the key of from if unlocked.
+func (ks *KeyStore) SignTx(from types.Address, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, err := ks.unlockedKey(from)
+	if err != nil {
+		return nil, err
+	}
+	return wtypes.SignTx(tx, wtypes.NewEIP155Signer(chainID), key)
+}
+
+// SignHash implements Signer, with the key of from if unlocked.
+func (ks *KeyStore) SignHash(from types.Address, hash []byte) ([]byte, error) {
+	key, err := ks.unlockedKey(from)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Sign(hash, key)
+}
+
+// SignHashWithPassphrase signs hash with the key of from decrypted with
+// passphrase, locked or not, without unlocking it.
+func (ks *KeyStore) SignHashWithPassphrase(from types.Address, passphrase string, hash []byte) ([]byte, error) {
+	key, err := ks.decrypt(from, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Sign(hash, key)
+}
@@ -0,0 +1,136 @@
+package accounts
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	wtypes "github.com/DSiSc/wallet/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyStore(t *testing.T) (*KeyStore, string) {
+	dir, err := ioutil.TempDir("", "keystore")
+	require.NoError(t, err)
+	ks, err := NewKeyStore(dir, ScryptParams(LightScryptN, LightScryptP))
+	require.NoError(t, err)
+	return ks, dir
+}
+
+func TestKeyStoreAccounts(t *testing.T) {
+	ks, dir := newTestKeyStore(t)
+	defer os.RemoveAll(dir)
+	assert.Empty(t, ks.Accounts())
+
+	first, err := ks.NewAccount("first")
+	require.NoError(t, err)
+	second, err := ks.NewAccount("second")
+	require.NoError(t, err)
+	assert.Equal(t, []types.Address{first, second}, ks.Accounts())
+
+	// other files are skipped
+	require.NoError(t, ioutil.WriteFile(dir+"/README", []byte("keys"), 0600))
+	ks, err = NewKeyStore(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []types.Address{first, second}, ks.Accounts())
+}
+
+func TestKeyStoreSignTx(t *testing.T) {
+	ks, dir := newTestKeyStore(t)
+	defer os.RemoveAll(dir)
+	address, err := ks.NewAccount("passphrase")
+	require.NoError(t, err)
+
+	chainID := big.NewInt(11)
+	newTx := func() *types.Transaction {
+		return &types.Transaction{Data: types.TxData{
+			Recipient: &types.Address{0x01},
+			From:      &address,
+			Amount:    big.NewInt(1),
+			GasLimit:  21000,
+			Price:     big.NewInt(1),
+			V:         new(big.Int),
+			R:         new(big.Int),
+			S:         new(big.Int),
+		}}
+	}
+	_, err = ks.SignTx(address, newTx(), chainID)
+	assert.Equal(t, ErrLocked, err)
+	_, err = ks.SignTx(types.Address{0x02}, newTx(), chainID)
+	assert.Equal(t, ErrUnknownAccount, err)
+
+	assert.Equal(t, ErrDecrypt, ks.Unlock(address, "wrong", 0))
+	assert.Equal(t, ErrUnknownAccount, ks.Unlock(types.Address{0x02}, "passphrase", 0))
+	require.NoError(t, ks.Unlock(address, "passphrase", 0))
+	tx, err := ks.SignTx(address, newTx(), chainID)
+	require.NoError(t, err)
+	sender, err := wtypes.Sender(wtypes.NewEIP155Signer(chainID), tx)
+	require.NoError(t, err)
+	assert.Equal(t, address, types.Address(sender))
+
+	require.NoError(t, ks.Lock(address))
+	_, err = ks.SignTx(address, newTx(), chainID)
+	assert.Equal(t, ErrLocked, err)
+	assert.Equal(t, ErrUnknownAccount, ks.Lock(types.Address{0x02}))
+}
+
+func TestKeyStoreTimedUnlock(t *testing.T) {
+	ks, dir := newTestKeyStore(t)
+	defer os.RemoveAll(dir)
+	address, err := ks.NewAccount("passphrase")
+	require.NoError(t, err)
+
+	require.NoError(t, ks.Unlock(address, "passphrase", 50*time.Millisecond))
+	ks.mtx.Lock()
+	assert.NotNil(t, ks.unlocked[address])
+	ks.mtx.Unlock()
+	time.Sleep(200 * time.Millisecond)
+	ks.mtx.Lock()
+	assert.Nil(t, ks.unlocked[address])
+	ks.mtx.Unlock()
+
+	// unlocking until locked stops the timeout
+	require.NoError(t, ks.Unlock(address, "passphrase", 50*time.Millisecond))
+	require.NoError(t, ks.Unlock(address, "passphrase", 0))
+	time.Sleep(200 * time.Millisecond)
+	ks.mtx.Lock()
+	assert.NotNil(t, ks.unlocked[address])
+	ks.mtx.Unlock()
+}
+
+func TestKeyStoreSignHash(t *testing.T) {
+	ks, dir := newTestKeyStore(t)
+	defer os.RemoveAll(dir)
+	address, err := ks.NewAccount("passphrase")
+	require.NoError(t, err)
+	hash := TextHash([]byte("hello"))
+
+	_, err = ks.SignHash(address, hash)
+	assert.Equal(t, ErrLocked, err)
+	_, err = ks.SignHashWithPassphrase(address, "wrong", hash)
+	assert.Equal(t, ErrDecrypt, err)
+
+	// signing with the passphrase leaves the account locked
+	sig, err := ks.SignHashWithPassphrase(address, "passphrase", hash)
+	require.NoError(t, err)
+	signer, err := RecoverAddress(hash, sig)
+	require.NoError(t, err)
+	assert.Equal(t, address, signer)
+	_, err = ks.SignHash(address, hash)
+	assert.Equal(t, ErrLocked, err)
+
+	require.NoError(t, ks.Unlock(address, "passphrase", 0))
+	sig, err = ks.SignHash(address, hash)
+	require.NoError(t, err)
+	assert.Len(t, sig, 65)
+	signer, err = RecoverAddress(hash, sig)
+	require.NoError(t, err)
+	assert.Equal(t, address, signer)
+
+	_, err = RecoverAddress(hash, sig[:64])
+	assert.Error(t, err)
+}
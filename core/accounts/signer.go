@@ -0,0 +1,53 @@
+// Package accounts holds the accounts the gateway signs transactions for,
+// and their keys, stored encrypted in the Web3 Secret Storage format.
+package accounts
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnknownAccount is returned for an account the signer has no key
+	// of.
+	ErrUnknownAccount = errors.New("unknown account")
+	// ErrLocked is returned for an account whose key isn't unlocked.
+	ErrLocked = errors.New("authentication needed: passphrase or unlock")
+)
+
+// Signer signs transactions and hashes with the keys of its accounts.
+type Signer interface {
+	// Accounts returns the addresses of the accounts.
+	Accounts() []types.Address
+	// SignTx signs tx as from, for the chain chainID.
+	SignTx(from types.Address, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	// SignHash signs the 32 byte hash as from, returning the signature
+	// [R || S || V] with V 0 or 1.
+	SignHash(from types.Address, hash []byte) ([]byte, error)
+}
+
+// TextHash returns the hash of the message data signed by eth_sign and
+// personal_sign, prefixed so it can't be a transaction.
+func TextHash(data []byte) []byte {
+	return keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(data))), data)
+}
+
+// RecoverAddress returns the address whose key signed hash with sig, a
+// signature [R || S || V] with V 0 or 1.
+func RecoverAddress(hash, sig []byte) (types.Address, error) {
+	if len(sig) != 65 {
+		return types.Address{}, errors.Errorf("signature of %d bytes, expected 65", len(sig))
+	}
+	if sig[64] > 1 {
+		return types.Address{}, errors.New("invalid signature recovery id")
+	}
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return types.Address{}, err
+	}
+	return types.Address(crypto.PubkeyToAddress(*pub)), nil
+}
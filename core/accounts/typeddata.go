@@ -0,0 +1,321 @@
+package accounts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// domainType is the struct type of the domain of typed data.
+const domainType = "EIP712Domain"
+
+// TypedData is the typed structured data of EIP-712, with the arrays of
+// version 4.
+type TypedData struct {
+	Types       map[string][]TypedDataField `json:"types"`
+	PrimaryType string                      `json:"primaryType"`
+	Domain      map[string]interface{}      `json:"domain"`
+	Message     map[string]interface{}      `json:"message"`
+}
+
+// TypedDataField is a member of a struct type of typed data.
+type TypedDataField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// UnmarshalJSON keeps the numbers of the values exact.
+func (td *TypedData) UnmarshalJSON(data []byte) error {
+	type typedData TypedData
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode((*typedData)(td))
+}
+
+// Hash returns the hash signed of the typed data, of its domain separator
+// and its message.
+func (td *TypedData) Hash() ([]byte, error) {
+	if _, ok := td.Types[domainType]; !ok {
+		return nil, errors.Errorf("missing type %s", domainType)
+	}
+	domain, err := td.HashStruct(domainType, td.Domain)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid domain")
+	}
+	// the domain alone is signed as is
+	if td.PrimaryType == domainType {
+		return keccak256([]byte{0x19, 0x01}, domain), nil
+	}
+	message, err := td.HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid message")
+	}
+	return keccak256([]byte{0x19, 0x01}, domain, message), nil
+}
+
+// HashStruct returns the hash of data, a value of the struct type typ.
+func (td *TypedData) HashStruct(typ string, data map[string]interface{}) ([]byte, error) {
+	enc, err := td.encodeData(typ, data)
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(enc), nil
+}
+
+// EncodeType returns the encoding of the struct type typ, followed by those
+// of the struct types it references in the order of their names.
+func (td *TypedData) EncodeType(typ string) (string, error) {
+	deps := make(map[string]bool)
+	if err := td.dependencies(typ, deps); err != nil {
+		return "", err
+	}
+	delete(deps, typ)
+	names := make([]string, 0, len(deps))
+	for name := range deps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range append([]string{typ}, names...) {
+		b.WriteString(name)
+		b.WriteByte('(')
+		for i, field := range td.Types[name] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(field.Type)
+			b.WriteByte(' ')
+			b.WriteString(field.Name)
+		}
+		b.WriteByte(')')
+	}
+	return b.String(), nil
+}
+
+// dependencies adds typ and the struct types it references to deps.
+func (td *TypedData) dependencies(typ string, deps map[string]bool) error {
+	typ = baseType(typ)
+	if deps[typ] {
+		return nil
+	}
+	fields, ok := td.Types[typ]
+	if !ok {
+		if isAtomicType(typ) {
+			return nil
+		}
+		return errors.Errorf("unknown type %s", typ)
+	}
+	deps[typ] = true
+	for _, field := range fields {
+		if err := td.dependencies(field.Type, deps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeData returns the type hash of the struct type typ followed by the
+// encodings of the members of data.
+func (td *TypedData) encodeData(typ string, data map[string]interface{}) ([]byte, error) {
+	fields, ok := td.Types[typ]
+	if !ok {
+		return nil, errors.Errorf("unknown type %s", typ)
+	}
+	encType, err := td.EncodeType(typ)
+	if err != nil {
+		return nil, err
+	}
+	enc := keccak256([]byte(encType))
+	for _, field := range fields {
+		value, ok := data[field.Name]
+		if !ok {
+			return nil, errors.Errorf("missing %s of %s", field.Name, typ)
+		}
+		word, err := td.encodeValue(field.Type, value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s of %s", field.Name, typ)
+		}
+		enc = append(enc, word...)
+	}
+	return enc, nil
+}
+
+// encodeValue returns the 32 byte encoding of value, of type typ.
+func (td *TypedData) encodeValue(typ string, value interface{}) ([]byte, error) {
+	if i := strings.LastIndexByte(typ, '['); i > 0 && strings.HasSuffix(typ, "]") {
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, errors.Errorf("%v is not an array", value)
+		}
+		if size := typ[i+1 : len(typ)-1]; size != "" {
+			if n, err := strconv.Atoi(size); err != nil || n != len(items) {
+				return nil, errors.Errorf("%d items, expected %s", len(items), size)
+			}
+		}
+		var enc []byte
+		for j, item := range items {
+			word, err := td.encodeValue(typ[:i], item)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid item %d", j)
+			}
+			enc = append(enc, word...)
+		}
+		return keccak256(enc), nil
+	}
+	if _, ok := td.Types[typ]; ok {
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("%v is not a %s", value, typ)
+		}
+		return td.HashStruct(typ, data)
+	}
+
+	switch {
+	case typ == "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.Errorf("%v is not a string", value)
+		}
+		return keccak256([]byte(s)), nil
+	case typ == "bytes":
+		b, err := hexValue(value)
+		if err != nil {
+			return nil, err
+		}
+		return keccak256(b), nil
+	case typ == "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, errors.Errorf("%v is not a bool", value)
+		}
+		word := make([]byte, 32)
+		if b {
+			word[31] = 1
+		}
+		return word, nil
+	case typ == "address":
+		b, err := hexValue(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != 20 {
+			return nil, errors.Errorf("address of %d bytes", len(b))
+		}
+		return append(make([]byte, 12), b...), nil
+	case strings.HasPrefix(typ, "bytes"):
+		size, err := strconv.Atoi(typ[len("bytes"):])
+		if err != nil || size < 1 || size > 32 {
+			break
+		}
+		b, err := hexValue(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > size {
+			return nil, errors.Errorf("%d bytes for %s", len(b), typ)
+		}
+		word := make([]byte, 32)
+		copy(word, b)
+		return word, nil
+	case strings.HasPrefix(typ, "int"), strings.HasPrefix(typ, "uint"):
+		bits := integerBits(typ)
+		if bits == 0 {
+			break
+		}
+		return encodeInteger(value, bits, typ[0] == 'i')
+	}
+	return nil, errors.Errorf("unknown type %s", typ)
+}
+
+// baseType strips the array suffixes of typ.
+func baseType(typ string) string {
+	if i := strings.IndexByte(typ, '['); i > 0 {
+		return typ[:i]
+	}
+	return typ
+}
+
+func isAtomicType(typ string) bool {
+	switch {
+	case typ == "string", typ == "bytes", typ == "bool", typ == "address":
+		return true
+	case strings.HasPrefix(typ, "bytes"):
+		size, err := strconv.Atoi(typ[len("bytes"):])
+		return err == nil && size >= 1 && size <= 32
+	}
+	return integerBits(typ) != 0
+}
+
+// integerBits returns the size of the integer type typ, 0 if not one.
+func integerBits(typ string) int {
+	size := strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int")
+	if size == typ {
+		return 0
+	}
+	bits, err := strconv.Atoi(size)
+	if err != nil || bits < 8 || bits > 256 || bits%8 != 0 {
+		return 0
+	}
+	return bits
+}
+
+var tt256 = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// encodeInteger returns the two's complement encoding of value, an integer
+// of bits bits given as a number or a decimal or hex string.
+func encodeInteger(value interface{}, bits int, signed bool) ([]byte, error) {
+	n, ok := new(big.Int), false
+	switch v := value.(type) {
+	case json.Number:
+		n, ok = n.SetString(string(v), 10)
+	case float64:
+		if v == math.Trunc(v) {
+			n, _ = big.NewFloat(v).Int(nil)
+			ok = true
+		}
+	case string:
+		if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") {
+			n, ok = n.SetString(v[2:], 16)
+		} else {
+			n, ok = n.SetString(v, 10)
+		}
+	}
+	if !ok {
+		return nil, errors.Errorf("%v is not an integer", value)
+	}
+
+	size := n.BitLen()
+	if n.Sign() < 0 {
+		size = new(big.Int).Not(n).BitLen() // of -n-1
+	}
+	if !signed && n.Sign() < 0 || signed && size > bits-1 || size > bits {
+		return nil, errors.Errorf("%v out of range of %d bits", value, bits)
+	}
+	if n.Sign() < 0 {
+		n.Add(n, tt256)
+	}
+	word := make([]byte, 32)
+	b := n.Bytes()
+	copy(word[32-len(b):], b)
+	return word, nil
+}
+
+func hexValue(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.Errorf("%v is not a hex string", value)
+	}
+	b, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X"))
+	if err != nil {
+		return nil, errors.Errorf("%s is not a hex string", s)
+	}
+	return b, nil
+}
@@ -0,0 +1,134 @@
+package accounts
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the example of EIP-712
+const testTypedData = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func TestTypedDataHash(t *testing.T) {
+	var td TypedData
+	require.NoError(t, json.Unmarshal([]byte(testTypedData), &td))
+
+	encType, err := td.EncodeType("Mail")
+	require.NoError(t, err)
+	assert.Equal(t, "Mail(Person from,Person to,string contents)Person(string name,address wallet)", encType)
+	domain, err := td.HashStruct(domainType, td.Domain)
+	require.NoError(t, err)
+	assert.Equal(t, "f2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f", hex.EncodeToString(domain))
+	message, err := td.HashStruct("Mail", td.Message)
+	require.NoError(t, err)
+	assert.Equal(t, "c52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e", hex.EncodeToString(message))
+	hash, err := td.Hash()
+	require.NoError(t, err)
+	assert.Equal(t, "be609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2", hex.EncodeToString(hash))
+
+	delete(td.Message, "contents")
+	_, err = td.Hash()
+	assert.EqualError(t, err, "invalid message: missing contents of Mail")
+}
+
+func TestTypedDataArrays(t *testing.T) {
+	td := TypedData{Types: map[string][]TypedDataField{
+		"Person": {{Name: "name", Type: "string"}},
+		"Group":  {{Name: "members", Type: "Person[]"}, {Name: "ids", Type: "uint8[2][]"}},
+	}}
+	encType, err := td.EncodeType("Group")
+	require.NoError(t, err)
+	assert.Equal(t, "Group(Person[] members,uint8[2][] ids)Person(string name)", encType)
+
+	person := map[string]interface{}{"name": "Cow"}
+	personHash, err := td.HashStruct("Person", person)
+	require.NoError(t, err)
+	one, err := td.encodeValue("uint8", json.Number("1"))
+	require.NoError(t, err)
+	two, err := td.encodeValue("uint8", "0x02")
+	require.NoError(t, err)
+	members, err := td.encodeValue("Person[]", []interface{}{person, person})
+	require.NoError(t, err)
+	assert.Equal(t, keccak256(personHash, personHash), members)
+	ids, err := td.encodeValue("uint8[2][]", []interface{}{[]interface{}{json.Number("1"), "2"}})
+	require.NoError(t, err)
+	assert.Equal(t, keccak256(keccak256(one, two)), ids)
+
+	_, err = td.encodeValue("uint8[2]", []interface{}{json.Number("1")})
+	assert.Error(t, err)
+	_, err = td.EncodeType("Unknown")
+	assert.Error(t, err)
+}
+
+func TestTypedDataValues(t *testing.T) {
+	var td TypedData
+	word := func(typ string, value interface{}) string {
+		w, err := td.encodeValue(typ, value)
+		require.NoError(t, err, typ)
+		return hex.EncodeToString(w)
+	}
+	zeros := func(n int) string {
+		return hex.EncodeToString(make([]byte, n))
+	}
+	assert.Equal(t, zeros(31)+"01", word("bool", true))
+	assert.Equal(t, zeros(31)+"ff", word("uint8", json.Number("255")))
+	assert.Equal(t, zeros(31)+"10", word("uint256", "16"))
+	assert.Equal(t, zeros(31)+"10", word("uint64", float64(16)))
+	assert.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", word("int8", json.Number("-1")))
+	assert.Equal(t, "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff80", word("int8", json.Number("-128")))
+	assert.Equal(t, "0102"+zeros(30), word("bytes4", "0x0102"))
+	assert.Equal(t, zeros(12)+"cd2a3d9f938e13cd947ec05abc7fe734df8dd826", word("address", "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"))
+
+	for typ, value := range map[string]interface{}{
+		"uint8":   json.Number("256"),
+		"int8":    json.Number("128"),
+		"uint16":  json.Number("-1"),
+		"bytes1":  "0x0102",
+		"bool":    "true",
+		"uint7":   json.Number("1"),
+		"bytes0":  "0x",
+		"string":  json.Number("1"),
+		"address": "0x01",
+	} {
+		_, err := td.encodeValue(typ, value)
+		assert.Error(t, err, typ)
+	}
+}
+
+func TestTextHash(t *testing.T) {
+	// the hash of ethers' hashMessage
+	assert.Equal(t, "a1de988600a42c4b4ab089b619297c17d53cffae5d5120d82d8a92d0bb3b78f2", hex.EncodeToString(TextHash([]byte("Hello World"))))
+}
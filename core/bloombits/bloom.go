@@ -0,0 +1,50 @@
+// Package bloombits indexes the log blooms of blocks in sections of bit
+// vectors, one per bloom bit, like Ethereum's chain indexer, so that log
+// searches over long block ranges only look at the blocks that may match.
+package bloombits
+
+import (
+	"github.com/DSiSc/crypto-suite/crypto/sha3"
+)
+
+const (
+	// BloomByteLength is the number of bytes of a log bloom.
+	BloomByteLength = 256
+	// BloomBitLength is the number of bits of a log bloom.
+	BloomBitLength = 8 * BloomByteLength
+)
+
+// Bloom is the 2048 bit bloom filter of the log addresses and topics of a
+// block, in the layout of Ethereum's logsBloom.
+type Bloom [BloomByteLength]byte
+
+// Add adds data, a log address or topic, to the bloom.
+func (b *Bloom) Add(data []byte) {
+	for _, bit := range bloomBits(data) {
+		b[BloomByteLength-1-bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Or adds the bits of other, a bloom in the same layout, to the bloom.
+func (b *Bloom) Or(other []byte) {
+	for i := 0; i < len(other) && i < BloomByteLength; i++ {
+		b[i] |= other[i]
+	}
+}
+
+// Test tells whether bit is set.
+func (b *Bloom) Test(bit uint) bool {
+	return b[BloomByteLength-1-bit/8]&(1<<(bit%8)) != 0
+}
+
+// bloomBits returns the three bits data sets in a bloom.
+func bloomBits(data []byte) [3]uint {
+	hw := sha3.NewKeccak256()
+	hw.Write(data)
+	h := hw.Sum(nil)
+	var bits [3]uint
+	for i := range bits {
+		bits[i] = (uint(h[2*i])<<8 | uint(h[2*i+1])) % BloomBitLength
+	}
+	return bits
+}
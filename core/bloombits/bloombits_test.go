@@ -0,0 +1,107 @@
+package bloombits
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloom(t *testing.T) {
+	var bloom Bloom
+	bloom.Add([]byte("address"))
+	set := 0
+	for bit := uint(0); bit < BloomBitLength; bit++ {
+		if bloom.Test(bit) {
+			set++
+		}
+	}
+	assert.True(t, set >= 1 && set <= 3)
+	for _, bit := range bloomBits([]byte("address")) {
+		assert.True(t, bloom.Test(bit))
+	}
+
+	var other Bloom
+	other.Or(bloom[:])
+	assert.Equal(t, bloom, other)
+}
+
+func TestGenerator(t *testing.T) {
+	_, err := NewGenerator(12)
+	assert.Error(t, err)
+
+	g, err := NewGenerator(16)
+	require.NoError(t, err)
+	var empty, full Bloom
+	for i := range full {
+		full[i] = 0xff
+	}
+	assert.Error(t, g.AddBloom(1, &full))
+	for i := uint64(0); i < 16; i++ {
+		if i%5 == 0 {
+			require.NoError(t, g.AddBloom(i, &full))
+		} else {
+			require.NoError(t, g.AddBloom(i, &empty))
+		}
+	}
+	assert.Error(t, g.AddBloom(16, &full))
+
+	for _, bit := range []uint{0, 7, BloomBitLength - 1} {
+		vector, err := g.Vector(bit)
+		require.NoError(t, err)
+		// blocks 0, 5, 10 and 15
+		assert.Equal(t, []byte{0x84, 0x21}, vector)
+	}
+	_, err = g.Vector(BloomBitLength)
+	assert.Error(t, err)
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloombits")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := OpenStore(dir, 8)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), s.Sections())
+
+	var bloom Bloom
+	bloom.Add([]byte("topic"))
+	for section := uint64(0); section < 2; section++ {
+		g, err := NewGenerator(8)
+		require.NoError(t, err)
+		for i := uint64(0); i < 8; i++ {
+			b := Bloom{}
+			if i == section {
+				b = bloom
+			}
+			require.NoError(t, g.AddBloom(i, &b))
+		}
+		assert.Error(t, s.Write(section+1, g))
+		require.NoError(t, s.Write(section, g))
+	}
+	assert.Equal(t, uint64(2), s.Sections())
+
+	// resumes after the stored sections
+	s, err = OpenStore(dir, 8)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), s.Sections())
+	bits := bloomBits([]byte("topic"))
+	vectors, err := s.Vectors(1, bits[:])
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{{0x40}, {0x40}, {0x40}}, vectors)
+	_, err = s.Vectors(2, bits[:])
+	assert.Error(t, err)
+
+	// left over by a crash
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "0000000002.bits.tmp"), []byte{1}, 0600))
+	s, err = OpenStore(dir, 8)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), s.Sections())
+
+	_, err = OpenStore(dir, 16)
+	assert.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package bloombits
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Generator transposes the blooms of the blocks of a section into one bit
+// vector per bloom bit, where the bit of a block is set if its bloom has
+// that bit set.
+type Generator struct {
+	size    uint64
+	vectors [BloomBitLength][]byte
+	next    uint64 // index of the next block
+}
+
+// NewGenerator returns a Generator of sections of size blocks, a multiple
+// of 8.
+func NewGenerator(size uint64) (*Generator, error) {
+	if size == 0 || size%8 != 0 {
+		return nil, errors.Errorf("section size %d is not a multiple of 8", size)
+	}
+	g := &Generator{size: size}
+	for bit := range g.vectors {
+		g.vectors[bit] = make([]byte, size/8)
+	}
+	return g, nil
+}
+
+// AddBloom adds the bloom of the block at index in the section. Blocks must
+// be added in order.
+func (g *Generator) AddBloom(index uint64, bloom *Bloom) error {
+	if index != g.next {
+		return errors.Errorf("bloom of block %d added, expected %d", index, g.next)
+	}
+	if index >= g.size {
+		return errors.Errorf("block %d is beyond the section of %d blocks", index, g.size)
+	}
+	mask := byte(1) << (7 - index%8)
+	for bit := uint(0); bit < BloomBitLength; bit++ {
+		if bloom.Test(bit) {
+			g.vectors[bit][index/8] |= mask
+		}
+	}
+	g.next++
+	return nil
+}
+
+// Vector returns the bit vector of bit once all blocks are added.
+func (g *Generator) Vector(bit uint) ([]byte, error) {
+	if g.next != g.size {
+		return nil, errors.Errorf("section incomplete, %d of %d blocks added", g.next, g.size)
+	}
+	if bit >= BloomBitLength {
+		return nil, errors.Errorf("bloom bit %d out of range", bit)
+	}
+	return g.vectors[bit], nil
+}
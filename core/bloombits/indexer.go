@@ -0,0 +1,217 @@
+package bloombits
+
+import (
+	"time"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/craft/types"
+	"github.com/pkg/errors"
+)
+
+// DefaultSectionSize is the number of blocks of a section, as in Ethereum.
+const DefaultSectionSize = 4096
+
+// retryInterval is how long the indexer waits after failing to read the
+// chain before trying again.
+const retryInterval = 10 * time.Second
+
+// Chain is the source of the blocks to index.
+type Chain interface {
+	// Height returns the height of the latest block.
+	Height() (uint64, error)
+	// Bloom returns the log bloom of the block at height.
+	Bloom(height uint64) (*Bloom, error)
+}
+
+// Indexer follows the chain and stores every complete section of blocks.
+// It catches up with the chain when started and on every new head.
+type Indexer struct {
+	cmn.BaseService
+
+	chain       Chain
+	store       *Store
+	eventCenter types.EventCenter
+	heads       chan struct{}
+	done        chan struct{}
+	subscriber  types.Subscriber
+}
+
+// NewIndexer returns an Indexer of chain, resuming after the sections in
+// store.
+func NewIndexer(chain Chain, store *Store, options ...func(*Indexer)) *Indexer {
+	i := &Indexer{
+		chain: chain,
+		store: store,
+		heads: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	for _, option := range options {
+		option(i)
+	}
+	i.BaseService = *cmn.NewBaseService(nil, "BloomIndexer", i)
+	return i
+}
+
+// FollowEvents makes the indexer catch up on every block committed to
+// eventCenter while it runs.
+func FollowEvents(eventCenter types.EventCenter) func(*Indexer) {
+	return func(i *Indexer) {
+		i.eventCenter = eventCenter
+	}
+}
+
+// OnStart implements Service.OnStart by starting to index.
+func (i *Indexer) OnStart() error {
+	if i.eventCenter != nil {
+		i.subscriber = i.eventCenter.Subscribe(types.EventBlockCommitted, func(interface{}) {
+			i.NewHead()
+		})
+	}
+	go i.loop()
+	return nil
+}
+
+// OnStop implements Service.OnStop by unsubscribing from the event center.
+func (i *Indexer) OnStop() {
+	if i.subscriber == nil {
+		return
+	}
+	if err := i.eventCenter.UnSubscribe(types.EventBlockCommitted, i.subscriber); err != nil {
+		log.Warn("Failed to unsubscribe the bloom indexer from event %v, as: %v", types.EventBlockCommitted, err)
+	}
+	i.subscriber = nil
+}
+
+// NewHead tells the indexer a block was committed. It never blocks.
+func (i *Indexer) NewHead() {
+	select {
+	case i.heads <- struct{}{}:
+	default:
+	}
+}
+
+// Done is closed once the indexer stopped, after Stop, when the section
+// being indexed is finished or abandoned.
+func (i *Indexer) Done() <-chan struct{} {
+	return i.done
+}
+
+func (i *Indexer) loop() {
+	defer close(i.done)
+	for {
+		var retry <-chan time.Time
+		if err := i.index(); err != nil {
+			log.Warn("Failed to index log blooms, as: %v", err)
+			retry = time.After(retryInterval)
+		}
+		select {
+		case <-i.Quit():
+			return
+		case <-i.heads:
+		case <-retry:
+		}
+	}
+}
+
+// index stores the complete sections of the chain that aren't stored.
+func (i *Indexer) index() error {
+	height, err := i.chain.Height()
+	if err != nil {
+		return errors.Wrap(err, "failed to get the chain height")
+	}
+	size := i.store.SectionSize()
+	for section := i.store.Sections(); (section+1)*size <= height+1; section++ {
+		select {
+		case <-i.Quit():
+			return nil
+		default:
+		}
+		g, err := NewGenerator(size)
+		if err != nil {
+			return err
+		}
+		for j := uint64(0); j < size; j++ {
+			bloom, err := i.chain.Bloom(section*size + j)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get the bloom of block %d", section*size+j)
+			}
+			if err := g.AddBloom(j, bloom); err != nil {
+				return err
+			}
+		}
+		if err := i.store.Write(section, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Candidates returns the heights from from to to whose blocks may have
+// logs matching filter, along with the height the index ends at. Blocks
+// from there on aren't indexed and have to be searched without it.
+//
+// filter holds groups of alternatives, like the address and topic criteria
+// of a log search. A block matches if it has one alternative of every
+// group, an empty group matches any block.
+func (i *Indexer) Candidates(from, to uint64, filter [][][]byte) ([]uint64, uint64, error) {
+	size := i.store.SectionSize()
+	end := i.store.Sections() * size
+	if from > to || from >= end {
+		return nil, end, nil
+	}
+	if to >= end {
+		to = end - 1
+	}
+	var heights []uint64
+	for section := from / size; section <= to/size; section++ {
+		match, err := i.matchSection(section, filter)
+		if err != nil {
+			return nil, end, err
+		}
+		first, last := section*size, section*size+size-1
+		if first < from {
+			first = from
+		}
+		if last > to {
+			last = to
+		}
+		for height := first; height <= last; height++ {
+			j := height - section*size
+			if match == nil || match[j/8]&(1<<(7-j%8)) != 0 {
+				heights = append(heights, height)
+			}
+		}
+	}
+	return heights, end, nil
+}
+
+// matchSection returns the bit vector of the blocks of section that may
+// match filter, nil if filter matches any block.
+func (i *Indexer) matchSection(section uint64, filter [][][]byte) ([]byte, error) {
+	var match []byte
+	for _, group := range filter {
+		if len(group) == 0 {
+			continue
+		}
+		groupMatch := make([]byte, i.store.SectionSize()/8)
+		for _, data := range group {
+			bits := bloomBits(data)
+			vectors, err := i.store.Vectors(section, bits[:])
+			if err != nil {
+				return nil, err
+			}
+			for k := range groupMatch {
+				groupMatch[k] |= vectors[0][k] & vectors[1][k] & vectors[2][k]
+			}
+		}
+		if match == nil {
+			match = groupMatch
+			continue
+		}
+		for k := range match {
+			match[k] &= groupMatch[k]
+		}
+	}
+	return match, nil
+}
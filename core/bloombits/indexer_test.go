@@ -0,0 +1,193 @@
+package bloombits
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DSiSc/craft/types"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testChain has a log of "even" in every even block and of "odd" in every
+// odd one, "third" in every third.
+type testChain struct {
+	mtx    sync.Mutex
+	height uint64
+	reads  int
+}
+
+func (c *testChain) Height() (uint64, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.height, nil
+}
+
+func (c *testChain) Bloom(height uint64) (*Bloom, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if height > c.height {
+		return nil, errors.Errorf("no block %d", height)
+	}
+	c.reads++
+	var bloom Bloom
+	if height%2 == 0 {
+		bloom.Add([]byte("even"))
+	} else {
+		bloom.Add([]byte("odd"))
+	}
+	if height%3 == 0 {
+		bloom.Add([]byte("third"))
+	}
+	return &bloom, nil
+}
+
+func (c *testChain) setHeight(height uint64) {
+	c.mtx.Lock()
+	c.height = height
+	c.mtx.Unlock()
+}
+
+func waitSections(t *testing.T, s *Store, sections uint64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Sections() < sections {
+		if time.Now().After(deadline) {
+			t.Fatalf("indexed %d sections, want %d", s.Sections(), sections)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloombits")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := OpenStore(dir, 8)
+	require.NoError(t, err)
+
+	chain := &testChain{height: 20}
+	indexer := NewIndexer(chain, store)
+	require.NoError(t, indexer.Start())
+	// blocks 0 to 20, the third section is incomplete
+	waitSections(t, store, 2)
+
+	chain.setHeight(23)
+	indexer.NewHead()
+	waitSections(t, store, 3)
+	require.NoError(t, indexer.Stop())
+	<-indexer.Done()
+	assert.Equal(t, 24, chain.reads)
+
+	heights, end, err := indexer.Candidates(0, 30, [][][]byte{{[]byte("even")}})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(24), end)
+	for _, height := range []uint64{0, 2, 4, 22} {
+		assert.Contains(t, heights, height)
+	}
+	// blooms have false positives, but few with a single log
+	assert.True(t, len(heights) < 16, "%v", heights)
+
+	heights, _, err = indexer.Candidates(5, 20, [][][]byte{{[]byte("even"), []byte("odd")}, {[]byte("third")}, {}})
+	require.NoError(t, err)
+	for _, height := range []uint64{6, 9, 12, 15, 18} {
+		assert.Contains(t, heights, height)
+	}
+	for _, height := range heights {
+		assert.True(t, height >= 5 && height <= 20)
+	}
+
+	heights, _, err = indexer.Candidates(3, 9, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{3, 4, 5, 6, 7, 8, 9}, heights)
+
+	heights, end, err = indexer.Candidates(30, 40, nil)
+	require.NoError(t, err)
+	assert.Empty(t, heights)
+	assert.Equal(t, uint64(24), end)
+}
+
+func TestIndexerResumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloombits")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := OpenStore(dir, 8)
+	require.NoError(t, err)
+	chain := &testChain{height: 15}
+	indexer := NewIndexer(chain, store)
+	require.NoError(t, indexer.Start())
+	waitSections(t, store, 2)
+	require.NoError(t, indexer.Stop())
+	<-indexer.Done()
+
+	store, err = OpenStore(dir, 8)
+	require.NoError(t, err)
+	chain = &testChain{height: 31}
+	indexer = NewIndexer(chain, store)
+	require.NoError(t, indexer.Start())
+	waitSections(t, store, 4)
+	require.NoError(t, indexer.Stop())
+	<-indexer.Done()
+	// only the new sections are read
+	assert.Equal(t, 16, chain.reads)
+}
+
+// testEventCenter holds the functions subscribed to blocks, calling them on
+// commit.
+type testEventCenter struct {
+	types.EventCenter
+	mtx   sync.Mutex
+	funcs map[types.Subscriber]types.EventFunc
+}
+
+func (e *testEventCenter) Subscribe(eventType types.EventType, eventFunc types.EventFunc) types.Subscriber {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	sub := make(types.Subscriber)
+	e.funcs[sub] = eventFunc
+	return sub
+}
+
+func (e *testEventCenter) UnSubscribe(eventType types.EventType, subscriber types.Subscriber) error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	if _, ok := e.funcs[subscriber]; !ok {
+		return errors.New("unknown subscriber")
+	}
+	delete(e.funcs, subscriber)
+	return nil
+}
+
+func (e *testEventCenter) commit() {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	for _, f := range e.funcs {
+		f(nil)
+	}
+}
+
+func TestIndexerFollowsEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloombits")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := OpenStore(dir, 8)
+	require.NoError(t, err)
+
+	chain := &testChain{height: 10}
+	events := &testEventCenter{funcs: make(map[types.Subscriber]types.EventFunc)}
+	indexer := NewIndexer(chain, store, FollowEvents(events))
+	require.NoError(t, indexer.Start())
+	waitSections(t, store, 1)
+
+	chain.setHeight(16)
+	events.commit()
+	waitSections(t, store, 2)
+
+	require.NoError(t, indexer.Stop())
+	<-indexer.Done()
+	assert.Empty(t, events.funcs)
+}
@@ -0,0 +1,122 @@
+package bloombits
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Store keeps the bit vectors of complete sections in a directory, one file
+// per section.
+type Store struct {
+	dir  string
+	size uint64
+
+	mtx      sync.RWMutex
+	sections uint64
+}
+
+// OpenStore opens the store of sections of size blocks in dir, creating it
+// if needed. Sections are stored in order, so the store resumes after the
+// last complete one.
+func OpenStore(dir string, size uint64) (*Store, error) {
+	if size == 0 || size%8 != 0 {
+		return nil, errors.Errorf("section size %d is not a multiple of 8", size)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to create %s", dir)
+	}
+	s := &Store{dir: dir, size: size}
+	for {
+		info, err := os.Stat(s.path(s.sections))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() != s.fileSize() {
+			return nil, errors.Errorf("%s has %d bytes, expected %d, was it written with another section size?",
+				s.path(s.sections), info.Size(), s.fileSize())
+		}
+		s.sections++
+	}
+	return s, nil
+}
+
+// SectionSize returns the number of blocks of a section.
+func (s *Store) SectionSize() uint64 {
+	return s.size
+}
+
+// Sections returns the number of stored sections.
+func (s *Store) Sections() uint64 {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.sections
+}
+
+// Write stores the vectors of g as the next section.
+func (s *Store) Write(section uint64, g *Generator) error {
+	if g.size != s.size {
+		return errors.Errorf("section of %d blocks, the store has %d", g.size, s.size)
+	}
+	if section != s.Sections() {
+		return errors.Errorf("section %d written, expected %d", section, s.Sections())
+	}
+	data := make([]byte, 0, s.fileSize())
+	for bit := uint(0); bit < BloomBitLength; bit++ {
+		vector, err := g.Vector(bit)
+		if err != nil {
+			return err
+		}
+		data = append(data, vector...)
+	}
+	// write to a temporary file first so a crash never leaves a partial section
+	tmp := s.path(section) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write section %d", section)
+	}
+	if err := os.Rename(tmp, s.path(section)); err != nil {
+		return errors.Wrapf(err, "failed to write section %d", section)
+	}
+	s.mtx.Lock()
+	s.sections++
+	s.mtx.Unlock()
+	return nil
+}
+
+// Vectors returns the bit vectors of bits in a stored section.
+func (s *Store) Vectors(section uint64, bits []uint) ([][]byte, error) {
+	if section >= s.Sections() {
+		return nil, errors.Errorf("section %d is not stored", section)
+	}
+	f, err := os.Open(s.path(section))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vectors := make([][]byte, len(bits))
+	for i, bit := range bits {
+		if bit >= BloomBitLength {
+			return nil, errors.Errorf("bloom bit %d out of range", bit)
+		}
+		vectors[i] = make([]byte, s.size/8)
+		if _, err := f.ReadAt(vectors[i], int64(bit)*int64(s.size/8)); err != nil {
+			return nil, errors.Wrapf(err, "failed to read section %d", section)
+		}
+	}
+	return vectors, nil
+}
+
+func (s *Store) path(section uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%010d.bits", section))
+}
+
+func (s *Store) fileSize() int64 {
+	return int64(BloomBitLength) * int64(s.size/8)
+}
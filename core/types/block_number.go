@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"fmt"
 	cmn "github.com/DSiSc/apigateway/common"
 	"github.com/DSiSc/wallet/common/math"
@@ -10,13 +11,15 @@ import (
 type BlockNumber int64
 
 const (
-	PendingBlockNumber  = BlockNumber(-2)
-	LatestBlockNumber   = BlockNumber(-1)
-	EarliestBlockNumber = BlockNumber(0)
+	FinalizedBlockNumber = BlockNumber(-4)
+	SafeBlockNumber      = BlockNumber(-3)
+	PendingBlockNumber   = BlockNumber(-2)
+	LatestBlockNumber    = BlockNumber(-1)
+	EarliestBlockNumber  = BlockNumber(0)
 )
 
 // UnmarshalJSON parses the given JSON fragment into a BlockNumber. It supports:
-// - "latest", "earliest" or "pending" as string arguments
+// - "latest", "earliest", "pending", "safe" or "finalized" as string arguments
 // - the block number
 // Returned errors:
 // - an invalid block number error when the given argument isn't a known strings
@@ -37,6 +40,12 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 	case "pending":
 		*bn = PendingBlockNumber
 		return nil
+	case "safe":
+		*bn = SafeBlockNumber
+		return nil
+	case "finalized":
+		*bn = FinalizedBlockNumber
+		return nil
 	}
 
 	blckNum, err := cmn.DecodeUint64(input)
@@ -59,3 +68,74 @@ func (bn BlockNumber) Touint64() uint64 {
 	intbn := (int64)(bn)
 	return uint64(intbn)
 }
+
+// BlockNumberOrHash selects a block by number or tag, or by hash as of
+// EIP-1898.
+type BlockNumberOrHash struct {
+	BlockNumber      *BlockNumber `json:"blockNumber,omitempty"`
+	BlockHash        *cmn.Hash    `json:"blockHash,omitempty"`
+	RequireCanonical bool         `json:"requireCanonical,omitempty"`
+}
+
+// BlockNumberOrHashWithNumber returns the BlockNumberOrHash selecting bn.
+func BlockNumberOrHashWithNumber(bn BlockNumber) BlockNumberOrHash {
+	return BlockNumberOrHash{BlockNumber: &bn}
+}
+
+// UnmarshalJSON parses a block number, a tag, a block hash or an EIP-1898
+// object with either blockNumber or blockHash and requireCanonical.
+func (bnh *BlockNumberOrHash) UnmarshalJSON(data []byte) error {
+	var object struct {
+		BlockNumber      *BlockNumber `json:"blockNumber"`
+		BlockHash        *cmn.Hash    `json:"blockHash"`
+		RequireCanonical *bool        `json:"requireCanonical"`
+	}
+	if err := json.Unmarshal(data, &object); err == nil {
+		if (object.BlockNumber == nil) == (object.BlockHash == nil) {
+			return fmt.Errorf("exactly one of blockNumber and blockHash expected")
+		}
+		if object.BlockNumber != nil && object.RequireCanonical != nil {
+			return fmt.Errorf("requireCanonical only applies to blockHash")
+		}
+		*bnh = BlockNumberOrHash{BlockNumber: object.BlockNumber, BlockHash: object.BlockHash}
+		if object.RequireCanonical != nil {
+			bnh.RequireCanonical = *object.RequireCanonical
+		}
+		return nil
+	}
+
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	if len(input) == 66 {
+		var hash cmn.Hash
+		if err := hash.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		*bnh = BlockNumberOrHash{BlockHash: &hash}
+		return nil
+	}
+	var bn BlockNumber
+	if err := bn.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*bnh = BlockNumberOrHashWithNumber(bn)
+	return nil
+}
+
+// Number returns the block number selected, and whether it is by number.
+func (bnh BlockNumberOrHash) Number() (BlockNumber, bool) {
+	if bnh.BlockNumber != nil {
+		return *bnh.BlockNumber, true
+	}
+	return BlockNumber(0), false
+}
+
+// Hash returns the block hash selected, and whether it is by hash.
+func (bnh BlockNumberOrHash) Hash() (cmn.Hash, bool) {
+	if bnh.BlockHash != nil {
+		return *bnh.BlockHash, true
+	}
+	return cmn.Hash{}, false
+}
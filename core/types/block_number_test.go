@@ -29,6 +29,8 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 		14: {`someString`, true, BlockNumber(0)},
 		15: {`""`, true, BlockNumber(0)},
 		16: {``, true, BlockNumber(0)},
+		17: {`"safe"`, false, SafeBlockNumber},
+		18: {`"finalized"`, false, FinalizedBlockNumber},
 	}
 
 	for i, test := range tests {
@@ -48,6 +50,55 @@ func TestBlockNumberJSONUnmarshal(t *testing.T) {
 	}
 }
 
+func TestBlockNumberOrHashJSONUnmarshal(t *testing.T) {
+	hash := "0xe670ec64341771606e55d6b4ca35a1a6b75ee3d5145a99d05921026d15273311"
+	tests := []struct {
+		input     string
+		mustFail  bool
+		number    BlockNumber
+		byHash    bool
+		canonical bool
+	}{
+		0:  {`"0x12"`, false, BlockNumber(18), false, false},
+		1:  {`"pending"`, false, PendingBlockNumber, false, false},
+		2:  {`"finalized"`, false, FinalizedBlockNumber, false, false},
+		3:  {`"` + hash + `"`, false, 0, true, false},
+		4:  {`{"blockNumber":"latest"}`, false, LatestBlockNumber, false, false},
+		5:  {`{"blockNumber":"0x1"}`, false, BlockNumber(1), false, false},
+		6:  {`{"blockHash":"` + hash + `"}`, false, 0, true, false},
+		7:  {`{"blockHash":"` + hash + `","requireCanonical":true}`, false, 0, true, true},
+		8:  {`{"blockNumber":"0x1","blockHash":"` + hash + `"}`, true, 0, false, false},
+		9:  {`{"blockNumber":"0x1","requireCanonical":true}`, true, 0, false, false},
+		10: {`{}`, true, 0, false, false},
+		11: {`"someString"`, true, 0, false, false},
+		12: {`0`, true, 0, false, false},
+	}
+
+	for i, test := range tests {
+		var bnh BlockNumberOrHash
+		err := json.Unmarshal([]byte(test.input), &bnh)
+		if test.mustFail {
+			if err == nil {
+				t.Errorf("Test %d should fail", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d should pass but got err: %v", i, err)
+			continue
+		}
+		if h, ok := bnh.Hash(); ok != test.byHash || (ok && h.Hex() != hash) {
+			t.Errorf("Test %d got unexpected hash %v", i, bnh.BlockHash)
+		}
+		if n, ok := bnh.Number(); ok == test.byHash || n != test.number {
+			t.Errorf("Test %d got unexpected number, want %d, got %d", i, test.number, n)
+		}
+		if bnh.RequireCanonical != test.canonical {
+			t.Errorf("Test %d got unexpected requireCanonical %v", i, bnh.RequireCanonical)
+		}
+	}
+}
+
 // ----------------------
 // package Test* others
 func TestToInt64(t *testing.T) {
@@ -70,6 +70,22 @@ func HeaderHash(block *types.Block) (hash types.Hash) {
 	return rlpHash(block.Header)
 }
 
+// BlockSize returns the size of the RLP encoding of the header and the
+// transactions of block.
+func BlockSize(block *types.Block) uint64 {
+	var size writeCounter
+	rlp.Encode(&size, []interface{}{block.Header, block.Transactions})
+	return uint64(size)
+}
+
+// writeCounter counts the bytes written to it.
+type writeCounter uint64
+
+func (c *writeCounter) Write(b []byte) (int, error) {
+	*c += writeCounter(len(b))
+	return len(b), nil
+}
+
 func HashBytes(a types.Hash) []byte {
 	b := make([]byte, len(a))
 	copy(b, a[:])
@@ -1,12 +1,14 @@
 package core
 
 import (
+	"math/big"
+
 	cmn "github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/apigateway/core/bloombits"
 	apitypes "github.com/DSiSc/apigateway/core/types"
 	rpctypes "github.com/DSiSc/apigateway/rpc/core/types"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/repository"
-	"github.com/DSiSc/txpool"
 )
 
 //#### eth_getBlockByHash
@@ -30,15 +32,26 @@ import (
 //
 //`Object` - A block object, or `null` when no block was found:
 //
-//- `number`: `QUANTITY` - the block number. `null` when its pending block.
+//- `number`: `QUANTITY` - the block number.
 //- `hash`: `DATA`, 32 Bytes - hash of the block. `null` when its pending block.
 //- `parentHash`: `DATA`, 32 Bytes - hash of the parent block.
+//- `nonce`: `DATA`, 8 Bytes - always zero, blocks not being mined. `null` when its pending block.
+//- `sha3Uncles`: `DATA`, 32 Bytes - hash of the uncles of the block, always the hash of an empty list.
+//- `logsBloom`: `DATA`, 256 Bytes - the bloom filter of the logs of the block.
 //- `transactionsRoot`: `DATA`, 32 Bytes - the root of the transaction trie of the block.
 //- `stateRoot`: `DATA`, 32 Bytes - the root of the final state trie of the block.
 //- `receiptsRoot`: `DATA`, 32 Bytes - the root of the receipts trie of the block.
 //- `miner`: `DATA`, 20 Bytes - the address of the beneficiary to whom the mining rewards were given.
+//- `difficulty`: `QUANTITY` - always zero.
+//- `totalDifficulty`: `QUANTITY` - always zero.
+//- `extraData`: `DATA` - always empty.
+//- `size`: `QUANTITY` - the size of the block in bytes.
+//- `gasLimit`: `QUANTITY` - the maximum gas allowed in the block, 0 for chains not limiting it.
+//- `gasUsed`: `QUANTITY` - the total gas used by the transactions of the block.
 //- `timestamp`: `QUANTITY` - the unix timestamp for when the block was collated.
 //- `transactions`: `Array` - Array of transaction objects, or 32 Bytes transaction hashes depending on the last given parameter.
+//- `uncles`: `Array` - always empty.
+//- `mixHash`: `DATA`, 32 Bytes - the mix digest of the block.
 //
 //##### Example
 //```js
@@ -56,8 +69,12 @@ import (
 //    "transactionsRoot": "0x56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421",
 //    "stateRoot": "0xd5855eb08b3387c0af375e9cdb6acfc05eb8f519e419b874b6ff2ffda7ed1dff",
 //    "miner": "0x4e65fda2159562a496f9f3522f89122a3088497a",
-//    "timestamp": "0x54e34e8e" // 1424182926
-//    "transactions": [{...},{ ... }]
+//    "gasLimit": "0x2faf080",
+//    "gasUsed": "0x5208",
+//    "size": "0x27f",
+//    "timestamp": "0x54e34e8e", // 1424182926
+//    "transactions": [{...},{ ... }],
+//    ...
 //  }
 //}
 //```
@@ -68,7 +85,7 @@ func GetBlockByHash(blockHash cmn.Hash, fullTx bool) (*rpctypes.Blockdata, error
 	if err == nil {
 		block, err := bc.GetBlockByHash(TypeConvert(&blockHash))
 		if block != nil {
-			return rpcOutputBlock(block, true, fullTx)
+			return rpcOutputBlock(bc, block, true, fullTx)
 		}
 		return nil, err
 	}
@@ -125,7 +142,7 @@ func GetBlockTransactionCountByHash(blockHash cmn.Hash) (*cmn.Uint, error) {
 //
 //##### Parameters
 //
-//1. `QUANTITY|TAG` - integer of a block number, or the string `"earliest"`, `"latest"` or `"pending"`, as in the [default block parameter](#the-default-block-parameter).
+//1. `QUANTITY|TAG` - integer of a block number, or the string `"earliest"`, `"latest"`, `"safe"`, `"finalized"` or `"pending"`, as in the [default block parameter](#the-default-block-parameter).
 //
 //```js
 //params: [
@@ -153,12 +170,18 @@ func GetBlockTransactionCountByHash(blockHash cmn.Hash) (*cmn.Uint, error) {
 //***
 func GetBlockTransactionCountByNumber(blockNr apitypes.BlockNumber) (*cmn.Uint, error) {
 	bc, err := repository.NewLatestStateRepository()
-	height := blockNr.Touint64()
-	if block, err := bc.GetBlockByHeight(height); block != nil {
-		n := cmn.Uint(len(block.Transactions))
-		return &n, err
+	if err != nil {
+		return nil, err
 	}
-	return nil, err
+	block, err := blockByNumber(bc, blockNr)
+	if err == errBlockNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := cmn.Uint(len(block.Transactions))
+	return &n, nil
 }
 
 //#### eth_getBlockByNumber
@@ -167,7 +190,7 @@ func GetBlockTransactionCountByNumber(blockNr apitypes.BlockNumber) (*cmn.Uint,
 //
 //##### Parameters
 //
-//1. `QUANTITY|TAG` - integer of a block number, or the string `"earliest"`, `"latest"` or `"pending"`, as in the [default block parameter](#the-default-block-parameter).
+//1. `QUANTITY|TAG` - integer of a block number, or the string `"earliest"`, `"latest"`, `"safe"`, `"finalized"` or `"pending"`, as in the [default block parameter](#the-default-block-parameter).
 //2. `Boolean` - If `true` it returns the full transaction objects, if `false` only the hashes of the transactions.
 //
 //```js
@@ -192,21 +215,17 @@ func GetBlockTransactionCountByNumber(blockNr apitypes.BlockNumber) (*cmn.Uint,
 //***
 func GetBlockByNumber(blockNr apitypes.BlockNumber, fullTx bool) (*rpctypes.Blockdata, error) {
 	bc, err := repository.NewLatestStateRepository()
-	var block *types.Block
-	if err == nil {
-		if blockNr == apitypes.LatestBlockNumber {
-			block = bc.GetCurrentBlock()
-		} else {
-			height := blockNr.Touint64()
-			block, err = bc.GetBlockByHeight(height)
-		}
-		if block != nil {
-			block.Header.GasLimit = 6721975
-			return rpcOutputBlock(block, true, fullTx)
-		}
+	if err != nil {
 		return nil, err
 	}
-	return nil, err
+	block, err := blockByNumber(bc, blockNr)
+	if err == errBlockNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rpcOutputBlock(bc, block, true, fullTx)
 }
 
 //#### eth_blockNumber
@@ -251,7 +270,7 @@ func BlockNumber() (*cmn.Uint64, error) {
 //##### Parameters
 //
 //1. `DATA`, 20 Bytes - address to check for balance.
-//2. `QUANTITY|TAG` - integer block number, or the string `"latest"`, `"earliest"` or `"pending"`, see the [default block parameter](#the-default-block-parameter)
+//2. `QUANTITY|TAG` - integer block number, the string `"latest"`, `"earliest"`, `"safe"` or `"finalized"`, or a block hash, see the [default block parameter](#the-default-block-parameter). `"pending"` is rejected
 //
 //```js
 //params: [
@@ -279,26 +298,13 @@ func BlockNumber() (*cmn.Uint64, error) {
 //```
 //
 //***
-func GetBalance(address apitypes.Address, blockNr apitypes.BlockNumber) (*cmn.Big, error) {
-	bc, err := repository.NewLatestStateRepository()
-	var block *types.Block
-	if err == nil {
-		if blockNr == apitypes.LatestBlockNumber {
-			block = bc.GetCurrentBlock()
-		} else {
-			height := blockNr.Touint64()
-			block, err = bc.GetBlockByHeight(height)
-		}
-		if &block.HeaderHash != nil {
-			bchash, errbc := repository.NewRepositoryByBlockHash(block.HeaderHash)
-			if errbc == nil {
-				balance := (bchash.GetBalance((types.Address)(address)))
-				return (*cmn.Big)(balance), nil
-			}
-		}
+func GetBalance(address apitypes.Address, blockNr apitypes.BlockNumberOrHash) (*cmn.Big, error) {
+	state, _, err := stateByNumberOrHash(blockNr)
+	if err != nil {
 		return nil, err
 	}
-	return nil, err
+	balance := state.GetBalance((types.Address)(address))
+	return (*cmn.Big)(balance), nil
 }
 
 //#### eth_getCode
@@ -309,7 +315,7 @@ func GetBalance(address apitypes.Address, blockNr apitypes.BlockNumber) (*cmn.Bi
 //##### Parameters
 //
 //1. `DATA`, 20 Bytes - address.
-//2. `QUANTITY|TAG` - integer block number, or the string `"latest"`, `"earliest"` or `"pending"`, see the [default block parameter](#the-default-block-parameter).
+//2. `QUANTITY|TAG` - integer block number, the string `"latest"`, `"earliest"`, `"safe"` or `"finalized"`, or a block hash, see the [default block parameter](#the-default-block-parameter). `"pending"` is rejected.
 //
 //```js
 //params: [
@@ -337,26 +343,13 @@ func GetBalance(address apitypes.Address, blockNr apitypes.BlockNumber) (*cmn.Bi
 //```
 //
 //***
-func GetCode(address apitypes.Address, blockNr apitypes.BlockNumber) (*cmn.Bytes, error) {
-	bc, err := repository.NewLatestStateRepository()
-	var block *types.Block
-	if err == nil {
-		if blockNr == apitypes.LatestBlockNumber {
-			block = bc.GetCurrentBlock()
-		} else {
-			height := blockNr.Touint64()
-			block, err = bc.GetBlockByHeight(height)
-		}
-		if &block.HeaderHash != nil {
-			bchash, errbc := repository.NewRepositoryByBlockHash(block.HeaderHash)
-			if errbc == nil {
-				code := (bchash.GetCode((types.Address)(address)))
-				return cmn.NewBytes(code), nil
-			}
-		}
+func GetCode(address apitypes.Address, blockNr apitypes.BlockNumberOrHash) (*cmn.Bytes, error) {
+	state, _, err := stateByNumberOrHash(blockNr)
+	if err != nil {
 		return nil, err
 	}
-	return nil, err
+	code := state.GetCode((types.Address)(address))
+	return cmn.NewBytes(code), nil
 }
 
 //#### eth_getTransactionCount
@@ -367,7 +360,7 @@ func GetCode(address apitypes.Address, blockNr apitypes.BlockNumber) (*cmn.Bytes
 //##### Parameters
 //
 //1. `DATA`, 20 Bytes - address.
-//2. `QUANTITY|TAG` - integer block number, or the string `"latest"`, `"earliest"` or `"pending"`, see the [default block parameter](#the-default-block-parameter)
+//2. `QUANTITY|TAG` - integer block number, the string `"latest"`, `"earliest"`, `"safe"`, `"finalized"` or `"pending"`, or a block hash, see the [default block parameter](#the-default-block-parameter)
 //
 //```js
 //params: [
@@ -395,30 +388,22 @@ func GetCode(address apitypes.Address, blockNr apitypes.BlockNumber) (*cmn.Bytes
 //```
 //
 //***
-func GetTransactionCount(address apitypes.Address, blockNr apitypes.BlockNumber) (*cmn.Uint64, error) {
-
-	if blockNr == apitypes.PendingBlockNumber {
-		noncePool := txpool.GetPoolNonce((types.Address)(address))
-		if noncePool > 0 {
-			return (*cmn.Uint64)(&noncePool), nil
+func GetTransactionCount(address apitypes.Address, blockNr apitypes.BlockNumberOrHash) (*cmn.Uint64, error) {
+	// the pending nonce follows the transactions of the pool and those
+	// submitted through the gateway
+	if isPending(blockNr) {
+		nonce, err := currentNonceManager().Pending((types.Address)(address))
+		if err != nil {
+			return nil, err
 		}
+		return (*cmn.Uint64)(&nonce), nil
 	}
-	bc, err := repository.NewLatestStateRepository()
-	var block *types.Block
-	if blockNr == apitypes.LatestBlockNumber || blockNr == apitypes.PendingBlockNumber {
-		block = bc.GetCurrentBlock()
-	} else {
-		height := blockNr.Touint64()
-		block, err = bc.GetBlockByHeight(height)
-	}
-	if &block.HeaderHash != nil {
-		bchash, errbc := repository.NewRepositoryByBlockHash(block.HeaderHash)
-		if errbc == nil {
-			nonce := (bchash.GetNonce((types.Address)(address)))
-			return (*cmn.Uint64)(&nonce), nil
-		}
+	state, _, err := stateByNumberOrHash(blockNr)
+	if err != nil {
+		return nil, err
 	}
-	return nil, err
+	nonce := state.GetNonce((types.Address)(address))
+	return (*cmn.Uint64)(&nonce), nil
 }
 
 func TypeConvert(a *cmn.Hash) types.Hash {
@@ -429,137 +414,68 @@ func TypeConvert(a *cmn.Hash) types.Hash {
 	return hash
 }
 
-func rpcOutputBlock(b *types.Block, inclTx bool, fullTx bool) (*rpctypes.Blockdata, error) {
-	fields, err := RPCMarshalBlock(b, inclTx, fullTx)
-	if err != nil {
-		return nil, err
+// emptyUncleHash is the hash of an empty list of uncles, those of every
+// block.
+var emptyUncleHash = cmn.HexToHash("0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347")
+
+func rpcOutputBlock(bc *repository.Repository, b *types.Block, inclTx bool, fullTx bool) (*rpctypes.Blockdata, error) {
+	// the pending block has no receipts
+	var receipts []*types.Receipt
+	if b.HeaderHash != (types.Hash{}) {
+		receipts = bc.GetReceiptByBlockHash(b.HeaderHash)
 	}
-	//fields["totalDifficulty"] = (*hexutil.Big)(s.b.GetTd(b.Hash()))
-	return fields, err
+	return RPCMarshalBlock(b, receipts, inclTx, fullTx)
 }
 
-func RPCMarshalBlock(b *types.Block, inclTx bool, fullTx bool) (*rpctypes.Blockdata, error) {
-	head := b.Header // copies the header once
+// RPCMarshalBlock returns the block object of b, whose gas used and logs
+// bloom are those of receipts. Its transactions are hashes, or full objects
+// if fullTx.
+func RPCMarshalBlock(b *types.Block, receipts []*types.Receipt, inclTx bool, fullTx bool) (*rpctypes.Blockdata, error) {
+	head := b.Header
+	var gasUsed uint64
+	var bloom bloombits.Bloom
+	for _, receipt := range receipts {
+		gasUsed += receipt.GasUsed
+		bloom.Or(receipt.Bloom[:])
+	}
 	fields := rpctypes.Blockdata{
 		Number:           (cmn.Uint64)(head.Height),
-		Hash:             (cmn.Hash)(b.HeaderHash),
 		ParentHash:       (cmn.Hash)(head.PrevBlockHash),
-		MixHash:          (cmn.Hash)(head.MixDigest),
-		StateRoot:        (cmn.Hash)(head.StateRoot),
-		Miner:            (apitypes.Address)(head.CoinBase),
-		Timestamp:        (cmn.Uint64)(head.Timestamp),
+		Sha3Uncles:       emptyUncleHash,
+		LogsBloom:        cmn.Bytes(bloom[:]),
 		TransactionsRoot: (cmn.Hash)(head.TxRoot),
+		StateRoot:        (cmn.Hash)(head.StateRoot),
 		ReceiptsRoot:     (cmn.Hash)(head.ReceiptsRoot),
+		Miner:            (apitypes.Address)(head.CoinBase),
+		Difficulty:       (*cmn.Big)(new(big.Int)),
+		TotalDifficulty:  (*cmn.Big)(new(big.Int)),
+		ExtraData:        cmn.Bytes{},
+		Size:             (cmn.Uint64)(apitypes.BlockSize(b)),
 		GasLimit:         (cmn.Uint64)(head.GasLimit),
+		GasUsed:          (cmn.Uint64)(gasUsed),
+		Timestamp:        (cmn.Uint64)(head.Timestamp),
+		Uncles:           []cmn.Hash{},
+		MixHash:          (cmn.Hash)(head.MixDigest),
+	}
+	// the pending block is not sealed yet
+	if b.HeaderHash != (types.Hash{}) {
+		hash := (cmn.Hash)(b.HeaderHash)
+		fields.Hash = &hash
+		fields.Nonce = cmn.NewBytes(make([]byte, 8))
 	}
 
 	if inclTx {
-		var blockTxs []*rpctypes.BlockTransaction
-		txs := b.Transactions
-		for i := 0; i < len(txs); i++ {
-			tx, _ := toRPCTransaction(txs[i])
-			blockTxs = append(blockTxs, tx)
-		}
-		if fullTx {
-			fields.Transactions = blockTxs
+		for i, tx := range b.Transactions {
+			if !fullTx {
+				fields.Transactions.Hashes = append(fields.Transactions.Hashes, (cmn.Hash)(apitypes.TxHash(tx)))
+				continue
+			}
+			rpcTx, err := newRPCTransaction(tx, (cmn.Hash)(b.HeaderHash), head.Height, uint64(i))
+			if err != nil {
+				return nil, err
+			}
+			fields.Transactions.Full = append(fields.Transactions.Full, rpcTx)
 		}
 	}
-
 	return &fields, nil
 }
-
-func toRPCTransaction(tx *types.Transaction) (*rpctypes.BlockTransaction, error) {
-	var from *apitypes.Address
-	if tx.Data.From != nil {
-		from = (*apitypes.Address)(tx.Data.From)
-	} else {
-		from = nil
-	}
-
-	var gas cmn.Uint64
-	if &tx.Data.GasLimit != nil {
-		gas = (cmn.Uint64)(tx.Data.GasLimit)
-	} else {
-		gas = cmn.Uint64(0)
-	}
-
-	var gasPrice *cmn.Big
-	if tx.Data.Price != nil {
-		gasPrice = (*cmn.Big)(tx.Data.Price)
-	} else {
-		gasPrice = nil
-	}
-
-	var hash *cmn.Hash
-	if tx != nil {
-		h := (cmn.Hash)(apitypes.TxHash(tx))
-		hash = &h
-	} else {
-		hash = nil
-	}
-
-	var input cmn.Bytes
-	if tx.Data.Payload != nil {
-		input = cmn.Bytes(tx.Data.Payload)
-	} else {
-		input = nil
-	}
-
-	var nonce *cmn.Uint64
-	if &tx.Data.AccountNonce != nil {
-		nonce = (*cmn.Uint64)(&tx.Data.AccountNonce)
-	} else {
-		nonce = nil
-	}
-
-	var to *apitypes.Address
-	if tx.Data.Recipient != nil {
-		to = (*apitypes.Address)(tx.Data.Recipient)
-	} else {
-		to = nil
-	}
-
-	var value *cmn.Big
-	if tx.Data.Amount != nil {
-		value = (*cmn.Big)(tx.Data.Amount)
-	} else {
-		value = nil
-	}
-
-	var v *cmn.Big
-	if tx.Data.V != nil {
-		v = (*cmn.Big)(tx.Data.V)
-	} else {
-		v = nil
-	}
-
-	var r *cmn.Big
-	if tx.Data.R != nil {
-		r = (*cmn.Big)(tx.Data.R)
-	} else {
-		r = nil
-	}
-
-	var s *cmn.Big
-	if tx.Data.S != nil {
-		s = (*cmn.Big)(tx.Data.S)
-	} else {
-		s = nil
-	}
-
-	result := &rpctypes.BlockTransaction{
-		From:     from,
-		Gas:      gas,
-		GasPrice: gasPrice,
-		Hash:     hash,
-		Input:    input,
-		Nonce:    nonce,
-		To:       to,
-		Value:    value,
-		V:        v,
-		R:        r,
-		S:        s,
-	}
-
-	return result, nil
-}
@@ -1,12 +1,19 @@
 package core
 
 import (
+	"encoding/json"
 	"fmt"
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
 	"github.com/DSiSc/craft/types"
 	"github.com/DSiSc/monkey"
 	"github.com/DSiSc/repository"
+	"github.com/DSiSc/txpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"math/big"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +26,29 @@ var b *repository.Repository
 // ------------------------
 // package Test*
 
+// mockBlockReceipts makes the receipts of every block use 51000 gas and set the
+// first and last bits of the logs bloom.
+func mockBlockReceipts() {
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash", func(*repository.Repository, types.Hash) []*types.Receipt {
+		first, last := &types.Receipt{GasUsed: 21000}, &types.Receipt{GasUsed: 30000}
+		first.Bloom[0] = 0x01
+		last.Bloom[len(last.Bloom)-1] = 0x80
+		return []*types.Receipt{first, last}
+	})
+}
+
+// mockBlockJSON returns the block object of getMockBlock, with transactions
+// txs.
+func mockBlockJSON(txs string) string {
+	return fmt.Sprintf(`{"number":"0xc","hash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","parentHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","nonce":"0x0000000000000000","sha3Uncles":"0x1dcc4de8dec75d7aab85b567b6ccd41ad312451b948a7413f0a142fd40d49347","logsBloom":"0x01%s80","transactionsRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","stateRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","receiptsRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","miner":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","difficulty":"0x0","totalDifficulty":"0x0","extraData":"0x","size":"%#x","gasLimit":"0x0","gasUsed":"0xc738","timestamp":"0x85","transactions":%s,"uncles":[],"mixHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99"}`,
+		strings.Repeat("00", 254), apitypes.BlockSize(getMockBlock()), txs)
+}
+
+const (
+	mockBlockTxHashes = `["0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192"]`
+	mockBlockTxs      = `[{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0xc","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x0","value":"0x9184e72a","type":"0x0","v":"0x0","r":"0x0","s":"0x0"}]`
+)
+
 func TestGetBlockByHash(t *testing.T) {
 	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
 		return b, nil
@@ -28,6 +58,7 @@ func TestGetBlockByHash(t *testing.T) {
 		blockdata := getMockBlock()
 		return blockdata, nil
 	})
+	mockBlockReceipts()
 
 	// tests case
 	tests := []*Requestdata{
@@ -36,12 +67,19 @@ func TestGetBlockByHash(t *testing.T) {
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getBlockByHash", "id": 1, "params": [
               "0xe670ec64341771606e55d6b4ca35a1a6b75ee3d5145a99d05921026d152733",true]}`),
 			"",
-			`{"jsonrpc":"2.0","id":1,"result":{"number":"0xc","hash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","parentHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","mixHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","stateRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","miner":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","timestamp":"0x85","transactionsRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","receiptsRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","transactions":[{"from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","value":"0x9184e72a","v":"0x0","r":"0x0","s":"0x0"}],"gasLimit":"0x0"}}`},
+			`{"jsonrpc":"2.0","id":1,"result":` + mockBlockJSON(mockBlockTxs) + `}`},
+		{
+
+			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getBlockByHash", "id": 1, "params": [
+              "0xe670ec64341771606e55d6b4ca35a1a6b75ee3d5145a99d05921026d152733",false]}`),
+			"",
+			`{"jsonrpc":"2.0","id":1,"result":` + mockBlockJSON(mockBlockTxHashes) + `}`},
 	}
 	// ------------------------
 	// httptest API
 	doRpcTest(t, tests)
 
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash")
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHash")
 	monkey.Unpatch(repository.NewLatestStateRepository)
 }
@@ -61,6 +99,7 @@ func TestGetBlockByNumber(t *testing.T) {
 		blockdata := getMockBlock()
 		return blockdata
 	})
+	mockBlockReceipts()
 
 	// tests case
 	tests := []*Requestdata{
@@ -69,23 +108,44 @@ func TestGetBlockByNumber(t *testing.T) {
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getBlockByNumber", "id": 1, "params": [
               "0x1b4",true]}`),
 			"",
-			`{"jsonrpc":"2.0","id":1,"result":{"number":"0xc","hash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","parentHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","mixHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","stateRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","miner":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","timestamp":"0x85","transactionsRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","receiptsRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","transactions":[{"from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","value":"0x9184e72a","v":"0x0","r":"0x0","s":"0x0"}],"gasLimit":"0x6691b7"}}`},
+			`{"jsonrpc":"2.0","id":1,"result":` + mockBlockJSON(mockBlockTxs) + `}`},
 		{
 
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getBlockByNumber", "id": 1, "params": [
-              "latest",true]}`),
+              "latest",false]}`),
 			"",
-			`{"jsonrpc":"2.0","id":1,"result":{"number":"0xc","hash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","parentHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","mixHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","stateRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","miner":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","timestamp":"0x85","transactionsRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","receiptsRoot":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","transactions":[{"from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","value":"0x9184e72a","v":"0x0","r":"0x0","s":"0x0"}],"gasLimit":"0x6691b7"}}`},
+			`{"jsonrpc":"2.0","id":1,"result":` + mockBlockJSON(mockBlockTxHashes) + `}`},
 	}
 	// ------------------------
 	// httptest API
 	doRpcTest(t, tests)
 
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash")
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHeight")
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlock")
 	monkey.Unpatch(repository.NewLatestStateRepository)
 }
 
+func TestGetPendingBlock(t *testing.T) {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return getMockBlock()
+	})
+	defer monkey.UnpatchAll()
+
+	block, err := GetBlockByNumber(apitypes.PendingBlockNumber, false)
+	require.NoError(t, err)
+	assert.Equal(t, cmn.Uint64(13), block.Number)
+	assert.Nil(t, block.Hash)
+	assert.Nil(t, block.Nonce)
+	assert.Equal(t, cmn.Uint64(0), block.GasUsed)
+	js, err := json.Marshal(block.Transactions)
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(js))
+}
+
 func TestGetBlockTransactionCountByHash(t *testing.T) {
 
 	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
@@ -195,6 +255,14 @@ func TestGetBalance(t *testing.T) {
 
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getBalance", "id": 1, "params": ["0xc94770007dda54cF92009BFF0dE90c06F603a09f","0x4"]}`),
 			"", `{"jsonrpc":"2.0","id":1,"result":"0x38"}`},
+		{
+
+			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getBalance", "id": 1, "params": ["0xc94770007dda54cF92009BFF0dE90c06F603a09f",{"blockNumber":"0x4"}]}`),
+			"", `{"jsonrpc":"2.0","id":1,"result":"0x38"}`},
+		{
+
+			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getBalance", "id": 1, "params": ["0xc94770007dda54cF92009BFF0dE90c06F603a09f","finalized"]}`),
+			"", `{"jsonrpc":"2.0","id":1,"result":"0x38"}`},
 	}
 	// ------------------------
 	// httptest API
@@ -273,6 +341,9 @@ func TestGetTransactionCount(t *testing.T) {
 	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetNonce", func(*repository.Repository, types.Address) uint64 {
 		return uint64(57)
 	})
+	monkey.Patch(txpool.GetPoolNonce, func(types.Address) uint64 {
+		return uint64(60)
+	})
 
 	// tests case
 	tests := []*Requestdata{
@@ -284,12 +355,17 @@ func TestGetTransactionCount(t *testing.T) {
 
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getTransactionCount", "id": 1, "params": ["0xc94770007dda54cF92009BFF0dE90c06F603a09f","0x4"]}`),
 			"", `{"jsonrpc":"2.0","id":1,"result":"0x39"}`},
+		{
+
+			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getTransactionCount", "id": 1, "params": ["0xc94770007dda54cF92009BFF0dE90c06F603a09f","pending"]}`),
+			"", `{"jsonrpc":"2.0","id":1,"result":"0x3d"}`},
 	}
 	// ------------------------
 	// httptest API
 	doRpcTest(t, tests)
 
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetNonce")
+	monkey.Unpatch(txpool.GetPoolNonce)
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlock")
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHeight")
 	monkey.Unpatch(repository.NewLatestStateRepository)
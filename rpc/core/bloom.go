@@ -0,0 +1,103 @@
+package core
+
+import (
+	"github.com/DSiSc/apigateway/core/bloombits"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	"github.com/DSiSc/craft/log"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+var bloomIndexer *bloombits.Indexer
+
+// SetBloomIndexer sets the index eth_getLogs checks before walking a block
+// range, stopping the previous one.
+func SetBloomIndexer(indexer *bloombits.Indexer) {
+	if bloomIndexer != nil {
+		bloomIndexer.Stop()
+	}
+	bloomIndexer = indexer
+}
+
+// bloomChain is the chain of the repository, as indexed by bloombits.
+type bloomChain struct{}
+
+// NewBloomChain returns the chain of the repository to index with
+// bloombits.NewIndexer.
+func NewBloomChain() bloombits.Chain {
+	return bloomChain{}
+}
+
+// Height implements bloombits.Chain.
+func (bloomChain) Height() (uint64, error) {
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return 0, err
+	}
+	return bc.GetCurrentBlockHeight(), nil
+}
+
+// Bloom implements bloombits.Chain. The blooms of the receipts are
+// completed with their logs, in case the chain leaves them empty.
+func (bloomChain) Bloom(height uint64) (*bloombits.Bloom, error) {
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return nil, err
+	}
+	block, err := bc.GetBlockByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errors.Errorf("unknown block %d", height)
+	}
+	var bloom bloombits.Bloom
+	for _, receipt := range bc.GetReceiptByBlockHash(apitypes.HeaderHash(block)) {
+		bloom.Or(receipt.Bloom[:])
+		for _, l := range receipt.Logs {
+			bloom.Add(l.Address[:])
+			for i := range l.Topics {
+				bloom.Add(l.Topics[i][:])
+			}
+		}
+	}
+	return &bloom, nil
+}
+
+// candidateHeights returns the heights from from to to whose blocks may
+// have logs matching crit: the candidates of the index, if any, then the
+// blocks it doesn't cover yet.
+func candidateHeights(from, to uint64, crit *FilterCriteria) []uint64 {
+	var heights []uint64
+	if bloomIndexer != nil {
+		candidates, end, err := bloomIndexer.Candidates(from, to, bloomFilter(crit))
+		if err != nil {
+			log.Warn("Failed to search the log index, as: %v", err)
+		} else if heights = candidates; end > from {
+			from = end
+		}
+	}
+	for height := from; height <= to; height++ {
+		heights = append(heights, height)
+	}
+	return heights
+}
+
+// bloomFilter returns the address and topic groups of crit for
+// bloombits.Indexer.Candidates.
+func bloomFilter(crit *FilterCriteria) [][][]byte {
+	filter := make([][][]byte, 0, len(crit.Topics)+1)
+	addresses := make([][]byte, len(crit.Addresses))
+	for i := range crit.Addresses {
+		addresses[i] = crit.Addresses[i][:]
+	}
+	filter = append(filter, addresses)
+	for _, sub := range crit.Topics {
+		topics := make([][]byte, len(sub))
+		for i := range sub {
+			topics[i] = sub[i][:]
+		}
+		filter = append(filter, topics)
+	}
+	return filter
+}
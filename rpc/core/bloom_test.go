@@ -0,0 +1,74 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/apigateway/core/bloombits"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomChain(t *testing.T) {
+	mockLogsChain(5)
+	defer unpatchLogsChain()
+
+	chain := NewBloomChain()
+	height, err := chain.Height()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), height)
+
+	bloom, err := chain.Bloom(3)
+	require.NoError(t, err)
+	var expected bloombits.Bloom
+	expected.Add(logsContract[:])
+	expected.Add(logsTopic[:])
+	expected.Add([]byte{0x03, 19: 0})
+	assert.Equal(t, expected, *bloom)
+}
+
+func TestGetLogsIndexed(t *testing.T) {
+	mockLogsChain(20)
+	defer unpatchLogsChain()
+
+	dir, err := ioutil.TempDir("", "bloombits")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := bloombits.OpenStore(dir, 8)
+	require.NoError(t, err)
+	indexer := bloombits.NewIndexer(NewBloomChain(), store)
+	require.NoError(t, indexer.Start())
+	SetBloomIndexer(indexer)
+	defer func() {
+		SetBloomIndexer(nil)
+		<-indexer.Done()
+	}()
+	for deadline := time.Now().Add(5 * time.Second); store.Sections() < 2; time.Sleep(time.Millisecond) {
+		require.True(t, time.Now().Before(deadline), "blocks not indexed")
+	}
+
+	from, to := apitypes.BlockNumber(2), apitypes.LatestBlockNumber
+	logs, err := GetLogs(ctypes.FilterArgs{FromBlock: &from, ToBlock: &to, Addresses: []apitypes.Address{apitypes.Address(logsContract)}})
+	require.NoError(t, err)
+	require.Len(t, logs, 19)
+	for i, l := range logs {
+		assert.Equal(t, uint64(i+2), l.BlockNumber)
+	}
+
+	// the indexed blocks are skipped, those after them are walked
+	crit, err := newFilterCriteria(ctypes.FilterArgs{Addresses: []apitypes.Address{{0x09}}, FromBlock: &from}, 20)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{16, 17, 18, 19, 20}, candidateHeights(2, 20, crit))
+	crit, err = newFilterCriteria(ctypes.FilterArgs{Topics: [][]cmn.Hash{{cmn.Hash(logsTopic)}, {cmn.Hash(types.Hash{0x09})}}, FromBlock: &from}, 20)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{16, 17, 18, 19, 20}, candidateHeights(2, 20, crit))
+	logs, err = GetLogs(ctypes.FilterArgs{FromBlock: &from, Addresses: []apitypes.Address{{0x09}}})
+	require.NoError(t, err)
+	assert.Empty(t, logs)
+}
@@ -6,6 +6,17 @@ See it here: https://github.com/DSiSc/apigateway/tree/master/rpc/lib
 
 Or resort to the rpc documentation at: https://dsisc.github.io/slate/
 
+# The default block parameter
+
+The methods taking a block, by number or at which to read the state, accept:
+
+- a hex encoded block number, as `"0x1b4"`;
+- `"earliest"`, the genesis block;
+- `"latest"`, `"safe"` and `"finalized"`, the last block committed, committed blocks being final;
+- `"pending"`, the block being built on the last block committed. It has no hash nor transactions. The gateway doesn't execute the transactions of the pool, so it has no pending state: `eth_getBalance`, `eth_getCode`, `eth_call` and `eth_estimateGas` reject `"pending"`. The nonces of `eth_getTransactionCount` at `"pending"` follow the transactions of the accounts in the pool and those submitted through the gateway.
+
+Those reading the state (`eth_getBalance`, `eth_getCode`, `eth_getTransactionCount`, `eth_call`, `eth_estimateGas`) also accept a block hash, or an [EIP-1898](https://eips.ethereum.org/EIPS/eip-1898) object `{"blockNumber": "0x1b4"}` or `{"blockHash": "0x...", "requireCanonical": true}`.
+
 # Endpoints
 */
 package core
@@ -0,0 +1,238 @@
+package core
+
+import (
+	"reflect"
+
+	"github.com/DSiSc/apigateway/core/types"
+	rpc "github.com/DSiSc/apigateway/rpc/lib/server"
+)
+
+func init() {
+	rpc.RegisterSchema(reflect.TypeOf(types.Address{}), rpc.Schema{
+		"type":    "string",
+		"pattern": "^0x[0-9a-fA-F]{40}$",
+		"title":   "20 byte hex encoded address",
+	})
+	rpc.RegisterSchema(reflect.TypeOf(types.BlockNumber(0)), rpc.Schema{
+		"title": "Block number or tag",
+		"oneOf": []rpc.Schema{
+			{"type": "string", "pattern": "^0x(0|[1-9a-fA-F][0-9a-fA-F]*)$"},
+			{"type": "string", "enum": []string{"earliest", "latest", "pending", "safe", "finalized"}},
+		},
+	})
+	rpc.RegisterSchema(reflect.TypeOf(types.BlockNumberOrHash{}), rpc.Schema{
+		"title":       "Block number, tag or hash",
+		"description": "There is no state at pending, but for the nonces.",
+		"oneOf": []rpc.Schema{
+			{"type": "string", "pattern": "^0x(0|[1-9a-fA-F][0-9a-fA-F]*)$"},
+			{"type": "string", "enum": []string{"earliest", "latest", "pending", "safe", "finalized"}},
+			{"type": "string", "pattern": "^0x[0-9a-fA-F]{64}$"},
+			{
+				"type": "object",
+				"properties": rpc.Schema{
+					"blockNumber":      rpc.Schema{"type": "string"},
+					"blockHash":        rpc.Schema{"type": "string", "pattern": "^0x[0-9a-fA-F]{64}$"},
+					"requireCanonical": rpc.Schema{"type": "boolean"},
+				},
+			},
+		},
+	})
+	rpc.RegisterSchema(reflect.TypeOf(FilterChanges{}), rpc.Schema{
+		"type":  "array",
+		"title": "Block hashes, transaction hashes or logs",
+	})
+}
+
+// MethodDocs describes the methods of Routes and AccountRoutes in the OpenRPC
+// document.
+var MethodDocs = map[string]rpc.MethodDoc{
+	"eth_sendTransaction": {
+		Summary:     "Submits a transaction signed by the node.",
+		Description: "Creates a transaction from the given call arguments, signs it with the account of from and adds it to the transaction pool.",
+		Result:      "transactionHash",
+	},
+	"eth_sendRawTransaction": {
+		Summary:     "Submits a signed, RLP encoded transaction.",
+		Description: "Transactions that can't be mined, oversized, signed for another chain, underpriced, with a used or far ahead nonce or costing more than the balance of the sender, are rejected.",
+		Result:      "transactionHash",
+	},
+	"eth_sendCrossRawTransaction": {
+		Summary: "Submits a signed, RLP encoded cross chain transaction to the chain at url.",
+		Result:  "transactionHash",
+	},
+	"eth_receiveCrossRawTransactionReq": {
+		Summary: "Receives a cross chain transaction submitted by another chain.",
+		Result:  "transactionHash",
+	},
+	"eth_getBlockByHash": {
+		Summary:     "Returns the block with the given hash.",
+		Description: "The transactions of the block are hashes, or full objects if fullTx is true.",
+		Result:      "block",
+	},
+	"eth_getBlockByNumber": {
+		Summary:     "Returns the block with the given number.",
+		Description: "The transactions of the block are hashes, or full objects if fullTx is true.",
+		Result:      "block",
+	},
+	"eth_getTransactionByHash": {
+		Summary: "Returns the transaction with the given hash.",
+		Result:  "transaction",
+	},
+	"eth_getTransactionReceipt": {
+		Summary: "Returns the receipt of the transaction with the given hash.",
+		Result:  "receipt",
+	},
+	"eth_getBlockTransactionCountByHash": {
+		Summary: "Returns the number of transactions in the block with the given hash.",
+		Result:  "transactionCount",
+	},
+	"eth_getBlockTransactionCountByNumber": {
+		Summary: "Returns the number of transactions in the block with the given number.",
+		Result:  "transactionCount",
+	},
+	"eth_blockNumber": {
+		Summary: "Returns the number of the latest block.",
+		Result:  "blockNumber",
+	},
+	"eth_getBalance": {
+		Summary: "Returns the balance of an account at the given block.",
+		Result:  "balance",
+	},
+	"eth_getCode": {
+		Summary: "Returns the code of a contract at the given block.",
+		Result:  "code",
+	},
+	"eth_getTransactionCount": {
+		Summary:     "Returns the nonce of an account at the given block.",
+		Description: "At the pending block, the nonce follows the transactions of the account in the pool and those submitted through the gateway.",
+		Result:      "transactionCount",
+	},
+	"eth_getPendingNonce": {
+		Summary:     "Returns the nonce the next transaction of an account built by the gateway gets.",
+		Description: "After the nonces in the chain, the pool and handed out to the transactions submitted through the gateway.",
+		Result:      "nonce",
+	},
+	"eth_getTransactionByBlockHashAndIndex": {
+		Summary: "Returns the transaction at index in the block with the given hash.",
+		Result:  "transaction",
+	},
+	"eth_getTransactionByBlockNumberAndIndex": {
+		Summary: "Returns the transaction at index in the block with the given number.",
+		Result:  "transaction",
+	},
+	"eth_getLogs": {
+		Summary:     "Returns the logs matching a filter.",
+		Description: "Walks the receipts of the blocks from fromBlock to toBlock, or of the block with hash blockHash, and returns the logs of the given addresses and topics.",
+		Result:      "logs",
+	},
+	"eth_newFilter": {
+		Summary:     "Installs a filter of logs, polled with eth_getFilterChanges.",
+		Description: "Takes the criteria of eth_getLogs, without blockHash. Filters are uninstalled when they aren't polled for a while.",
+		Result:      "filterID",
+	},
+	"eth_newBlockFilter": {
+		Summary: "Installs a filter of new blocks, polled with eth_getFilterChanges.",
+		Result:  "filterID",
+	},
+	"eth_newPendingTransactionFilter": {
+		Summary: "Installs a filter of new pending transactions, polled with eth_getFilterChanges.",
+		Result:  "filterID",
+	},
+	"eth_getFilterChanges": {
+		Summary:     "Returns the changes of a filter since it was last polled.",
+		Description: "Returns block hashes, transaction hashes or logs, depending on the type of the filter.",
+		Result:      "changes",
+	},
+	"eth_getFilterLogs": {
+		Summary: "Returns all logs matching a filter installed with eth_newFilter.",
+		Result:  "logs",
+	},
+	"eth_uninstallFilter": {
+		Summary: "Uninstalls a filter.",
+		Result:  "uninstalled",
+	},
+	"eth_call": {
+		Summary:     "Executes a call without creating a transaction.",
+		Description: "Runs the call against the state of the given block and returns its return data. A call that reverts fails with code 3, the decoded reason in the message and the revert data in the error data.",
+		Result:      "returnData",
+	},
+	"eth_gasPrice": {
+		Summary: "Returns the current gas price.",
+		Result:  "gasPrice",
+	},
+	"eth_estimateGas": {
+		Summary:     "Returns the gas needed to execute a transaction.",
+		Description: "Searches the least gas the transaction succeeds with against the state of the given block, up to the gas of the transaction and the gas cap of the gateway.",
+		Result:      "gas",
+	},
+	"eth_accounts": {
+		Summary: "Returns the accounts the node can sign for.",
+		Result:  "accounts",
+	},
+	"eth_sign": {
+		Summary:     "Signs a message with the key of an account.",
+		Description: "The message is prefixed with the Ethereum signed message header. The account must be unlocked.",
+		Result:      "signature",
+	},
+	"eth_signTypedData_v4": {
+		Summary:     "Signs EIP-712 typed data with the key of an account.",
+		Description: "The typed data is given as an object or its JSON encoding. The account must be unlocked.",
+		Result:      "signature",
+	},
+	"eth_subscribe": {
+		Summary:     "Subscribes to events, over websocket only.",
+		Description: `Takes the event type, "newHeads", "logs" or "newPendingTransactions", followed by its options.`,
+		Result:      "subscriptionID",
+	},
+	"eth_unsubscribe": {
+		Summary: "Cancels a subscription, over websocket only.",
+		Result:  "unsubscribed",
+	},
+	"personal_newAccount": {
+		Summary:     "Creates an account in the key store.",
+		Description: "Its key is stored encrypted with the passphrase. The account is locked.",
+		Result:      "address",
+	},
+	"personal_unlockAccount": {
+		Summary:     "Unlocks an account of the key store, so eth_sendTransaction signs with it.",
+		Description: "For the given seconds, 300 by default, or until locked if 0.",
+		Result:      "unlocked",
+	},
+	"personal_lockAccount": {
+		Summary: "Locks an account of the key store.",
+		Result:  "locked",
+	},
+	"personal_listAccounts": {
+		Summary: "Returns the accounts of the key store.",
+		Result:  "accounts",
+	},
+	"personal_sign": {
+		Summary:     "Signs a message like eth_sign, with the parameters in the other order.",
+		Description: "With the passphrase, a locked account signs without being unlocked.",
+		Result:      "signature",
+	},
+	"personal_ecRecover": {
+		Summary: "Returns the account that signed a message with eth_sign or personal_sign.",
+		Result:  "address",
+	},
+	"net_listening": {
+		Summary: "Returns whether the node is listening for connections.",
+		Result:  "listening",
+	},
+	"net_version": {
+		Summary: "Returns the network ID.",
+		Result:  "networkID",
+	},
+	"net_nodeInfo": {
+		Summary: "Returns the nodes of the network.",
+		Result:  "nodes",
+	},
+	"net_sysContract": {
+		Summary: "Returns the addresses of the system contracts, by name.",
+		Result:  "contracts",
+	},
+	"net_channelInfo": {
+		Summary: "Returns the channels of the node.",
+		Result:  "channels",
+	},
+}
@@ -0,0 +1,388 @@
+package core
+
+import (
+	"encoding/json"
+	"math/big"
+	"sync"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+// Limits of eth_getLogs queries.
+var (
+	// MaxLogsBlockRange is the number of blocks a query may span.
+	MaxLogsBlockRange uint64 = 10000
+	// MaxLogsResults is the number of logs a query may return.
+	MaxLogsResults = 10000
+)
+
+//#### eth_getLogs
+//
+//Returns an array of all logs matching a given filter object.
+//
+//##### Parameters
+//
+//1. `Object` - The filter options:
+//  - `fromBlock`: `QUANTITY|TAG` - (optional, default: `"latest"`) Integer block number, or `"latest"`, `"earliest"` or `"pending"`.
+//  - `toBlock`: `QUANTITY|TAG` - (optional, default: `"latest"`) Integer block number, or `"latest"`, `"earliest"` or `"pending"`.
+//  - `address`: `DATA|Array`, 20 Bytes - (optional) Contract address or a list of addresses from which logs should originate.
+//  - `topics`: `Array of DATA`, - (optional) Array of 32 Bytes `DATA` topics. Topics are order-dependent. Each topic can also be an array of DATA with "or" options.
+//  - `blockHash`: `DATA`, 32 Bytes - (optional) Restricts the logs returned to the single block with the 32-byte hash `blockHash`. Using `blockHash` is equivalent to `fromBlock` = `toBlock` = the block number with hash `blockHash`. If `blockHash` is present in the filter criteria, then neither `fromBlock` nor `toBlock` are allowed.
+//
+//```js
+//params: [{
+//  "fromBlock": "0x1",
+//  "toBlock": "0x2",
+//  "address": "0x8888f1f195afa192cfee860698584c030f4c9db1",
+//  "topics": ["0x000000000000000000000000a94f5374fce5edbc8e2a8697c15331677e6ebf0b", null, ["0x000000000000000000000000a94f5374fce5edbc8e2a8697c15331677e6ebf0b", "0x0000000000000000000000000aff3454fce5edbc8cca8697c15331677e6ebccc"]]
+//}]
+//```
+//
+//The range may span at most `MaxLogsBlockRange` blocks, and the query may match at most `MaxLogsResults` logs.
+//Block ranges are checked against the log index first, if the gateway builds one, skipping the blocks that can't match.
+//
+//##### Returns
+//
+//`Array` - Array of log objects, see the `logs` of [eth_getTransactionReceipt](#eth_gettransactionreceipt).
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"eth_getLogs","params":[{"topics":["0x000000000000000000000000a94f5374fce5edbc8e2a8697c15331677e6ebf0b"]}],"id":74}'
+//
+//// Result
+//{
+//  "id":74,
+//  "jsonrpc": "2.0",
+//  "result": [{
+//    "removed": false,
+//    "logIndex": "0x1",
+//    "transactionIndex": "0x0",
+//    "transactionHash": "0xdf829c5a142f1fccd7d8216c5785ac562ff41e2dcfdf5785ac562ff41e2dcf",
+//    "blockHash": "0x8216c5785ac562ff41e2dcfdf5785ac562ff41e2dcfdf829c5a142f1fccd7d",
+//    "blockNumber": "0x1b4",
+//    "address": "0x8888f1f195afa192cfee860698584c030f4c9db1",
+//    "data": "0x0000000000000000000000000000000000000000000000000000000000000000",
+//    "topics": ["0x000000000000000000000000a94f5374fce5edbc8e2a8697c15331677e6ebf0b"],
+//    "transactionLogIndex": "0x1"
+//  }]
+//}
+//```
+//
+//***
+func GetLogs(args ctypes.FilterArgs) ([]*ctypes.RPCLog, error) {
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return nil, err
+	}
+	crit, err := newFilterCriteria(args, bc.GetCurrentBlockHeight())
+	if err != nil {
+		return nil, err
+	}
+	return getLogs(bc, crit)
+}
+
+// newFilterCriteria resolves the block tags of args, where the tags but
+// earliest are the block at height head and a missing block is latest.
+func newFilterCriteria(args ctypes.FilterArgs, head uint64) (*FilterCriteria, error) {
+	crit := matchCriteria(args)
+	if args.BlockHash != nil {
+		if args.FromBlock != nil || args.ToBlock != nil {
+			return nil, errors.New("blockHash excludes fromBlock and toBlock")
+		}
+		hash := crafttypes.Hash(*args.BlockHash)
+		crit.BlockHash = &hash
+		return crit, nil
+	}
+
+	resolve := func(bn *apitypes.BlockNumber) *big.Int {
+		if bn == nil || bn.Int64() < 0 {
+			return new(big.Int).SetUint64(head)
+		}
+		return big.NewInt(bn.Int64())
+	}
+	crit.FromBlock, crit.ToBlock = resolve(args.FromBlock), resolve(args.ToBlock)
+	if crit.FromBlock.Cmp(crit.ToBlock) > 0 {
+		return nil, errors.Errorf("fromBlock %v is after toBlock %v", crit.FromBlock, crit.ToBlock)
+	}
+	if crit.ToBlock.Uint64() > head {
+		crit.ToBlock.SetUint64(head)
+	}
+	return crit, nil
+}
+
+// matchCriteria returns the address and topic criteria of args.
+func matchCriteria(args ctypes.FilterArgs) *FilterCriteria {
+	crit := &FilterCriteria{
+		Addresses: make([]crafttypes.Address, len(args.Addresses)),
+		Topics:    make([][]crafttypes.Hash, len(args.Topics)),
+	}
+	for i, address := range args.Addresses {
+		crit.Addresses[i] = crafttypes.Address(address)
+	}
+	for i, sub := range args.Topics {
+		crit.Topics[i] = make([]crafttypes.Hash, len(sub))
+		for j, topic := range sub {
+			crit.Topics[i][j] = crafttypes.Hash(topic)
+		}
+	}
+	return crit
+}
+
+// getLogs walks the receipts of the blocks crit selects and returns the
+// logs that match it.
+func getLogs(bc *repository.Repository, crit *FilterCriteria) ([]*ctypes.RPCLog, error) {
+	logs := []*ctypes.RPCLog{}
+	if crit.BlockHash != nil {
+		block, err := bc.GetBlockByHash(*crit.BlockHash)
+		if err != nil || block == nil {
+			return nil, errors.Errorf("unknown block %x", *crit.BlockHash)
+		}
+		return appendBlockLogs(logs, bc, block, crit)
+	}
+
+	from, to := crit.FromBlock.Uint64(), crit.ToBlock.Uint64()
+	if from <= to && to-from >= MaxLogsBlockRange {
+		return nil, errors.Errorf("block range %d-%d exceeds the limit of %d blocks", from, to, MaxLogsBlockRange)
+	}
+	for _, height := range candidateHeights(from, to, crit) {
+		block, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get block %d", height)
+		}
+		if logs, err = appendBlockLogs(logs, bc, block, crit); err != nil {
+			return nil, err
+		}
+	}
+	return logs, nil
+}
+
+// appendBlockLogs appends the logs of block that match crit to logs.
+func appendBlockLogs(logs []*ctypes.RPCLog, bc *repository.Repository, block *crafttypes.Block, crit *FilterCriteria) ([]*ctypes.RPCLog, error) {
+	receipts := bc.GetReceiptByBlockHash(apitypes.HeaderHash(block))
+	logs = append(logs, blockLogs(block, receipts, crit)...)
+	if len(logs) > MaxLogsResults {
+		return nil, errors.Errorf("query returned more than %d results", MaxLogsResults)
+	}
+	return logs, nil
+}
+
+// blockLogs returns the log objects of the logs of block, in its receipts,
+// that match the addresses and topics of crit. The block range is walked
+// already, the heights of the logs aren't trusted.
+func blockLogs(block *crafttypes.Block, receipts []*crafttypes.Receipt, crit *FilterCriteria) []*ctypes.RPCLog {
+	hash := apitypes.HeaderHash(block)
+	var logs []*ctypes.RPCLog
+	var logIndex uint64
+	for index, receipt := range receipts {
+		for i, l := range receipt.Logs {
+			if matchLog(l, crit.Addresses, crit.Topics) {
+				logs = append(logs, newRPCLog(l, cmn.Hash(receipt.TxHash), cmn.Hash(hash), block.Header.Height, uint64(index), logIndex, uint64(i)))
+			}
+			logIndex++
+		}
+	}
+	return logs
+}
+
+var (
+	filtersMtx sync.RWMutex
+	filters    *FilterManager
+)
+
+// SetFilterManager sets the FilterManager of the polling filter methods,
+// stopping the previous one.
+func SetFilterManager(fm *FilterManager) {
+	filtersMtx.Lock()
+	old := filters
+	filters = fm
+	filtersMtx.Unlock()
+	if old != nil {
+		old.Stop()
+	}
+}
+
+func filterManager() (*FilterManager, error) {
+	filtersMtx.RLock()
+	defer filtersMtx.RUnlock()
+	if filters == nil {
+		return nil, errors.New("filters are not enabled")
+	}
+	return filters, nil
+}
+
+// FilterChanges is the result of eth_getFilterChanges: block or transaction
+// hashes, or logs, depending on the type of the filter.
+type FilterChanges struct {
+	hashes []cmn.Hash
+	logs   []*ctypes.RPCLog
+}
+
+// MarshalJSON encodes the logs if any, else the hashes.
+func (c FilterChanges) MarshalJSON() ([]byte, error) {
+	switch {
+	case len(c.logs) > 0:
+		return json.Marshal(c.logs)
+	case len(c.hashes) > 0:
+		return json.Marshal(c.hashes)
+	}
+	return []byte("[]"), nil
+}
+
+//#### eth_newFilter
+//
+//Creates a filter object, based on filter options, to notify when the state changes (logs).
+//To check if the state has changed, call [eth_getFilterChanges](#eth_getfilterchanges).
+//
+//##### Parameters
+//
+//1. `Object` - The filter options, see [eth_getLogs](#eth_getlogs). `blockHash` is not supported.
+//
+//##### Returns
+//
+//`QUANTITY` - A filter id.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"eth_newFilter","params":[{"topics":["0x12341234"]}],"id":73}'
+//
+//// Result
+//{
+//  "id":73,
+//  "jsonrpc": "2.0",
+//  "result": "0x1d0c2f3e5a9c1b7b3a0e8c4e55d39e6c"
+//}
+//```
+//
+//***
+func NewFilter(args ctypes.FilterArgs) (string, error) {
+	fm, err := filterManager()
+	if err != nil {
+		return "", err
+	}
+	if args.BlockHash != nil {
+		return "", errors.New("filters don't support blockHash")
+	}
+	return fm.install(&filter{typ: logsFilter, args: args, crit: matchCriteria(args)}), nil
+}
+
+//#### eth_newBlockFilter
+//
+//Creates a filter in the node, to notify when a new block arrives.
+//To check if the state has changed, call [eth_getFilterChanges](#eth_getfilterchanges).
+//
+//##### Parameters
+//None
+//
+//##### Returns
+//
+//`QUANTITY` - A filter id.
+//
+//***
+func NewBlockFilter() (string, error) {
+	fm, err := filterManager()
+	if err != nil {
+		return "", err
+	}
+	return fm.install(&filter{typ: blockFilter}), nil
+}
+
+//#### eth_newPendingTransactionFilter
+//
+//Creates a filter in the node, to notify when new pending transactions arrive.
+//To check if the state has changed, call [eth_getFilterChanges](#eth_getfilterchanges).
+//
+//##### Parameters
+//None
+//
+//##### Returns
+//
+//`QUANTITY` - A filter id.
+//
+//***
+func NewPendingTransactionFilter() (string, error) {
+	fm, err := filterManager()
+	if err != nil {
+		return "", err
+	}
+	return fm.install(&filter{typ: pendingTxFilter}), nil
+}
+
+//#### eth_getFilterChanges
+//
+//Polling method for a filter, which returns an array of logs which occurred since last poll.
+//
+//##### Parameters
+//
+//1. `QUANTITY` - the filter id.
+//
+//##### Returns
+//
+//`Array` - Array of log objects, or an empty array if nothing has changed since last poll.
+//
+//- For filters created with `eth_newBlockFilter` the return are block hashes (`DATA`, 32 Bytes), e.g. `["0x3454645634534..."]`.
+//- For filters created with `eth_newPendingTransactionFilter ` the return are transaction hashes (`DATA`, 32 Bytes), e.g. `["0x6345343454645..."]`.
+//- For filters created with `eth_newFilter` logs are objects, see [eth_getLogs](#eth_getlogs).
+//
+//Filters are uninstalled when they aren't polled for `DefaultFilterTimeout`, and buffer at most `DefaultFilterBufferSize` changes.
+//
+//***
+func GetFilterChanges(id string) (FilterChanges, error) {
+	fm, err := filterManager()
+	if err != nil {
+		return FilterChanges{}, err
+	}
+	return fm.changes(id)
+}
+
+//#### eth_getFilterLogs
+//
+//Returns an array of all logs matching filter with given id.
+//
+//##### Parameters
+//
+//1. `QUANTITY` - The filter id.
+//
+//##### Returns
+//
+//See [eth_getLogs](#eth_getlogs)
+//
+//***
+func GetFilterLogs(id string) ([]*ctypes.RPCLog, error) {
+	fm, err := filterManager()
+	if err != nil {
+		return nil, err
+	}
+	args, err := fm.logsArgs(id)
+	if err != nil {
+		return nil, err
+	}
+	return GetLogs(args)
+}
+
+//#### eth_uninstallFilter
+//
+//Uninstalls a filter with given id. Should always be called when watch is no longer needed.
+//
+//##### Parameters
+//
+//1. `QUANTITY` - The filter id.
+//
+//##### Returns
+//
+//`Boolean` - `true` if the filter was successfully uninstalled, otherwise `false`.
+//
+//***
+func UninstallFilter(id string) (bool, error) {
+	fm, err := filterManager()
+	if err != nil {
+		return false, err
+	}
+	return fm.uninstall(id), nil
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	"github.com/DSiSc/craft/log"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultFilterTimeout is how long a filter lives without being polled.
+	DefaultFilterTimeout = 5 * time.Minute
+	// DefaultFilterBufferSize is the number of changes a filter buffers
+	// between polls, the oldest are dropped beyond it.
+	DefaultFilterBufferSize = 10000
+)
+
+var errFilterNotFound = errors.New("filter not found")
+
+type filterType int
+
+const (
+	logsFilter filterType = iota
+	blockFilter
+	pendingTxFilter
+)
+
+// filter buffers the changes of a polling filter.
+type filter struct {
+	typ      filterType
+	args     ctypes.FilterArgs // of logs filters
+	crit     *FilterCriteria   // addresses and topics of logs filters
+	lastPoll time.Time
+	hashes   []cmn.Hash
+	logs     []*ctypes.RPCLog
+}
+
+// FilterManager installs polling filters and buffers the blocks,
+// transactions and logs of the event center for them until they are
+// polled. Filters that aren't polled for the timeout are uninstalled.
+type FilterManager struct {
+	eventCenter crafttypes.EventCenter
+	timeout     time.Duration
+	bufferSize  int
+	now         func() time.Time
+
+	mtx         sync.Mutex
+	filters     map[string]*filter
+	subscribers map[crafttypes.EventType]crafttypes.Subscriber
+}
+
+// NewFilterManager returns a FilterManager fed by eventCenter.
+func NewFilterManager(eventCenter crafttypes.EventCenter, options ...func(*FilterManager)) *FilterManager {
+	fm := &FilterManager{
+		eventCenter: eventCenter,
+		timeout:     DefaultFilterTimeout,
+		bufferSize:  DefaultFilterBufferSize,
+		now:         time.Now,
+		filters:     make(map[string]*filter),
+		subscribers: make(map[crafttypes.EventType]crafttypes.Subscriber),
+	}
+	for _, option := range options {
+		option(fm)
+	}
+	return fm
+}
+
+// FilterTimeout sets how long filters live without being polled.
+func FilterTimeout(timeout time.Duration) func(*FilterManager) {
+	return func(fm *FilterManager) {
+		fm.timeout = timeout
+	}
+}
+
+// FilterBufferSize sets the number of changes a filter buffers.
+func FilterBufferSize(size int) func(*FilterManager) {
+	return func(fm *FilterManager) {
+		fm.bufferSize = size
+	}
+}
+
+// Start subscribes to the events of the event center.
+func (fm *FilterManager) Start() {
+	blocks := fm.eventCenter.Subscribe(crafttypes.EventBlockCommitted, func(v interface{}) {
+		if block, ok := v.(*crafttypes.Block); ok {
+			fm.onBlock(block)
+		}
+	})
+	txs := fm.eventCenter.Subscribe(crafttypes.EventAddTxToTxPool, func(v interface{}) {
+		if tx, ok := v.(*crafttypes.Transaction); ok {
+			fm.onTx(tx)
+		}
+	})
+	fm.mtx.Lock()
+	fm.subscribers[crafttypes.EventBlockCommitted] = blocks
+	fm.subscribers[crafttypes.EventAddTxToTxPool] = txs
+	fm.mtx.Unlock()
+}
+
+// Stop unsubscribes from the event center and uninstalls all filters.
+func (fm *FilterManager) Stop() {
+	fm.mtx.Lock()
+	subscribers := fm.subscribers
+	fm.subscribers = make(map[crafttypes.EventType]crafttypes.Subscriber)
+	fm.filters = make(map[string]*filter)
+	fm.mtx.Unlock()
+	// not holding fm.mtx, events may be delivered until unsubscribed
+	for eventType, subscriber := range subscribers {
+		if err := fm.eventCenter.UnSubscribe(eventType, subscriber); err != nil {
+			log.Warn("Failed to unsubscribe filters from event %v, as: %v", eventType, err)
+		}
+	}
+}
+
+// install adds a filter and returns its ID.
+func (fm *FilterManager) install(f *filter) string {
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+	fm.expire()
+	id := "0x" + cmn.NewID()
+	f.lastPoll = fm.now()
+	fm.filters[id] = f
+	return id
+}
+
+// uninstall removes the filter with id, it returns false if there is none.
+func (fm *FilterManager) uninstall(id string) bool {
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+	fm.expire()
+	_, ok := fm.filters[id]
+	delete(fm.filters, id)
+	return ok
+}
+
+// changes returns and clears the changes buffered by the filter with id.
+func (fm *FilterManager) changes(id string) (FilterChanges, error) {
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+	fm.expire()
+	f, ok := fm.filters[id]
+	if !ok {
+		return FilterChanges{}, errFilterNotFound
+	}
+	f.lastPoll = fm.now()
+	if f.typ == logsFilter {
+		changes := FilterChanges{logs: f.logs}
+		f.logs = nil
+		return changes, nil
+	}
+	changes := FilterChanges{hashes: f.hashes}
+	f.hashes = nil
+	return changes, nil
+}
+
+// logsArgs returns the criteria of the logs filter with id.
+func (fm *FilterManager) logsArgs(id string) (ctypes.FilterArgs, error) {
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+	fm.expire()
+	f, ok := fm.filters[id]
+	if !ok || f.typ != logsFilter {
+		return ctypes.FilterArgs{}, errFilterNotFound
+	}
+	f.lastPoll = fm.now()
+	return f.args, nil
+}
+
+// expire uninstalls the filters that weren't polled for the timeout.
+// fm.mtx must be held.
+func (fm *FilterManager) expire() {
+	now := fm.now()
+	for id, f := range fm.filters {
+		if now.Sub(f.lastPoll) > fm.timeout {
+			delete(fm.filters, id)
+		}
+	}
+}
+
+func (fm *FilterManager) onBlock(block *crafttypes.Block) {
+	hash := apitypes.HeaderHash(block)
+	fm.mtx.Lock()
+	fm.expire()
+	var wantLogs bool
+	for _, f := range fm.filters {
+		switch f.typ {
+		case blockFilter:
+			f.hashes = fm.appendHash(f.hashes, cmn.Hash(hash))
+		case logsFilter:
+			wantLogs = true
+		}
+	}
+	fm.mtx.Unlock()
+	if !wantLogs {
+		return
+	}
+
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		log.Warn("Failed to get latest blockchain, as: %v ", err)
+		return
+	}
+	receipts := bc.GetReceiptByBlockHash(hash)
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+	for _, f := range fm.filters {
+		if f.typ != logsFilter || !includesHeight(f.args, block.Header.Height) {
+			continue
+		}
+		f.logs = append(f.logs, blockLogs(block, receipts, f.crit)...)
+		if len(f.logs) > fm.bufferSize {
+			f.logs = f.logs[len(f.logs)-fm.bufferSize:]
+		}
+	}
+}
+
+func (fm *FilterManager) onTx(tx *crafttypes.Transaction) {
+	hash := cmn.Hash(apitypes.TxHash(tx))
+	fm.mtx.Lock()
+	defer fm.mtx.Unlock()
+	fm.expire()
+	for _, f := range fm.filters {
+		if f.typ == pendingTxFilter {
+			f.hashes = fm.appendHash(f.hashes, hash)
+		}
+	}
+}
+
+// appendHash appends hash to hashes, dropping the oldest beyond the buffer
+// size.
+func (fm *FilterManager) appendHash(hashes []cmn.Hash, hash cmn.Hash) []cmn.Hash {
+	hashes = append(hashes, hash)
+	if len(hashes) > fm.bufferSize {
+		hashes = hashes[len(hashes)-fm.bufferSize:]
+	}
+	return hashes
+}
+
+// includesHeight tells whether the block at height is in the range of args,
+// where tags other than earliest and missing bounds are open.
+func includesHeight(args ctypes.FilterArgs, height uint64) bool {
+	bounded := func(bn *apitypes.BlockNumber) bool {
+		return bn != nil && bn.Int64() >= 0
+	}
+	if bounded(args.FromBlock) && height < args.FromBlock.Touint64() {
+		return false
+	}
+	if bounded(args.ToBlock) && height > args.ToBlock.Touint64() {
+		return false
+	}
+	return true
+}
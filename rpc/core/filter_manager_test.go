@@ -0,0 +1,176 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	"github.com/DSiSc/craft/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useFilterManager installs a FilterManager with a fake clock for the test.
+func useFilterManager(options ...func(*FilterManager)) (*FilterManager, *time.Time) {
+	now := time.Unix(1000, 0)
+	fm := NewFilterManager(newTestEvent(), options...)
+	fm.now = func() time.Time { return now }
+	fm.Start()
+	SetFilterManager(fm)
+	return fm, &now
+}
+
+func mockLogsBlock(height uint64) *types.Block {
+	return &types.Block{HeaderHash: types.Hash{byte(height + 1)}, Header: &types.Header{Height: height}}
+}
+
+func TestFilterManagerStartStop(t *testing.T) {
+	event := newTestEvent().(*testEvent)
+	fm := NewFilterManager(event)
+	fm.Start()
+	assert.Len(t, event.Subscribers[types.EventBlockCommitted], 1)
+	assert.Len(t, event.Subscribers[types.EventAddTxToTxPool], 1)
+	fm.Stop()
+	assert.Empty(t, event.Subscribers[types.EventBlockCommitted])
+	assert.Empty(t, event.Subscribers[types.EventAddTxToTxPool])
+}
+
+func TestFiltersNotEnabled(t *testing.T) {
+	SetFilterManager(nil)
+	_, err := NewBlockFilter()
+	assert.Error(t, err)
+	_, err = GetFilterChanges("0x1")
+	assert.Error(t, err)
+}
+
+func TestBlockAndPendingTransactionFilters(t *testing.T) {
+	fm, _ := useFilterManager()
+	defer SetFilterManager(nil)
+
+	blocks, err := NewBlockFilter()
+	require.NoError(t, err)
+	txs, err := NewPendingTransactionFilter()
+	require.NoError(t, err)
+	assert.NotEqual(t, blocks, txs)
+
+	fm.onBlock(mockLogsBlock(1))
+	fm.onBlock(mockLogsBlock(2))
+	tx := mockTx()
+	fm.onTx(tx)
+
+	changes, err := GetFilterChanges(blocks)
+	require.NoError(t, err)
+	assert.Equal(t, []cmn.Hash{{0x02}, {0x03}}, changes.hashes)
+	changes, err = GetFilterChanges(txs)
+	require.NoError(t, err)
+	assert.Equal(t, []cmn.Hash{cmn.Hash(apitypes.TxHash(tx))}, changes.hashes)
+
+	// the changes are cleared by polling
+	changes, err = GetFilterChanges(blocks)
+	require.NoError(t, err)
+	assert.Empty(t, changes.hashes)
+	bz, err := changes.MarshalJSON()
+	require.NoError(t, err)
+	assert.Equal(t, "[]", string(bz))
+
+	_, err = GetFilterLogs(blocks)
+	assert.Error(t, err)
+
+	ok, err := UninstallFilter(blocks)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = UninstallFilter(blocks)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	_, err = GetFilterChanges(blocks)
+	assert.Error(t, err)
+}
+
+func TestLogsFilter(t *testing.T) {
+	mockLogsChain(9)
+	defer unpatchLogsChain()
+	fm, _ := useFilterManager()
+	defer SetFilterManager(nil)
+
+	_, err := NewFilter(ctypes.FilterArgs{BlockHash: &cmn.Hash{}})
+	assert.Error(t, err)
+
+	from, to := apitypes.BlockNumber(2), apitypes.BlockNumber(3)
+	id, err := NewFilter(ctypes.FilterArgs{
+		FromBlock: &from,
+		ToBlock:   &to,
+		Addresses: []apitypes.Address{apitypes.Address(logsContract)},
+	})
+	require.NoError(t, err)
+	all, err := NewFilter(ctypes.FilterArgs{})
+	require.NoError(t, err)
+
+	for height := uint64(1); height <= 4; height++ {
+		fm.onBlock(mockLogsBlock(height))
+	}
+	changes, err := GetFilterChanges(id)
+	require.NoError(t, err)
+	require.Len(t, changes.logs, 2)
+	assert.Equal(t, cmn.Uint64(2), changes.logs[0].BlockNumber)
+	assert.Equal(t, cmn.Uint64(3), changes.logs[1].BlockNumber)
+	assert.Equal(t, cmn.Hash{0x04}, changes.logs[1].BlockHash)
+	assert.Equal(t, cmn.Hash{0xbb}, changes.logs[1].TransactionHash)
+	changes, err = GetFilterChanges(all)
+	require.NoError(t, err)
+	assert.Len(t, changes.logs, 8)
+
+	// eth_getFilterLogs queries the whole range again
+	logs, err := GetFilterLogs(id)
+	require.NoError(t, err)
+	assert.Len(t, logs, 2)
+}
+
+func TestFilterBufferSize(t *testing.T) {
+	fm, _ := useFilterManager(FilterBufferSize(2))
+	defer SetFilterManager(nil)
+
+	id, err := NewBlockFilter()
+	require.NoError(t, err)
+	for height := uint64(1); height <= 3; height++ {
+		fm.onBlock(mockLogsBlock(height))
+	}
+	changes, err := GetFilterChanges(id)
+	require.NoError(t, err)
+	assert.Equal(t, []cmn.Hash{{0x03}, {0x04}}, changes.hashes)
+}
+
+func TestFilterTimeout(t *testing.T) {
+	_, now := useFilterManager(FilterTimeout(time.Minute))
+	defer SetFilterManager(nil)
+
+	polled, err := NewBlockFilter()
+	require.NoError(t, err)
+	idle, err := NewBlockFilter()
+	require.NoError(t, err)
+
+	*now = now.Add(40 * time.Second)
+	_, err = GetFilterChanges(polled)
+	require.NoError(t, err)
+	*now = now.Add(40 * time.Second)
+	_, err = GetFilterChanges(polled)
+	assert.NoError(t, err)
+	_, err = GetFilterChanges(idle)
+	assert.Equal(t, errFilterNotFound, err)
+}
+
+func TestSetFilterManagerWhileServing(t *testing.T) {
+	defer SetFilterManager(nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			SetFilterManager(NewFilterManager(newTestEvent()))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		NewBlockFilter()
+	}
+	<-done
+}
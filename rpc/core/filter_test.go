@@ -0,0 +1,179 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	logsContract = types.Address{0x01}
+	logsTopic    = types.Hash{0x02}
+)
+
+// mockLogsChain patches the repository with a chain of blocks 0 to head,
+// each with a transaction without logs, then one with a log of logsContract
+// and one of another address.
+func mockLogsChain(head uint64) {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlockHeight", func(*repository.Repository) uint64 {
+		return head
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		return &types.Block{HeaderHash: types.Hash{byte(height + 1)}, Header: &types.Header{Height: height}}, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHash", func(_ *repository.Repository, hash types.Hash) (*types.Block, error) {
+		return &types.Block{HeaderHash: hash, Header: &types.Header{Height: uint64(hash[0] - 1)}}, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash", func(_ *repository.Repository, hash types.Hash) []*types.Receipt {
+		height := uint64(hash[0] - 1)
+		return []*types.Receipt{{TxHash: types.Hash{0xaa}}, {TxHash: types.Hash{0xbb}, Logs: []*types.Log{
+			{Address: logsContract, Topics: []types.Hash{logsTopic}, BlockNumber: height, BlockHash: hash},
+			{Address: types.Address{0x03}, BlockNumber: height, BlockHash: hash},
+		}}}
+	})
+}
+
+func unpatchLogsChain() {
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash")
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHash")
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHeight")
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlockHeight")
+	monkey.Unpatch(repository.NewLatestStateRepository)
+}
+
+func TestFilterArgsUnmarshalJSON(t *testing.T) {
+	var args ctypes.FilterArgs
+	err := json.Unmarshal([]byte(`{
+		"fromBlock": "0x1",
+		"toBlock": "latest",
+		"address": "0x0100000000000000000000000000000000000000",
+		"topics": [null, "0x0200000000000000000000000000000000000000000000000000000000000000", []]
+	}`), &args)
+	require.NoError(t, err)
+	assert.Equal(t, apitypes.BlockNumber(1), *args.FromBlock)
+	assert.Equal(t, apitypes.LatestBlockNumber, *args.ToBlock)
+	assert.Nil(t, args.BlockHash)
+	assert.Equal(t, []apitypes.Address{apitypes.Address(logsContract)}, args.Addresses)
+	assert.Equal(t, [][]cmn.Hash{nil, {cmn.Hash(logsTopic)}, {}}, args.Topics)
+
+	err = json.Unmarshal([]byte(`{"address": ["0x0100000000000000000000000000000000000000", "0x0300000000000000000000000000000000000000"]}`), &args)
+	require.NoError(t, err)
+	assert.Len(t, args.Addresses, 2)
+	assert.Nil(t, args.FromBlock)
+}
+
+func TestNewFilterCriteria(t *testing.T) {
+	crit, err := newFilterCriteria(ctypes.FilterArgs{}, 7)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), crit.FromBlock.Uint64())
+	assert.Equal(t, uint64(7), crit.ToBlock.Uint64())
+
+	earliest, pending := apitypes.EarliestBlockNumber, apitypes.PendingBlockNumber
+	crit, err = newFilterCriteria(ctypes.FilterArgs{FromBlock: &earliest, ToBlock: &pending}, 7)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), crit.FromBlock.Uint64())
+	assert.Equal(t, uint64(7), crit.ToBlock.Uint64())
+
+	from := apitypes.BlockNumber(5)
+	_, err = newFilterCriteria(ctypes.FilterArgs{FromBlock: &from}, 3)
+	assert.Error(t, err)
+
+	hash := cmn.Hash{0x01}
+	_, err = newFilterCriteria(ctypes.FilterArgs{BlockHash: &hash, FromBlock: &from}, 7)
+	assert.Error(t, err)
+	crit, err = newFilterCriteria(ctypes.FilterArgs{BlockHash: &hash}, 7)
+	require.NoError(t, err)
+	assert.Equal(t, types.Hash{0x01}, *crit.BlockHash)
+	assert.Nil(t, crit.FromBlock)
+}
+
+func TestGetLogs(t *testing.T) {
+	mockLogsChain(9)
+	defer unpatchLogsChain()
+
+	from, to := apitypes.BlockNumber(2), apitypes.BlockNumber(4)
+	logs, err := GetLogs(ctypes.FilterArgs{FromBlock: &from, ToBlock: &to})
+	require.NoError(t, err)
+	assert.Len(t, logs, 6)
+
+	logs, err = GetLogs(ctypes.FilterArgs{
+		FromBlock: &from,
+		ToBlock:   &to,
+		Addresses: []apitypes.Address{apitypes.Address(logsContract)},
+		Topics:    [][]cmn.Hash{{cmn.Hash(logsTopic)}},
+	})
+	require.NoError(t, err)
+	require.Len(t, logs, 3)
+	for i, log := range logs {
+		assert.Equal(t, apitypes.Address(logsContract), log.Address)
+		assert.Equal(t, cmn.Uint64(2+i), log.BlockNumber)
+		assert.Equal(t, cmn.Hash{byte(3 + i)}, log.BlockHash)
+		assert.Equal(t, cmn.Hash{0xbb}, log.TransactionHash)
+		assert.Equal(t, cmn.Uint64(1), log.TransactionIndex)
+		assert.Equal(t, []cmn.Hash{cmn.Hash(logsTopic)}, log.Topics)
+	}
+
+	// the indexes are those in the block and the transaction, even if the
+	// logs before don't match
+	logs, err = GetLogs(ctypes.FilterArgs{FromBlock: &from, ToBlock: &from, Addresses: []apitypes.Address{{0x03}}})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, cmn.Uint64(1), logs[0].LogIndex)
+	assert.Equal(t, cmn.Uint64(1), logs[0].TransactionLogIndex)
+	assert.Equal(t, []cmn.Hash{}, logs[0].Topics)
+
+	hash := cmn.Hash{0x04}
+	logs, err = GetLogs(ctypes.FilterArgs{BlockHash: &hash, Addresses: []apitypes.Address{apitypes.Address(logsContract)}})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, cmn.Uint64(3), logs[0].BlockNumber)
+
+	// latest by default
+	logs, err = GetLogs(ctypes.FilterArgs{})
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	assert.Equal(t, cmn.Uint64(9), logs[0].BlockNumber)
+
+	// no matches is an empty list
+	logs, err = GetLogs(ctypes.FilterArgs{Topics: [][]cmn.Hash{{cmn.Hash{0xff}}}})
+	require.NoError(t, err)
+	assert.NotNil(t, logs)
+	assert.Empty(t, logs)
+}
+
+func TestGetLogsLimits(t *testing.T) {
+	mockLogsChain(9)
+	defer unpatchLogsChain()
+	defer func(blockRange uint64, results int) {
+		MaxLogsBlockRange, MaxLogsResults = blockRange, results
+	}(MaxLogsBlockRange, MaxLogsResults)
+
+	earliest := apitypes.EarliestBlockNumber
+	MaxLogsBlockRange = 5
+	_, err := GetLogs(ctypes.FilterArgs{FromBlock: &earliest})
+	assert.Error(t, err)
+
+	MaxLogsBlockRange, MaxLogsResults = 10, 5
+	_, err = GetLogs(ctypes.FilterArgs{FromBlock: &earliest})
+	assert.Error(t, err)
+	logs, err := GetLogs(ctypes.FilterArgs{FromBlock: &earliest, Addresses: []apitypes.Address{apitypes.Address(logsContract)}})
+	assert.Error(t, err)
+	assert.Nil(t, logs)
+
+	MaxLogsResults = 10
+	logs, err = GetLogs(ctypes.FilterArgs{FromBlock: &earliest, Addresses: []apitypes.Address{apitypes.Address(logsContract)}})
+	require.NoError(t, err)
+	assert.Len(t, logs, 10)
+}
@@ -0,0 +1,252 @@
+package core
+
+import (
+	"math/big"
+	"sort"
+	"sync"
+
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	"github.com/DSiSc/craft/log"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+)
+
+const (
+	// DefaultGasPriceBlocks is the number of recent blocks the gas price is
+	// sampled from.
+	DefaultGasPriceBlocks = 20
+	// DefaultGasPricePercentile is the percentile of the sampled prices
+	// suggested.
+	DefaultGasPricePercentile = 60
+	// maxPendingPrices is the number of pending transactions sampled.
+	maxPendingPrices = 1000
+)
+
+// pendingPrice is the price of a transaction added to the pool, seen at the
+// height of the latest block then.
+type pendingPrice struct {
+	price  *big.Int
+	height uint64
+}
+
+// GasPriceOracle suggests gas prices from the prices of the transactions of
+// the recent blocks and of the pool. The suggestion is cached until the next
+// block is committed.
+type GasPriceOracle struct {
+	eventCenter crafttypes.EventCenter
+	blocks      uint64
+	percentile  int
+	floor       *big.Int
+	ceiling     *big.Int // none if nil
+
+	mtx         sync.Mutex
+	price       *big.Int // suggested at height, none if nil
+	height      uint64
+	pending     map[crafttypes.Hash]pendingPrice
+	subscribers map[crafttypes.EventType]crafttypes.Subscriber
+}
+
+// NewGasPriceOracle returns a GasPriceOracle fed by eventCenter.
+func NewGasPriceOracle(eventCenter crafttypes.EventCenter, options ...func(*GasPriceOracle)) *GasPriceOracle {
+	o := &GasPriceOracle{
+		eventCenter: eventCenter,
+		blocks:      DefaultGasPriceBlocks,
+		percentile:  DefaultGasPricePercentile,
+		floor:       new(big.Int).SetUint64(apitypes.DefaultGasPrice),
+		pending:     make(map[crafttypes.Hash]pendingPrice),
+		subscribers: make(map[crafttypes.EventType]crafttypes.Subscriber),
+	}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// GasPriceBlocks sets the number of recent blocks prices are sampled from.
+func GasPriceBlocks(blocks uint64) func(*GasPriceOracle) {
+	return func(o *GasPriceOracle) {
+		o.blocks = blocks
+	}
+}
+
+// GasPricePercentile sets the percentile of the sampled prices suggested,
+// from 0 to 100.
+func GasPricePercentile(percentile int) func(*GasPriceOracle) {
+	return func(o *GasPriceOracle) {
+		o.percentile = percentile
+	}
+}
+
+// GasPriceBounds sets the least and the most price suggested, ceiling may be
+// nil for none.
+func GasPriceBounds(floor, ceiling *big.Int) func(*GasPriceOracle) {
+	return func(o *GasPriceOracle) {
+		o.floor, o.ceiling = floor, ceiling
+	}
+}
+
+// Start subscribes to the events of the event center.
+func (o *GasPriceOracle) Start() {
+	blocks := o.eventCenter.Subscribe(crafttypes.EventBlockCommitted, func(v interface{}) {
+		if block, ok := v.(*crafttypes.Block); ok {
+			o.onBlock(block)
+		}
+	})
+	txs := o.eventCenter.Subscribe(crafttypes.EventAddTxToTxPool, func(v interface{}) {
+		if tx, ok := v.(*crafttypes.Transaction); ok {
+			o.onTx(tx)
+		}
+	})
+	o.mtx.Lock()
+	o.subscribers[crafttypes.EventBlockCommitted] = blocks
+	o.subscribers[crafttypes.EventAddTxToTxPool] = txs
+	o.mtx.Unlock()
+}
+
+// Stop unsubscribes from the event center.
+func (o *GasPriceOracle) Stop() {
+	o.mtx.Lock()
+	subscribers := o.subscribers
+	o.subscribers = make(map[crafttypes.EventType]crafttypes.Subscriber)
+	o.mtx.Unlock()
+	for eventType, subscriber := range subscribers {
+		if err := o.eventCenter.UnSubscribe(eventType, subscriber); err != nil {
+			log.Warn("Failed to unsubscribe gas price oracle from event %v, as: %v", eventType, err)
+		}
+	}
+}
+
+// Price returns the suggested gas price.
+func (o *GasPriceOracle) Price() (*big.Int, error) {
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return nil, err
+	}
+	head := bc.GetCurrentBlockHeight()
+	o.mtx.Lock()
+	var price *big.Int
+	if o.price != nil && o.height == head {
+		price = new(big.Int).Set(o.price)
+	}
+	o.mtx.Unlock()
+	if price != nil {
+		return price, nil
+	}
+	return o.update(bc, head)
+}
+
+// update samples the prices up to the block at height head and caches the
+// suggestion.
+func (o *GasPriceOracle) update(bc *repository.Repository, head uint64) (*big.Int, error) {
+	var prices []*big.Int
+	for height := head; height+o.blocks > head; height-- {
+		block, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		for _, tx := range block.Transactions {
+			if tx.Data.Price != nil {
+				prices = append(prices, tx.Data.Price)
+			}
+		}
+		if height == 0 {
+			break
+		}
+	}
+
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	for _, p := range o.pending {
+		prices = append(prices, p.price)
+	}
+	price := o.suggest(prices)
+	if o.price == nil || head >= o.height {
+		o.price, o.height = price, head
+	}
+	return new(big.Int).Set(price), nil
+}
+
+// suggest returns the percentile of prices within the bounds, the floor if
+// there are no prices.
+func (o *GasPriceOracle) suggest(prices []*big.Int) *big.Int {
+	price := o.floor
+	if len(prices) > 0 {
+		sort.Slice(prices, func(i, j int) bool { return prices[i].Cmp(prices[j]) < 0 })
+		price = prices[(len(prices)-1)*o.percentile/100]
+	}
+	if price.Cmp(o.floor) < 0 {
+		price = o.floor
+	}
+	if o.ceiling != nil && price.Cmp(o.ceiling) > 0 {
+		price = o.ceiling
+	}
+	return new(big.Int).Set(price)
+}
+
+func (o *GasPriceOracle) onBlock(block *crafttypes.Block) {
+	height := block.Header.Height
+	o.mtx.Lock()
+	for _, tx := range block.Transactions {
+		delete(o.pending, apitypes.TxHash(tx))
+	}
+	// transactions still pending after as many blocks as sampled are stale
+	for hash, p := range o.pending {
+		if p.height+o.blocks <= height {
+			delete(o.pending, hash)
+		}
+	}
+	o.mtx.Unlock()
+
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		log.Warn("Failed to get latest blockchain, as: %v ", err)
+		return
+	}
+	if _, err := o.update(bc, height); err != nil {
+		log.Warn("Failed to update the gas price, as: %v", err)
+	}
+}
+
+func (o *GasPriceOracle) onTx(tx *crafttypes.Transaction) {
+	if tx.Data.Price == nil {
+		return
+	}
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	if len(o.pending) >= maxPendingPrices {
+		return
+	}
+	o.pending[apitypes.TxHash(tx)] = pendingPrice{new(big.Int).Set(tx.Data.Price), o.height}
+}
+
+var (
+	gasPriceOracleMtx sync.RWMutex
+	gasPriceOracle    *GasPriceOracle
+)
+
+// SetGasPriceOracle sets the oracle suggesting gas prices, stopping the
+// previous one. Without one, the default gas price is suggested.
+func SetGasPriceOracle(o *GasPriceOracle) {
+	gasPriceOracleMtx.Lock()
+	old := gasPriceOracle
+	gasPriceOracle = o
+	gasPriceOracleMtx.Unlock()
+	if old != nil {
+		old.Stop()
+	}
+}
+
+// suggestGasPrice returns the gas price of the oracle, or the default one.
+func suggestGasPrice() *big.Int {
+	gasPriceOracleMtx.RLock()
+	o := gasPriceOracle
+	gasPriceOracleMtx.RUnlock()
+	if o != nil {
+		price, err := o.Price()
+		if err == nil {
+			return price
+		}
+		log.Warn("Failed to suggest a gas price, as: %v", err)
+	}
+	return new(big.Int).SetUint64(apitypes.DefaultGasPrice)
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func priceTx(nonce uint64, price int64) *types.Transaction {
+	return apitypes.NewTransaction(nonce, &to, nil, 21000, big.NewInt(price), nil, from)
+}
+
+// mockPricesChain patches the repository with a chain of blocks 0 to *head,
+// where prices returns the prices of the transactions of a block.
+func mockPricesChain(head *uint64, prices func(height uint64) []int64) {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlockHeight", func(*repository.Repository) uint64 {
+		return *head
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		block := &types.Block{Header: &types.Header{Height: height}}
+		for i, price := range prices(height) {
+			block.Transactions = append(block.Transactions, priceTx(height*10+uint64(i), price))
+		}
+		return block, nil
+	})
+}
+
+func unpatchPricesChain() {
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHeight")
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlockHeight")
+	monkey.Unpatch(repository.NewLatestStateRepository)
+}
+
+func TestGasPriceOracle(t *testing.T) {
+	head := uint64(4)
+	offset := int64(0)
+	mockPricesChain(&head, func(height uint64) []int64 {
+		p := int64(height+1)*10 + offset
+		return []int64{p, p + 5}
+	})
+	defer unpatchPricesChain()
+
+	event := newTestEvent().(*testEvent)
+	o := NewGasPriceOracle(event, GasPriceBlocks(3), GasPricePercentile(50))
+	o.Start()
+	SetGasPriceOracle(o)
+	defer SetGasPriceOracle(nil)
+	assert.Len(t, event.Subscribers[types.EventBlockCommitted], 1)
+
+	// 30, 35, 40, 45, 50 and 55 of blocks 2 to 4
+	price, err := o.Price()
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(40), price)
+	gasPrice, err := GasPrice()
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(40), (*big.Int)(gasPrice))
+
+	// cached until the next block
+	offset = 100
+	o.onTx(priceTx(100, 1000))
+	o.onTx(priceTx(101, 1000))
+	price, err = o.Price()
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(40), price)
+
+	// 140, 145, 150, 155, 160, 165 and the pending 1000s
+	head = 5
+	o.onBlock(&types.Block{Header: &types.Header{Height: 5}, Transactions: []*types.Transaction{priceTx(100, 1000)}})
+	price, err = o.Price()
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(155), price)
+
+	o.Stop()
+	assert.Empty(t, event.Subscribers[types.EventBlockCommitted])
+	assert.Empty(t, event.Subscribers[types.EventAddTxToTxPool])
+}
+
+func TestGasPriceOracleBounds(t *testing.T) {
+	head := uint64(2)
+	var prices []int64
+	mockPricesChain(&head, func(uint64) []int64 { return prices })
+	defer unpatchPricesChain()
+
+	o := NewGasPriceOracle(newTestEvent(), GasPriceBounds(big.NewInt(20), big.NewInt(50)))
+	price, err := o.Price()
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(20), price, "the floor without transactions")
+
+	for i, tt := range []struct {
+		prices []int64
+		want   int64
+	}{
+		{[]int64{1, 2, 3}, 20},
+		{[]int64{100, 200}, 50},
+		{[]int64{10, 30, 40, 60}, 40},
+	} {
+		prices = tt.prices
+		head++
+		price, err := o.Price()
+		require.NoError(t, err)
+		assert.Equal(t, big.NewInt(tt.want), price, "#%d", i)
+	}
+}
+
+func TestSuggestGasPrice(t *testing.T) {
+	SetGasPriceOracle(nil)
+	assert.Equal(t, new(big.Int).SetUint64(apitypes.DefaultGasPrice), suggestGasPrice())
+}
+
+func TestSetGasPriceOracleWhileServing(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			SetGasPriceOracle(nil)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		suggestGasPrice()
+	}
+	<-done
+}
@@ -0,0 +1,266 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	ltypes "github.com/DSiSc/apigateway/rpc/lib/types"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/txpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of testdata/golden")
+
+var (
+	goldenBlockHash = crafttypes.Hash(cmn.HexToHash("0x1d59ff54b1eb26b013ce3cb5fc9dab3705b415a67127a003c3e61eb445bb8df2"))
+	goldenTxHash    = "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b"
+	goldenFilterID  = "0x1d0c2f3e5a9c1b7b3a0e8c4e55d39e6c"
+)
+
+// goldenTx returns a transaction signed for chain 1, creating a contract if
+// creation.
+func goldenTx(creation bool) *crafttypes.Transaction {
+	from := crafttypes.Address(apitypes.HexToAddress("0xa7d9ddbe1f17865597fbd27ec712455208b6b76d"))
+	var to *crafttypes.Address
+	if !creation {
+		recipient := crafttypes.Address(apitypes.HexToAddress("0xf02c1c8e6114b1dbe8937a39260b5b0a374432bb"))
+		to = &recipient
+	}
+	r, _ := new(big.Int).SetString("1b5e176d927f8e9ab405058b2d2457392da3e20f328b16ddabcebc33eaac5fea", 16)
+	s, _ := new(big.Int).SetString("4ba69724e8f69de52f0125ad8b3c5c2cef33019bac3249e2c0a2192766d1721c", 16)
+	tx := &crafttypes.Transaction{Data: crafttypes.TxData{
+		AccountNonce: 0x15,
+		Price:        big.NewInt(20000000000),
+		GasLimit:     50000,
+		Recipient:    to,
+		From:         &from,
+		Amount:       big.NewInt(4290000000000000),
+		Payload:      []byte("hello!"),
+		V:            big.NewInt(37),
+		R:            r,
+		S:            s,
+	}}
+	tx.Hash.Store(crafttypes.Hash(cmn.HexToHash(goldenTxHash)))
+	return tx
+}
+
+// mockGoldenTx makes tx the 0x41st transaction of block 0x5daf3b, or pending
+// if not mined.
+func mockGoldenTx(tx *crafttypes.Transaction, mined bool) {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetTransactionByHash", func(*repository.Repository, crafttypes.Hash) (*crafttypes.Transaction, crafttypes.Hash, uint64, uint64, error) {
+		if !mined {
+			return nil, crafttypes.Hash{}, 0, 0, nil
+		}
+		return tx, goldenBlockHash, 0x5daf3b, 0x41, nil
+	})
+	monkey.Patch(txpool.GetTxByHash, func(crafttypes.Hash) *crafttypes.Transaction {
+		return tx
+	})
+}
+
+// goldenBlock returns block 0x5daf3b, whose only transaction is that of
+// goldenTx.
+func goldenBlock() *crafttypes.Block {
+	return &crafttypes.Block{
+		HeaderHash: goldenBlockHash,
+		Header: &crafttypes.Header{
+			PrevBlockHash: crafttypes.Hash(cmn.HexToHash("0x9b83c12c69edb74f6c8dd5d052765c1adf940e320bd1291696e6fa07829eee71")),
+			StateRoot:     crafttypes.Hash(cmn.HexToHash("0xddc8b0234c2e0cad087c8b389aa7ef01f7d79b2570bccb77ce48648aa61c904d")),
+			TxRoot:        crafttypes.Hash(cmn.HexToHash("0x3f2a5b7e3d2e1c1d6a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f9a0b")),
+			ReceiptsRoot:  crafttypes.Hash(cmn.HexToHash("0x5b2a9c1d8e7f60514233241506f7e8d9cabbccddeeff00112233445566778899")),
+			Height:        0x5daf3b,
+			Timestamp:     0x56bfb41a,
+			MixDigest:     crafttypes.Hash(cmn.HexToHash("0x3d1fdd16f15aeab72e7db1013b9f034ee33641d92f71c0736beab4e67d34c7a7")),
+			CoinBase:      crafttypes.Address(apitypes.HexToAddress("0x4bb96091ee9d802ed039c4d1a5f6216f90f81b01")),
+			GasLimit:      0x1c9c380,
+		},
+		Transactions: []*crafttypes.Transaction{goldenTx(false)},
+	}
+}
+
+// mockGoldenBlock makes goldenBlock the block of any height and hash. Its size
+// is fixed, that of block_test being checked against the RLP encoding.
+func mockGoldenBlock() {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHeight", func(*repository.Repository, uint64) (*crafttypes.Block, error) {
+		return goldenBlock(), nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHash", func(*repository.Repository, crafttypes.Hash) (*crafttypes.Block, error) {
+		return goldenBlock(), nil
+	})
+	monkey.Patch(apitypes.BlockSize, func(*crafttypes.Block) uint64 {
+		return 0x2d5
+	})
+}
+
+// goldenReceipt returns the receipt of the transaction of goldenTx, with two
+// logs.
+func goldenReceipt() *crafttypes.Receipt {
+	receipt := &crafttypes.Receipt{
+		Status:            1,
+		CumulativeGasUsed: 0x33bc,
+		GasUsed:           0x4dc,
+		Logs: []*crafttypes.Log{
+			{
+				Address: crafttypes.Address{0x01},
+				Topics:  []crafttypes.Hash{{0x0a}, {0x0b}},
+				Data:    []byte{0x01, 0x02},
+			},
+			{Address: crafttypes.Address{0x02}},
+		},
+	}
+	receipt.Bloom[0] = 0x80
+	receipt.Bloom[len(receipt.Bloom)-1] = 0x01
+	return receipt
+}
+
+// mockGoldenReceipt makes receipt that of the transaction mocked, whose block
+// has three logs before it.
+func mockGoldenReceipt(receipt *crafttypes.Receipt) {
+	receipt.TxHash = crafttypes.Hash(cmn.HexToHash(goldenTxHash))
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByTxHash", func(*repository.Repository, crafttypes.Hash) (*crafttypes.Receipt, crafttypes.Hash, uint64, uint64, error) {
+		return receipt, goldenBlockHash, 0x5daf3b, 0x41, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash", func(*repository.Repository, crafttypes.Hash) []*crafttypes.Receipt {
+		receipts := make([]*crafttypes.Receipt, 0x42)
+		for i := range receipts {
+			receipts[i] = &crafttypes.Receipt{}
+		}
+		receipts[0].Logs = []*crafttypes.Log{{}, {}}
+		receipts[7].Logs = []*crafttypes.Log{{}}
+		receipts[0x41] = receipt
+		return receipts
+	})
+}
+
+var goldenCases = []struct {
+	name    string
+	request string
+	mock    func()
+}{
+	{
+		"eth_getTransactionByHash",
+		`{"jsonrpc":"2.0","method":"eth_getTransactionByHash","params":["` + goldenTxHash + `"],"id":1}`,
+		func() { mockGoldenTx(goldenTx(false), true) },
+	},
+	{
+		"eth_getTransactionByHash_pending",
+		`{"jsonrpc":"2.0","method":"eth_getTransactionByHash","params":["` + goldenTxHash + `"],"id":1}`,
+		func() { mockGoldenTx(goldenTx(false), false) },
+	},
+	{
+		"eth_getTransactionReceipt",
+		`{"jsonrpc":"2.0","method":"eth_getTransactionReceipt","params":["` + goldenTxHash + `"],"id":1}`,
+		func() {
+			mockGoldenTx(goldenTx(false), true)
+			mockGoldenReceipt(goldenReceipt())
+		},
+	},
+	{
+		"eth_getTransactionReceipt_creation",
+		`{"jsonrpc":"2.0","method":"eth_getTransactionReceipt","params":["` + goldenTxHash + `"],"id":1}`,
+		func() {
+			mockGoldenTx(goldenTx(true), true)
+			mockGoldenReceipt(&crafttypes.Receipt{
+				PostState:         cmn.HexToHash("0xd5855eb08b3387c0af375e9cdb6acfc05eb8f519e419b874b6ff2ffda7ed1dff").Bytes(),
+				CumulativeGasUsed: 0x33bc,
+				GasUsed:           0x4dc,
+				ContractAddress:   crafttypes.Address(apitypes.HexToAddress("0xb60e8dd61c5d32be8058bb8eb970870f07233155")),
+			})
+		},
+	},
+	{
+		"eth_getBlockByNumber",
+		`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["0x5daf3b",false],"id":1}`,
+		func() {
+			mockGoldenBlock()
+			mockGoldenReceipt(goldenReceipt())
+		},
+	},
+	{
+		"eth_getBlockByNumber_full",
+		`{"jsonrpc":"2.0","method":"eth_getBlockByNumber","params":["0x5daf3b",true],"id":1}`,
+		func() {
+			mockGoldenBlock()
+			mockGoldenReceipt(goldenReceipt())
+		},
+	},
+	{
+		"eth_getLogs",
+		`{"jsonrpc":"2.0","method":"eth_getLogs","params":[{"blockHash":"0x1d59ff54b1eb26b013ce3cb5fc9dab3705b415a67127a003c3e61eb445bb8df2","address":["0x0100000000000000000000000000000000000000","0x0200000000000000000000000000000000000000"]}],"id":1}`,
+		func() {
+			mockGoldenBlock()
+			mockGoldenReceipt(goldenReceipt())
+		},
+	},
+	{
+		"eth_getFilterChanges",
+		`{"jsonrpc":"2.0","method":"eth_getFilterChanges","params":["` + goldenFilterID + `"],"id":1}`,
+		func() {
+			mockGoldenBlock()
+			mockGoldenReceipt(goldenReceipt())
+			// a filter of the logs of topic 0x0a, polled after goldenBlock
+			args := ctypes.FilterArgs{Topics: [][]cmn.Hash{{{0x0a}}}}
+			fm := NewFilterManager(newTestEvent())
+			fm.filters[goldenFilterID] = &filter{typ: logsFilter, args: args, crit: matchCriteria(args), lastPoll: time.Now()}
+			SetFilterManager(fm)
+			fm.onBlock(goldenBlock())
+		},
+	},
+}
+
+// TestGoldenResponses checks the responses to the requests of goldenCases
+// byte for byte against testdata/golden, rewritten with -update.
+func TestGoldenResponses(t *testing.T) {
+	defer SetFilterManager(nil)
+	mux := testMux()
+	for _, c := range goldenCases {
+		c.mock()
+		req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader(c.request))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		monkey.UnpatchAll()
+
+		var res ltypes.RPCResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res), c.name)
+		require.Nil(t, res.Error, c.name)
+		// the server indents the responses, compare them compacted
+		var got bytes.Buffer
+		require.NoError(t, json.Compact(&got, res.Result), c.name)
+		path := filepath.Join("testdata", "golden", c.name+".json")
+		if *updateGolden {
+			var indented bytes.Buffer
+			require.NoError(t, json.Indent(&indented, got.Bytes(), "", "  "), c.name)
+			indented.WriteByte('\n')
+			require.NoError(t, ioutil.WriteFile(path, indented.Bytes(), 0644), c.name)
+			continue
+		}
+		golden, err := ioutil.ReadFile(path)
+		require.NoError(t, err, c.name)
+		var want bytes.Buffer
+		require.NoError(t, json.Compact(&want, golden), c.name)
+		assert.Equal(t, want.String(), got.String(), c.name)
+	}
+}
@@ -0,0 +1,27 @@
+package core
+
+import (
+	rpcmetrics "github.com/DSiSc/apigateway/rpc/lib/metrics"
+)
+
+// Results of tx submissions.
+const (
+	txReceived = "received" // submitted by a client
+	txAccepted = "accepted" // queued for the gossip switch
+	txRejected = "rejected" // failed validation
+	txDropped  = "dropped"  // not queued, the switch unavailable or stalled
+)
+
+var txSubmissions = rpcmetrics.DefaultRegistry.NewCounterVec(
+	"apigateway_tx_submissions_total",
+	"Transactions submitted, by method and result.",
+	"method", "result",
+)
+
+func init() {
+	rpcmetrics.DefaultRegistry.NewGaugeFunc(
+		"apigateway_tx_queue_length",
+		"Transactions waiting in the queue to the gossip switch.",
+		txQueueLen,
+	)
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"sort"
+	"sync"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	"github.com/DSiSc/craft/log"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/txpool"
+)
+
+// NonceManager hands out the nonces of the transactions the gateway builds,
+// so the concurrent submissions of a sender get distinct nonces. It follows
+// the chain and the pool of the senders on each reservation and committed
+// block.
+type NonceManager struct {
+	eventCenter crafttypes.EventCenter
+
+	mtx        sync.Mutex
+	accounts   map[crafttypes.Address]*nonceAccount
+	subscriber crafttypes.Subscriber
+}
+
+// nonceAccount holds the nonces handed out for a sender.
+type nonceAccount struct {
+	next     uint64   // after the nonces handed out
+	released []uint64 // below next, handed out again first, sorted
+}
+
+// NewNonceManager returns a NonceManager resynced on the blocks committed of
+// eventCenter, which may be nil.
+func NewNonceManager(eventCenter crafttypes.EventCenter) *NonceManager {
+	return &NonceManager{
+		eventCenter: eventCenter,
+		accounts:    make(map[crafttypes.Address]*nonceAccount),
+	}
+}
+
+// Start subscribes to the committed blocks of the event center.
+func (m *NonceManager) Start() {
+	if m.eventCenter == nil {
+		return
+	}
+	subscriber := m.eventCenter.Subscribe(crafttypes.EventBlockCommitted, func(interface{}) {
+		m.onBlock()
+	})
+	m.mtx.Lock()
+	m.subscriber = subscriber
+	m.mtx.Unlock()
+}
+
+// Stop unsubscribes from the event center.
+func (m *NonceManager) Stop() {
+	m.mtx.Lock()
+	subscriber := m.subscriber
+	m.subscriber = nil
+	m.mtx.Unlock()
+	if subscriber == nil {
+		return
+	}
+	if err := m.eventCenter.UnSubscribe(crafttypes.EventBlockCommitted, subscriber); err != nil {
+		log.Warn("Failed to unsubscribe nonce manager from event %v, as: %v", crafttypes.EventBlockCommitted, err)
+	}
+}
+
+// Reserve returns a nonce of address no other reservation has. It must be
+// released if its transaction isn't submitted.
+func (m *NonceManager) Reserve(address crafttypes.Address) (uint64, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	a, err := m.sync(address)
+	if err != nil {
+		return 0, err
+	}
+	if len(a.released) > 0 {
+		nonce := a.released[0]
+		a.released = a.released[1:]
+		return nonce, nil
+	}
+	nonce := a.next
+	a.next++
+	return nonce, nil
+}
+
+// Release hands nonce of address out again, its transaction not submitted.
+func (m *NonceManager) Release(address crafttypes.Address, nonce uint64) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	a, ok := m.accounts[address]
+	if !ok || nonce >= a.next {
+		return
+	}
+	i := sort.Search(len(a.released), func(i int) bool { return a.released[i] >= nonce })
+	if i < len(a.released) && a.released[i] == nonce {
+		return
+	}
+	a.released = append(a.released, 0)
+	copy(a.released[i+1:], a.released[i:])
+	a.released[i] = nonce
+	// the released nonces at the end are handed out in turn
+	for n := len(a.released); n > 0 && a.released[n-1] == a.next-1; n-- {
+		a.next--
+		a.released = a.released[:n-1]
+	}
+}
+
+// Pending returns the nonce the next reservation of address gets, without
+// following address if it has none.
+func (m *NonceManager) Pending(address crafttypes.Address) (uint64, error) {
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return 0, err
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	base := nextNonce(bc, address)
+	a, ok := m.accounts[address]
+	if !ok {
+		return base, nil
+	}
+	a.resync(base)
+	if len(a.released) > 0 {
+		return a.released[0], nil
+	}
+	return a.next, nil
+}
+
+// sync returns the nonces of address, after those of its transactions in the
+// chain and the pool.
+func (m *NonceManager) sync(address crafttypes.Address) (*nonceAccount, error) {
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return nil, err
+	}
+	base := nextNonce(bc, address)
+	a, ok := m.accounts[address]
+	if !ok {
+		a = &nonceAccount{next: base}
+		m.accounts[address] = a
+	}
+	a.resync(base)
+	return a, nil
+}
+
+// onBlock resyncs the senders, forgetting those whose transactions all
+// reached the pool or the chain.
+func (m *NonceManager) onBlock() {
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		log.Warn("Failed to resync nonces, as: %v", err)
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for address, a := range m.accounts {
+		base := nextNonce(bc, address)
+		a.resync(base)
+		if a.next == base && len(a.released) == 0 {
+			delete(m.accounts, address)
+		}
+	}
+}
+
+// resync skips the nonces below base, taken by the chain or the pool.
+func (a *nonceAccount) resync(base uint64) {
+	if a.next < base {
+		a.next = base
+	}
+	i := sort.Search(len(a.released), func(i int) bool { return a.released[i] >= base })
+	a.released = a.released[i:]
+}
+
+// nextNonce returns the nonce following those of address in the chain and
+// the pool.
+func nextNonce(bc *repository.Repository, address crafttypes.Address) uint64 {
+	nonce := bc.GetNonce(address)
+	if noncePool := txpool.GetPoolNonce(address); noncePool > nonce {
+		nonce = noncePool + 1
+	}
+	return nonce
+}
+
+var (
+	nonceManagerMtx sync.RWMutex
+	nonceManager    = NewNonceManager(nil)
+)
+
+// SetNonceManager sets the manager of the nonces of the transactions the
+// gateway builds, stopping the previous one.
+func SetNonceManager(m *NonceManager) {
+	if m == nil {
+		m = NewNonceManager(nil)
+	}
+	nonceManagerMtx.Lock()
+	old := nonceManager
+	nonceManager = m
+	nonceManagerMtx.Unlock()
+	old.Stop()
+}
+
+// currentNonceManager returns the manager of the nonces, which a
+// reservation must be released to.
+func currentNonceManager() *NonceManager {
+	nonceManagerMtx.RLock()
+	defer nonceManagerMtx.RUnlock()
+	return nonceManager
+}
+
+//#### eth_getPendingNonce
+//
+//Returns the nonce the next transaction of an account built by the gateway gets, after those in the chain, the pool and submitted through the gateway.
+//
+//##### Parameters
+//
+//1. `DATA`, 20 Bytes - the address of the account.
+//
+//##### Returns
+//
+//`QUANTITY` - the nonce.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"eth_getPendingNonce","params":["0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": "0x1a"
+//}
+//```
+//
+//***
+func GetPendingNonce(address apitypes.Address) (cmn.Uint64, error) {
+	nonce, err := currentNonceManager().Pending(crafttypes.Address(address))
+	return cmn.Uint64(nonce), err
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/txpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockNonces makes chain and pool the nonces of the chain and the pool.
+func mockNonces(chain, pool *uint64) {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetNonce", func(*repository.Repository, crafttypes.Address) uint64 {
+		return *chain
+	})
+	monkey.Patch(txpool.GetPoolNonce, func(crafttypes.Address) uint64 {
+		return *pool
+	})
+}
+
+func TestNonceManagerReserve(t *testing.T) {
+	chain, pool := uint64(10), uint64(0)
+	mockNonces(&chain, &pool)
+	defer monkey.UnpatchAll()
+	m := NewNonceManager(nil)
+	address := crafttypes.Address{0x01}
+
+	// concurrent reservations get distinct nonces
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	reserved := make(map[uint64]bool)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, err := m.Reserve(address)
+			assert.NoError(t, err)
+			mtx.Lock()
+			reserved[nonce] = true
+			mtx.Unlock()
+		}()
+	}
+	wg.Wait()
+	require.Len(t, reserved, 50)
+	for nonce := uint64(10); nonce < 60; nonce++ {
+		assert.True(t, reserved[nonce], "nonce %d", nonce)
+	}
+
+	// released nonces are handed out again, lowest first
+	m.Release(address, 20)
+	m.Release(address, 15)
+	m.Release(address, 15)
+	pending, err := m.Pending(address)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(15), pending)
+	for _, want := range []uint64{15, 20, 60} {
+		nonce, err := m.Reserve(address)
+		require.NoError(t, err)
+		assert.Equal(t, want, nonce)
+	}
+	// releasing the last ones moves the next nonce back
+	m.Release(address, 59)
+	m.Release(address, 60)
+	m.Release(address, 100)
+	assert.Equal(t, uint64(59), m.accounts[address].next)
+	assert.Empty(t, m.accounts[address].released)
+
+	// the chain or the pool moving ahead skip the nonces
+	m.Release(address, 40)
+	pool = 69
+	nonce, err := m.Reserve(address)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(70), nonce)
+}
+
+func TestNonceManagerOnBlock(t *testing.T) {
+	chain, pool := uint64(10), uint64(0)
+	mockNonces(&chain, &pool)
+	defer monkey.UnpatchAll()
+	m := NewNonceManager(nil)
+	address := crafttypes.Address{0x01}
+
+	for i := 0; i < 3; i++ {
+		_, err := m.Reserve(address)
+		require.NoError(t, err)
+	}
+	m.Release(address, 10)
+	chain = 11
+	m.onBlock()
+	assert.Equal(t, uint64(13), m.accounts[address].next)
+	assert.Empty(t, m.accounts[address].released)
+
+	// forgotten once all its transactions are in the pool or the chain
+	pool = 12
+	m.onBlock()
+	assert.Empty(t, m.accounts)
+}
+
+func TestGetPendingNonce(t *testing.T) {
+	chain, pool := uint64(10), uint64(0)
+	mockNonces(&chain, &pool)
+	defer monkey.UnpatchAll()
+	SetNonceManager(NewNonceManager(nil))
+	defer SetNonceManager(nil)
+	address := apitypes.Address{0x01}
+
+	nonce, err := GetPendingNonce(address)
+	require.NoError(t, err)
+	assert.Equal(t, cmn.Uint64(10), nonce)
+	assert.Empty(t, nonceManager.accounts)
+	_, err = nonceManager.Reserve(crafttypes.Address(address))
+	require.NoError(t, err)
+	nonce, err = GetPendingNonce(address)
+	require.NoError(t, err)
+	assert.Equal(t, cmn.Uint64(11), nonce)
+}
+
+func TestSetNonceManagerWhileServing(t *testing.T) {
+	chain, pool := uint64(10), uint64(0)
+	mockNonces(&chain, &pool)
+	defer monkey.UnpatchAll()
+	defer SetNonceManager(nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			SetNonceManager(NewNonceManager(nil))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := GetPendingNonce(apitypes.Address{0x01})
+		require.NoError(t, err)
+	}
+	<-done
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/DSiSc/apigateway/core/accounts"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/crypto-suite/crypto"
+	wtypes "github.com/DSiSc/wallet/core/types"
+	"github.com/pkg/errors"
+)
+
+// defaultUnlockDuration is how long personal_unlockAccount unlocks an
+// account for when no duration is given.
+const defaultUnlockDuration = 300 * time.Second
+
+var (
+	signerMtx sync.RWMutex
+	signer    accounts.Signer
+	keyStore  *accounts.KeyStore
+)
+
+// SetSigner sets the signer of eth_sendTransaction, eth_sign and
+// personal_sign. A key store is also managed by the personal methods, which
+// are disabled otherwise. A nil signer, the default, disables signing.
+func SetSigner(s accounts.Signer) {
+	if ks, ok := s.(*accounts.KeyStore); ok && ks == nil {
+		s = nil
+	}
+	signerMtx.Lock()
+	defer signerMtx.Unlock()
+	signer = s
+	keyStore, _ = s.(*accounts.KeyStore)
+}
+
+// TestKeySigner returns the signer holding only the test key of the wallet.
+// The key being public, it is for devnets only.
+func TestKeySigner() accounts.Signer {
+	return testKeySigner{}
+}
+
+// currentSigner returns the signer, or an error if signing is disabled.
+func currentSigner() (accounts.Signer, error) {
+	signerMtx.RLock()
+	defer signerMtx.RUnlock()
+	if signer == nil {
+		return nil, errors.New("signing is not enabled")
+	}
+	return signer, nil
+}
+
+// testKeySigner signs with the test key of the wallet as its address.
+type testKeySigner struct{}
+
+func (testKeySigner) Accounts() []crafttypes.Address {
+	_, addr := wtypes.DefaultTestKey()
+	return []crafttypes.Address{crafttypes.Address(addr)}
+}
+
+func (testKeySigner) SignTx(from crafttypes.Address, tx *crafttypes.Transaction, chainID *big.Int) (*crafttypes.Transaction, error) {
+	key, addr := wtypes.DefaultTestKey()
+	if from != crafttypes.Address(addr) {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return wtypes.SignTx(tx, wtypes.NewEIP155Signer(chainID), key)
+}
+
+func (testKeySigner) SignHash(from crafttypes.Address, hash []byte) ([]byte, error) {
+	key, addr := wtypes.DefaultTestKey()
+	if from != crafttypes.Address(addr) {
+		return nil, accounts.ErrUnknownAccount
+	}
+	return crypto.Sign(hash, key)
+}
+
+// personalKeyStore returns the key store of the personal methods.
+func personalKeyStore() (*accounts.KeyStore, error) {
+	signerMtx.RLock()
+	defer signerMtx.RUnlock()
+	if keyStore == nil {
+		return nil, errors.New("the key store is not enabled")
+	}
+	return keyStore, nil
+}
+
+//#### personal_newAccount
+//
+//Generates a new account, whose key is stored encrypted with the passphrase. The account is locked.
+//
+//##### Parameters
+//
+//1. `String` - the passphrase.
+//
+//##### Returns
+//
+//`DATA`, 20 Bytes - the address of the account.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"personal_newAccount","params":["passphrase"],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": "0x5e97870f263700f46aa00d967821199b9bc5a120"
+//}
+//```
+//
+//***
+func NewAccount(password string) (apitypes.Address, error) {
+	ks, err := personalKeyStore()
+	if err != nil {
+		return apitypes.Address{}, err
+	}
+	address, err := ks.NewAccount(password)
+	return apitypes.Address(address), err
+}
+
+//#### personal_unlockAccount
+//
+//Decrypts the key of an account with its passphrase, so eth_sendTransaction signs with it.
+//
+//##### Parameters
+//
+//1. `DATA`, 20 Bytes - the address of the account.
+//2. `String` - the passphrase.
+//3. `QUANTITY` - (optional, default: 300) the seconds the account stays unlocked, 0 for until it is locked.
+//
+//##### Returns
+//
+//`Boolean` - `true` when the account is unlocked.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"personal_unlockAccount","params":["0x5e97870f263700f46aa00d967821199b9bc5a120", "passphrase", 30],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": true
+//}
+//```
+//
+//***
+func UnlockAccount(address apitypes.Address, password string, duration *ctypes.Seconds) (bool, error) {
+	ks, err := personalKeyStore()
+	if err != nil {
+		return false, err
+	}
+	timeout := defaultUnlockDuration
+	if duration != nil {
+		timeout = time.Duration(*duration) * time.Second
+	}
+	if err := ks.Unlock(crafttypes.Address(address), password, timeout); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//#### personal_lockAccount
+//
+//Locks an account, removing its decrypted key.
+//
+//##### Parameters
+//
+//1. `DATA`, 20 Bytes - the address of the account.
+//
+//##### Returns
+//
+//`Boolean` - `true` when the account is locked.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"personal_lockAccount","params":["0x5e97870f263700f46aa00d967821199b9bc5a120"],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": true
+//}
+//```
+//
+//***
+func LockAccount(address apitypes.Address) (bool, error) {
+	ks, err := personalKeyStore()
+	if err != nil {
+		return false, err
+	}
+	if err := ks.Lock(crafttypes.Address(address)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//#### personal_listAccounts
+//
+//Returns the accounts of the key store.
+//
+//##### Parameters
+//none
+//
+//##### Returns
+//
+//`Array of DATA`, 20 Bytes - the addresses of the accounts.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"personal_listAccounts","params":[],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": ["0x5e97870f263700f46aa00d967821199b9bc5a120"]
+//}
+//```
+//
+//***
+func ListAccounts() ([]apitypes.Address, error) {
+	ks, err := personalKeyStore()
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]apitypes.Address, 0) // return [] instead of nil if empty
+	for _, address := range ks.Accounts() {
+		addresses = append(addresses, apitypes.Address(address))
+	}
+	return addresses, nil
+}
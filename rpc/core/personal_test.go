@@ -0,0 +1,117 @@
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/apigateway/core/accounts"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	crafttypes "github.com/DSiSc/craft/types"
+	wtypes "github.com/DSiSc/wallet/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestKeySigner(t *testing.T) {
+	SetSigner(TestKeySigner())
+	defer SetSigner(nil)
+	_, addr := wtypes.DefaultTestKey()
+	addresses, err := Accounts()
+	require.NoError(t, err)
+	assert.Equal(t, []apitypes.Address{apitypes.Address(addr)}, addresses)
+
+	tx := apitypes.NewTransaction(0, nil, nil, 21000, big.NewInt(1), nil, apitypes.Address(addr))
+	tx, err = signer.SignTx(crafttypes.Address(addr), tx, big.NewInt(1))
+	require.NoError(t, err)
+	sender, err := wtypes.Sender(wtypes.NewEIP155Signer(big.NewInt(1)), tx)
+	require.NoError(t, err)
+	assert.Equal(t, crafttypes.Address(addr), crafttypes.Address(sender))
+
+	// the personal methods need a key store
+	_, err = NewAccount("passphrase")
+	assert.Error(t, err)
+	_, err = ListAccounts()
+	assert.Error(t, err)
+}
+
+func TestPersonalAccounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ks, err := accounts.NewKeyStore(dir, accounts.ScryptParams(accounts.LightScryptN, accounts.LightScryptP))
+	require.NoError(t, err)
+	SetSigner(ks)
+	defer SetSigner(nil)
+
+	addresses, err := ListAccounts()
+	require.NoError(t, err)
+	assert.Equal(t, []apitypes.Address{}, addresses)
+	address, err := NewAccount("passphrase")
+	require.NoError(t, err)
+	addresses, err = ListAccounts()
+	require.NoError(t, err)
+	assert.Equal(t, []apitypes.Address{address}, addresses)
+	addresses, err = Accounts()
+	require.NoError(t, err)
+	assert.Equal(t, []apitypes.Address{address}, addresses)
+
+	// a locked account doesn't sign
+	nonce := cmn.Uint64(0)
+	args := ctypes.SendTxArgs{From: address, To: &apitypes.Address{0x01}, Nonce: &nonce}
+	_, err = SendTransaction(args)
+	assert.Equal(t, accounts.ErrLocked, err)
+
+	_, err = UnlockAccount(address, "wrong", nil)
+	assert.Equal(t, accounts.ErrDecrypt, err)
+	_, err = UnlockAccount(apitypes.Address{0x01}, "passphrase", nil)
+	assert.Equal(t, accounts.ErrUnknownAccount, err)
+	forever := ctypes.Seconds(0)
+	unlocked, err := UnlockAccount(address, "passphrase", &forever)
+	require.NoError(t, err)
+	assert.True(t, unlocked)
+	tx := apitypes.NewTransaction(0, nil, nil, 21000, big.NewInt(1), nil, address)
+	tx, err = signer.SignTx(crafttypes.Address(address), tx, big.NewInt(1))
+	require.NoError(t, err)
+	sender, err := wtypes.Sender(wtypes.NewEIP155Signer(big.NewInt(1)), tx)
+	require.NoError(t, err)
+	assert.Equal(t, crafttypes.Address(address), crafttypes.Address(sender))
+
+	locked, err := LockAccount(address)
+	require.NoError(t, err)
+	assert.True(t, locked)
+	_, err = signer.SignTx(crafttypes.Address(address), tx, big.NewInt(1))
+	assert.Equal(t, accounts.ErrLocked, err)
+}
+
+func TestSecondsUnmarshalJSON(t *testing.T) {
+	for input, want := range map[string]ctypes.Seconds{`300`: 300, `"0x12c"`: 300, `0`: 0} {
+		var s ctypes.Seconds
+		require.NoError(t, s.UnmarshalJSON([]byte(input)), input)
+		assert.Equal(t, want, s, input)
+	}
+	var s ctypes.Seconds
+	assert.Error(t, s.UnmarshalJSON([]byte(`"300"`)))
+	assert.Error(t, s.UnmarshalJSON([]byte(`-1`)))
+}
+
+func TestSetSignerWhileServing(t *testing.T) {
+	defer SetSigner(nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			SetSigner(TestKeySigner())
+			SetSigner(nil)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := Accounts()
+		require.NoError(t, err)
+		_, _ = personalKeyStore()
+	}
+	<-done
+}
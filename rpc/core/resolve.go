@@ -0,0 +1,111 @@
+package core
+
+import (
+	"time"
+
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+var errBlockNotFound = errors.New("block not found")
+
+// blockByNumber returns the block blockNr selects in bc. The committed blocks
+// being final, latest, safe and finalized all select the head.
+func blockByNumber(bc *repository.Repository, blockNr apitypes.BlockNumber) (*types.Block, error) {
+	switch blockNr {
+	case apitypes.LatestBlockNumber, apitypes.SafeBlockNumber, apitypes.FinalizedBlockNumber:
+		return currentBlock(bc)
+	case apitypes.PendingBlockNumber:
+		head, err := currentBlock(bc)
+		if err != nil {
+			return nil, err
+		}
+		return pendingBlock(head), nil
+	}
+	if blockNr < 0 {
+		return nil, errors.Errorf("invalid block number %d", blockNr)
+	}
+	block, err := bc.GetBlockByHeight(blockNr.Touint64())
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	return block, nil
+}
+
+// blockByNumberOrHash returns the block bnh selects in bc. A block selected
+// by hash must be canonical if required.
+func blockByNumberOrHash(bc *repository.Repository, bnh apitypes.BlockNumberOrHash) (*types.Block, error) {
+	hash, ok := bnh.Hash()
+	if !ok {
+		number, _ := bnh.Number()
+		return blockByNumber(bc, number)
+	}
+	block, err := bc.GetBlockByHash(types.Hash(hash))
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	if bnh.RequireCanonical {
+		canonical, err := bc.GetBlockByHeight(block.Header.Height)
+		if err != nil || canonical == nil || canonical.HeaderHash != block.HeaderHash {
+			return nil, errors.Errorf("hash %s is not currently canonical", hash.Hex())
+		}
+	}
+	return block, nil
+}
+
+// errPendingState is returned for the state of the pending block, the gateway
+// not executing the transactions of the pool.
+var errPendingState = errors.New("pending state is not supported, the transactions of the pool are not executed")
+
+// stateByNumberOrHash returns the state after the block bnh selects. The
+// pending block has no state.
+func stateByNumberOrHash(bnh apitypes.BlockNumberOrHash) (*repository.Repository, *types.Block, error) {
+	if isPending(bnh) {
+		return nil, nil, errPendingState
+	}
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := blockByNumberOrHash(bc, bnh)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := repository.NewRepositoryByBlockHash(block.HeaderHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return state, block, nil
+}
+
+// isPending tells whether bnh selects the pending block.
+func isPending(bnh apitypes.BlockNumberOrHash) bool {
+	number, ok := bnh.Number()
+	return ok && number == apitypes.PendingBlockNumber
+}
+
+func currentBlock(bc *repository.Repository) (*types.Block, error) {
+	block := bc.GetCurrentBlock()
+	if block == nil {
+		return nil, errBlockNotFound
+	}
+	return block, nil
+}
+
+// pendingBlock returns the view of the block following head, not yet built:
+// it has no hash and the transactions of the pool are not known.
+func pendingBlock(head *types.Block) *types.Block {
+	header := *head.Header
+	header.Height = head.Header.Height + 1
+	header.PrevBlockHash = head.HeaderHash
+	header.Timestamp = uint64(time.Now().Unix())
+	return &types.Block{Header: &header}
+}
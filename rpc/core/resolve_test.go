@@ -0,0 +1,112 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	"github.com/DSiSc/craft/types"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockChain makes b a chain of the blocks at heights 0 to head, whose hashes
+// are their height plus one, beside the block of hash 0xff at height 3 off the
+// chain.
+func mockChain(head uint64) {
+	block := func(height uint64) *types.Block {
+		return &types.Block{HeaderHash: types.Hash{byte(height + 1)}, Header: &types.Header{Height: height}}
+	}
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlock", func(*repository.Repository) *types.Block {
+		return block(head)
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHeight", func(_ *repository.Repository, height uint64) (*types.Block, error) {
+		if height > head {
+			return nil, nil
+		}
+		return block(height), nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHash", func(_ *repository.Repository, hash types.Hash) (*types.Block, error) {
+		if hash[0] == 0xff {
+			return &types.Block{HeaderHash: hash, Header: &types.Header{Height: 3}}, nil
+		}
+		return block(uint64(hash[0] - 1)), nil
+	})
+}
+
+func TestBlockByNumber(t *testing.T) {
+	mockChain(9)
+	defer monkey.UnpatchAll()
+
+	for _, tag := range []apitypes.BlockNumber{apitypes.LatestBlockNumber, apitypes.SafeBlockNumber, apitypes.FinalizedBlockNumber} {
+		block, err := blockByNumber(b, tag)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(9), block.Header.Height, "tag %d", tag)
+	}
+	block, err := blockByNumber(b, apitypes.EarliestBlockNumber)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), block.Header.Height)
+
+	// the pending block follows the head
+	block, err = blockByNumber(b, apitypes.PendingBlockNumber)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), block.Header.Height)
+	assert.Equal(t, types.Hash{10}, block.Header.PrevBlockHash)
+	assert.Equal(t, types.Hash{}, block.HeaderHash)
+	assert.Empty(t, block.Transactions)
+
+	_, err = blockByNumber(b, apitypes.BlockNumber(10))
+	assert.Equal(t, errBlockNotFound, err)
+	_, err = blockByNumber(b, apitypes.BlockNumber(-5))
+	assert.Error(t, err)
+}
+
+func TestBlockByNumberOrHash(t *testing.T) {
+	mockChain(9)
+	defer monkey.UnpatchAll()
+
+	block, err := blockByNumberOrHash(b, apitypes.BlockNumberOrHashWithNumber(apitypes.BlockNumber(4)))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), block.Header.Height)
+
+	hash := cmn.Hash{5}
+	block, err = blockByNumberOrHash(b, apitypes.BlockNumberOrHash{BlockHash: &hash, RequireCanonical: true})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), block.Header.Height)
+
+	// a block off the chain is only found if not required canonical
+	hash = cmn.Hash{0xff}
+	block, err = blockByNumberOrHash(b, apitypes.BlockNumberOrHash{BlockHash: &hash})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), block.Header.Height)
+	_, err = blockByNumberOrHash(b, apitypes.BlockNumberOrHash{BlockHash: &hash, RequireCanonical: true})
+	assert.Error(t, err)
+}
+
+func TestStateByNumberOrHash(t *testing.T) {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	var stateOf types.Hash
+	monkey.Patch(repository.NewRepositoryByBlockHash, func(hash types.Hash) (*repository.Repository, error) {
+		stateOf = hash
+		return b, nil
+	})
+	mockChain(9)
+	defer monkey.UnpatchAll()
+
+	// the pending block has no state
+	_, _, err := stateByNumberOrHash(apitypes.BlockNumberOrHashWithNumber(apitypes.PendingBlockNumber))
+	assert.Equal(t, errPendingState, err)
+
+	_, block, err := stateByNumberOrHash(apitypes.BlockNumberOrHashWithNumber(apitypes.LatestBlockNumber))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9), block.Header.Height)
+	assert.Equal(t, types.Hash{10}, stateOf)
+
+	_, _, err = stateByNumberOrHash(apitypes.BlockNumberOrHashWithNumber(apitypes.BlockNumber(12)))
+	assert.Equal(t, errBlockNotFound, err)
+}
@@ -1,9 +1,18 @@
 package core
 
 import (
+	"time"
+
 	rpc "github.com/DSiSc/apigateway/rpc/lib/server"
 )
 
+// callTimeout is the default deadline of a single eth_call execution.
+const callTimeout = 5 * time.Second
+
+// estimateTimeout is the default deadline of the executions of an
+// eth_estimateGas.
+const estimateTimeout = 4 * callTimeout
+
 // NOTE: Amino is registered in rpc/core/types/wire.go.
 var Routes = map[string]*rpc.RPCFunc{
 	// namespace "eth" API
@@ -21,19 +30,40 @@ var Routes = map[string]*rpc.RPCFunc{
 	"eth_getBalance":                          rpc.NewRPCFunc(GetBalance, "address, blockNr"),
 	"eth_getCode":                             rpc.NewRPCFunc(GetCode, "address, blockNr"),
 	"eth_getTransactionCount":                 rpc.NewRPCFunc(GetTransactionCount, "address, blockNr"),
+	"eth_getPendingNonce":                     rpc.NewRPCFunc(GetPendingNonce, "address"),
 	"eth_getTransactionByBlockHashAndIndex":   rpc.NewRPCFunc(GetTransactionByBlockHashAndIndex, "blockHash, index"),
 	"eth_getTransactionByBlockNumberAndIndex": rpc.NewRPCFunc(GetTransactionByBlockNumberAndIndex, "blockNr, index"),
-	"eth_call":        rpc.NewRPCFunc(Call, "args, blockNr"),
-	"eth_gasPrice":    rpc.NewRPCFunc(GasPrice, ""),
-	"eth_estimateGas": rpc.NewRPCFunc(EstimateGas, "args"),
-	"eth_accounts":    rpc.NewRPCFunc(Accounts, ""),
-	"eth_subscribe":   rpc.NewWSRPCFunc(Subscribe, "rawMsg"),
-	"eth_unsubscribe": rpc.NewWSRPCFunc(UnSubscribe, "subID"),
-	"net_listening":   rpc.NewRPCFunc(Listening, ""),
-	"net_version":     rpc.NewRPCFunc(Version, ""),
-	"net_nodeInfo":    rpc.NewRPCFunc(NodeInfo, ""),
-	"net_sysContract": rpc.NewRPCFunc(SystemContract, ""),
-	"net_channelInfo": rpc.NewRPCFunc(ChannelInfo, ""),
+	"eth_getLogs":                             rpc.NewRPCFunc(GetLogs, "args"),
+	"eth_newFilter":                           rpc.NewRPCFunc(NewFilter, "args"),
+	"eth_newBlockFilter":                      rpc.NewRPCFunc(NewBlockFilter, ""),
+	"eth_newPendingTransactionFilter":         rpc.NewRPCFunc(NewPendingTransactionFilter, ""),
+	"eth_getFilterChanges":                    rpc.NewRPCFunc(GetFilterChanges, "id"),
+	"eth_getFilterLogs":                       rpc.NewRPCFunc(GetFilterLogs, "id"),
+	"eth_uninstallFilter":                     rpc.NewRPCFunc(UninstallFilter, "id"),
+	"eth_call":                                rpc.NewRPCFunc(Call, "args, blockNr", rpc.CallTimeout(callTimeout)),
+	"eth_gasPrice":                            rpc.NewRPCFunc(GasPrice, ""),
+	"eth_estimateGas":                         rpc.NewRPCFunc(EstimateGas, "args, blockNr", rpc.CallTimeout(estimateTimeout)),
+	"eth_accounts":                            rpc.NewRPCFunc(Accounts, ""),
+	"eth_subscribe":                           rpc.NewWSRPCFunc(Subscribe, "rawMsg"),
+	"eth_unsubscribe":                         rpc.NewWSRPCFunc(UnSubscribe, "subID"),
+	"net_listening":                           rpc.NewRPCFunc(Listening, ""),
+	"net_version":                             rpc.NewRPCFunc(Version, ""),
+	"net_nodeInfo":                            rpc.NewRPCFunc(NodeInfo, ""),
+	"net_sysContract":                         rpc.NewRPCFunc(SystemContract, ""),
+	"net_channelInfo":                         rpc.NewRPCFunc(ChannelInfo, ""),
+}
+
+// AccountRoutes are the methods signing with the keys of a key store, and
+// managing its accounts. They are served only with a key store signer.
+var AccountRoutes = map[string]*rpc.RPCFunc{
+	"eth_sign":               rpc.NewRPCFunc(Sign, "address, data"),
+	"eth_signTypedData_v4":   rpc.NewRPCFunc(SignTypedData, "address, typedData"),
+	"personal_newAccount":    rpc.NewRPCFunc(NewAccount, "password"),
+	"personal_unlockAccount": rpc.NewRPCFunc(UnlockAccount, "address, password, duration"),
+	"personal_lockAccount":   rpc.NewRPCFunc(LockAccount, "address"),
+	"personal_listAccounts":  rpc.NewRPCFunc(ListAccounts, ""),
+	"personal_sign":          rpc.NewRPCFunc(PersonalSign, "data, address, password"),
+	"personal_ecRecover":     rpc.NewRPCFunc(EcRecover, "data, sig"),
 }
 
 func AddTestRoutes() {
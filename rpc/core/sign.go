@@ -0,0 +1,182 @@
+package core
+
+import (
+	cmn "github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/apigateway/core/accounts"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/pkg/errors"
+)
+
+// signHash signs hash as address, with password if given or else with the
+// unlocked key, returning the signature with V 27 or 28.
+func signHash(address apitypes.Address, hash []byte, password *string) (cmn.Bytes, error) {
+	var sig []byte
+	var err error
+	if password != nil {
+		ks, kerr := personalKeyStore()
+		if kerr != nil {
+			return nil, kerr
+		}
+		sig, err = ks.SignHashWithPassphrase(crafttypes.Address(address), *password, hash)
+	} else {
+		s, serr := currentSigner()
+		if serr != nil {
+			return nil, serr
+		}
+		sig, err = s.SignHash(crafttypes.Address(address), hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sig[64] += 27
+	return sig, nil
+}
+
+//#### eth_sign
+//
+//Signs a message with the key of an account, prefixed with `"\x19Ethereum Signed Message:\n" + len(message)` so it can't be a transaction.
+//
+//The account must be unlocked.
+//
+//##### Parameters
+//
+//1. `DATA`, 20 Bytes - the address of the account.
+//2. `DATA` - the message.
+//
+//##### Returns
+//
+//`DATA`, 65 Bytes - the signature [R || S || V], with V 27 or 28.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"eth_sign","params":["0x9b2055d370f73ec7d8a03e965129118dc8f5bf83", "0xdeadbeaf"],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": "0xa3f20717a250c2b0b729b7e5becbff67fdaef7e0699da4de7ca5895b02a170a12d887fd3b17bfdce3481f10bea41f45ba9f709d39ce8325427b57afcfc994cee1b"
+//}
+//```
+//
+//***
+func Sign(address apitypes.Address, data cmn.Bytes) (cmn.Bytes, error) {
+	return signHash(address, accounts.TextHash(data), nil)
+}
+
+//#### personal_sign
+//
+//Signs a message like [eth_sign](#eth_sign), with the parameters in the other order.
+//
+//##### Parameters
+//
+//1. `DATA` - the message.
+//2. `DATA`, 20 Bytes - the address of the account.
+//3. `String` - (optional) the passphrase of the account, which is then signed with without being unlocked.
+//
+//##### Returns
+//
+//`DATA`, 65 Bytes - the signature [R || S || V], with V 27 or 28.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"personal_sign","params":["0xdeadbeaf", "0x9b2055d370f73ec7d8a03e965129118dc8f5bf83", "passphrase"],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": "0xa3f20717a250c2b0b729b7e5becbff67fdaef7e0699da4de7ca5895b02a170a12d887fd3b17bfdce3481f10bea41f45ba9f709d39ce8325427b57afcfc994cee1b"
+//}
+//```
+//
+//***
+func PersonalSign(data cmn.Bytes, address apitypes.Address, password *string) (cmn.Bytes, error) {
+	return signHash(address, accounts.TextHash(data), password)
+}
+
+//#### personal_ecRecover
+//
+//Returns the address of the account that signed a message with [eth_sign](#eth_sign) or [personal_sign](#personal_sign).
+//
+//##### Parameters
+//
+//1. `DATA` - the message.
+//2. `DATA`, 65 Bytes - the signature [R || S || V], with V 27 or 28.
+//
+//##### Returns
+//
+//`DATA`, 20 Bytes - the address of the account.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"personal_ecRecover","params":["0xdeadbeaf", "0xa3f20717a250c2b0b729b7e5becbff67fdaef7e0699da4de7ca5895b02a170a12d887fd3b17bfdce3481f10bea41f45ba9f709d39ce8325427b57afcfc994cee1b"],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": "0x9b2055d370f73ec7d8a03e965129118dc8f5bf83"
+//}
+//```
+//
+//***
+func EcRecover(data cmn.Bytes, sig cmn.Bytes) (apitypes.Address, error) {
+	if len(sig) != 65 {
+		return apitypes.Address{}, errors.Errorf("signature of %d bytes, expected 65", len(sig))
+	}
+	if sig[64] != 27 && sig[64] != 28 {
+		return apitypes.Address{}, errors.New("invalid signature V, expected 27 or 28")
+	}
+	rsv := make([]byte, 65)
+	copy(rsv, sig)
+	rsv[64] -= 27
+	address, err := accounts.RecoverAddress(accounts.TextHash(data), rsv)
+	return apitypes.Address(address), err
+}
+
+//#### eth_signTypedData_v4
+//
+//Signs typed structured data as defined by [EIP-712](https://eips.ethereum.org/EIPS/eip-712), with arrays.
+//
+//The account must be unlocked.
+//
+//##### Parameters
+//
+//1. `DATA`, 20 Bytes - the address of the account.
+//2. `Object` - the typed data, or its JSON encoding:
+//- `types`: `Object` - the members of the struct types, by name, including `EIP712Domain`.
+//- `primaryType`: `String` - the type of the message.
+//- `domain`: `Object` - the domain, of type `EIP712Domain`.
+//- `message`: `Object` - the message.
+//
+//##### Returns
+//
+//`DATA`, 65 Bytes - the signature [R || S || V], with V 27 or 28.
+//
+//##### Example
+//```js
+//// Request
+//curl -X POST --data '{"jsonrpc":"2.0","method":"eth_signTypedData_v4","params":["0xcd2a3d9f938e13cd947ec05abc7fe734df8dd826", {"types": {"EIP712Domain": [{"name": "name", "type": "string"}], "Mail": [{"name": "contents", "type": "string"}]}, "primaryType": "Mail", "domain": {"name": "Ether Mail"}, "message": {"contents": "Hello, Bob!"}}],"id":1}'
+//
+//// Result
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "result": "0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b915621c"
+//}
+//```
+//
+//***
+func SignTypedData(address apitypes.Address, typedData ctypes.TypedDataArgs) (cmn.Bytes, error) {
+	hash, err := typedData.Hash()
+	if err != nil {
+		return nil, err
+	}
+	return signHash(address, hash, nil)
+}
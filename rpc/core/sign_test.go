@@ -0,0 +1,127 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/apigateway/core/accounts"
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	wtypes "github.com/DSiSc/wallet/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTypedData = `{
+	"types": {
+		"EIP712Domain": [{"name": "name", "type": "string"}, {"name": "chainId", "type": "uint256"}],
+		"Mail": [{"name": "contents", "type": "string"}]
+	},
+	"primaryType": "Mail",
+	"domain": {"name": "Ether Mail", "chainId": 1},
+	"message": {"contents": "Hello, Bob!"}
+}`
+
+func TestSignWithTestKey(t *testing.T) {
+	SetSigner(TestKeySigner())
+	defer SetSigner(nil)
+	_, addr := wtypes.DefaultTestKey()
+	message := cmn.Bytes("hello")
+	sig, err := Sign(apitypes.Address(addr), message)
+	require.NoError(t, err)
+	require.Len(t, sig, 65)
+	assert.True(t, sig[64] == 27 || sig[64] == 28)
+	from, err := EcRecover(message, sig)
+	require.NoError(t, err)
+	assert.Equal(t, apitypes.Address(addr), from)
+
+	// a passphrase needs the key store
+	password := "passphrase"
+	_, err = PersonalSign(message, apitypes.Address(addr), &password)
+	assert.Error(t, err)
+
+	// the test key signs only as its own address
+	_, err = Sign(apitypes.HexToAddress("0x59b3f85ba6eb737fd0fad93bc4b5f92fd8c591de"), message)
+	assert.Equal(t, accounts.ErrUnknownAccount, err)
+}
+
+func TestSignDisabled(t *testing.T) {
+	// signing is disabled by default
+	_, addr := wtypes.DefaultTestKey()
+	_, err := Sign(apitypes.Address(addr), cmn.Bytes("hello"))
+	assert.EqualError(t, err, "signing is not enabled")
+	_, err = SendTransaction(ctypes.SendTxArgs{From: apitypes.Address(addr)})
+	assert.EqualError(t, err, "signing is not enabled")
+	addresses, err := Accounts()
+	require.NoError(t, err)
+	assert.Empty(t, addresses)
+}
+
+func TestSign(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keystore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ks, err := accounts.NewKeyStore(dir, accounts.ScryptParams(accounts.LightScryptN, accounts.LightScryptP))
+	require.NoError(t, err)
+	SetSigner(ks)
+	defer SetSigner(nil)
+	address, err := NewAccount("passphrase")
+	require.NoError(t, err)
+
+	message := cmn.Bytes("hello")
+	_, err = Sign(address, message)
+	assert.Equal(t, accounts.ErrLocked, err)
+	var args ctypes.TypedDataArgs
+	require.NoError(t, json.Unmarshal([]byte(testTypedData), &args))
+	_, err = SignTypedData(address, args)
+	assert.Equal(t, accounts.ErrLocked, err)
+
+	// personal_sign with the passphrase signs without unlocking
+	password := "passphrase"
+	sig, err := PersonalSign(message, address, &password)
+	require.NoError(t, err)
+	from, err := EcRecover(message, sig)
+	require.NoError(t, err)
+	assert.Equal(t, address, from)
+	_, err = PersonalSign(message, address, nil)
+	assert.Equal(t, accounts.ErrLocked, err)
+
+	_, err = UnlockAccount(address, "passphrase", nil)
+	require.NoError(t, err)
+	sig, err = Sign(address, message)
+	require.NoError(t, err)
+	from, err = EcRecover(message, sig)
+	require.NoError(t, err)
+	assert.Equal(t, address, from)
+	from, err = EcRecover(cmn.Bytes("other"), sig)
+	require.NoError(t, err)
+	assert.NotEqual(t, address, from)
+
+	sig, err = SignTypedData(address, args)
+	require.NoError(t, err)
+	hash, err := args.Hash()
+	require.NoError(t, err)
+	sig[64] -= 27
+	recovered, err := accounts.RecoverAddress(hash, sig)
+	require.NoError(t, err)
+	assert.Equal(t, address, apitypes.Address(recovered))
+}
+
+func TestEcRecoverInvalid(t *testing.T) {
+	_, err := EcRecover(cmn.Bytes("hello"), make(cmn.Bytes, 64))
+	assert.Error(t, err)
+	_, err = EcRecover(cmn.Bytes("hello"), make(cmn.Bytes, 65))
+	assert.Error(t, err)
+}
+
+func TestTypedDataArgs(t *testing.T) {
+	var object, encoded ctypes.TypedDataArgs
+	require.NoError(t, json.Unmarshal([]byte(testTypedData), &object))
+	require.NoError(t, json.Unmarshal([]byte(strconv.Quote(testTypedData)), &encoded))
+	assert.Equal(t, object, encoded)
+	assert.Equal(t, json.Number("1"), object.Domain["chainId"])
+}
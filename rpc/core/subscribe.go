@@ -225,7 +225,6 @@ func UnSubscribe(wsCtx rpctypes.WSRPCContext, subID string) (bool, error) {
 // filterLogs creates a slice of logs matching the given criteria.
 func filterLogs(logs []*crafttypes.Log, fromBlock, toBlock *big.Int, addresses []crafttypes.Address, topics [][]crafttypes.Hash) []*crafttypes.Log {
 	var ret []*crafttypes.Log
-Logs:
 	for _, log := range logs {
 		if fromBlock != nil && fromBlock.Int64() >= 0 && fromBlock.Uint64() > log.BlockNumber {
 			continue
@@ -234,30 +233,38 @@ Logs:
 			continue
 		}
 
-		if len(addresses) > 0 && !includes(addresses, log.Address) {
+		if !matchLog(log, addresses, topics) {
 			continue
 		}
-		// If the to filtered topics is greater than the amount of topics in logs, skip.
-		if len(topics) > len(log.Topics) {
-			continue Logs
-		}
-		for i, sub := range topics {
-			match := len(sub) == 0 // empty rule set == wildcard
-			for _, topic := range sub {
-				if log.Topics[i] == topic {
-					match = true
-					break
-				}
-			}
-			if !match {
-				continue Logs
-			}
-		}
 		ret = append(ret, log)
 	}
 	return ret
 }
 
+// matchLog tells whether log is of one of addresses, if any, and has topics.
+func matchLog(log *crafttypes.Log, addresses []crafttypes.Address, topics [][]crafttypes.Hash) bool {
+	if len(addresses) > 0 && !includes(addresses, log.Address) {
+		return false
+	}
+	// If the to filtered topics is greater than the amount of topics in logs, skip.
+	if len(topics) > len(log.Topics) {
+		return false
+	}
+	for i, sub := range topics {
+		match := len(sub) == 0 // empty rule set == wildcard
+		for _, topic := range sub {
+			if log.Topics[i] == topic {
+				match = true
+				break
+			}
+		}
+		if !match {
+			return false
+		}
+	}
+	return true
+}
+
 func includes(addresses []crafttypes.Address, a crafttypes.Address) bool {
 	for _, addr := range addresses {
 		if addr == a {
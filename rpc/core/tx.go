@@ -1,12 +1,15 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	acmn "github.com/DSiSc/apigateway/common"
 	cmn "github.com/DSiSc/apigateway/common"
 	"github.com/DSiSc/apigateway/core/types"
 	ctypes "github.com/DSiSc/apigateway/rpc/core/types"
+	rpctypes "github.com/DSiSc/apigateway/rpc/lib/types"
 	"github.com/DSiSc/craft/log"
 	"github.com/DSiSc/craft/monitor"
 	"github.com/DSiSc/craft/rlp"
@@ -25,18 +28,12 @@ import (
 	"math/big"
 )
 
-var (
-	swch chan<- interface{}
-)
-
-func SetSwCh(ch chan<- interface{}) {
-	swch = ch
-}
-
 //#### eth_sendTransaction
 //
 //Creates new message call transaction or a contract creation, if the data field contains code.
 //
+//When the gossip switch is unavailable, or stalled until its queue is full, it fails with `transaction switch unavailable` or `transaction queue full, try again later`.
+//
 //##### Parameters
 //
 //1. `Object` - The transaction object
@@ -79,20 +76,29 @@ func SetSwCh(ch chan<- interface{}) {
 //```
 //
 //***
-func SendTransaction(args ctypes.SendTxArgs) (cmn.Hash, error) {
+func SendTransaction(args ctypes.SendTxArgs) (hash cmn.Hash, err error) {
 	monitor.JTMetrics.ApigatewayReceivedTx.Add(1)
+	txSubmissions.Inc("eth_sendTransaction", txReceived)
 
-	// give an initValue when nonce is nil
+	s, err := currentSigner()
+	if err != nil {
+		return cmn.Hash{}, err
+	}
+
+	// reserve a nonce when nonce is nil
 	var nonce uint64
 	if args.Nonce == nil {
-		bc, _ := repository.NewLatestStateRepository()
-		noncePool := txpool.GetPoolNonce((craft.Address)(args.From))
-		nonceChain := bc.GetNonce((craft.Address)(args.From))
-		if noncePool > nonceChain {
-			nonce = noncePool + 1
-		} else {
-			nonce = nonceChain
+		from := (craft.Address)(args.From)
+		nonces := currentNonceManager()
+		if nonce, err = nonces.Reserve(from); err != nil {
+			return cmn.Hash{}, err
 		}
+		// hand the nonce out again unless the transaction is queued
+		defer func() {
+			if err != nil {
+				nonces.Release(from, nonce)
+			}
+		}()
 	} else {
 		nonce = args.Nonce.Touint64()
 	}
@@ -124,11 +130,11 @@ func SendTransaction(args ctypes.SendTxArgs) (cmn.Hash, error) {
 	// give an initValue when gasPrice is nil
 	var gasPrice *big.Int
 	if args.GasPrice == nil {
-		gasPrice = new(big.Int).SetUint64(types.DefaultGasPrice)
+		gasPrice = suggestGasPrice()
 	} else {
 		gasPrice = args.GasPrice.ToBigInt()
 		if gasPrice.Sign() == 0 {
-			gasPrice = new(big.Int).SetUint64(types.DefaultGasPrice)
+			gasPrice = suggestGasPrice()
 		}
 	}
 
@@ -143,21 +149,23 @@ func SendTransaction(args ctypes.SendTxArgs) (cmn.Hash, error) {
 		args.From,
 	)
 
-	// SignTx
-	key, _ := wtypes.DefaultTestKey()
+	// SignTx with the key of the sender
 	chainId, err := config.GetChainIdFromConfig()
 	if err != nil {
 		log.Error("get chainId failed, err = %v", err)
 		return cmn.Hash{}, err
 	}
-	signer := wtypes.NewEIP155Signer(big.NewInt(int64(chainId)))
-	tx, err = wtypes.SignTx(tx, signer, key)
+	tx, err = s.SignTx((craft.Address)(args.From), tx, big.NewInt(int64(chainId)))
 	if err != nil {
-		return cmn.BytesToHash([]byte("Fail to signTx")), err
+		return cmn.Hash{}, err
 	}
 
-	swch <- tx
+	if err := submitTx(tx); err != nil {
+		txSubmissions.Inc("eth_sendTransaction", txDropped)
+		return cmn.Hash{}, err
+	}
 	monitor.JTMetrics.SwitchTakenTx.Add(1)
+	txSubmissions.Inc("eth_sendTransaction", txAccepted)
 	txId := types.TxHash(tx)
 	return (cmn.Hash)(txId), nil
 }
@@ -166,6 +174,10 @@ func SendTransaction(args ctypes.SendTxArgs) (cmn.Hash, error) {
 //
 //Creates new message call transaction or a contract creation for signed transactions.
 //
+//When the gossip switch is unavailable, or stalled until its queue is full, it fails with `transaction switch unavailable` or `transaction queue full, try again later`.
+//
+//Transactions that can't be mined are rejected with the error of Ethereum clients: `oversized data`, `invalid chain id for signer`, `transaction underpriced`, `nonce too low`, `nonce too high` (more than 64 past the next nonce of the sender) or `insufficient funds for gas * price + value`.
+//
 //##### Parameters
 //
 //1. `DATA` - The signed transaction data.
@@ -203,7 +215,12 @@ func SendTransaction(args ctypes.SendTxArgs) (cmn.Hash, error) {
 //***
 func SendRawTransaction(encodedTx acmn.Bytes) (cmn.Hash, error) {
 	monitor.JTMetrics.ApigatewayReceivedTx.Add(1)
+	txSubmissions.Inc("eth_sendRawTransaction", txReceived)
 
+	if uint64(len(encodedTx)) > MaxTxSize {
+		txSubmissions.Inc("eth_sendRawTransaction", txRejected)
+		return cmn.Hash{}, errOversizedData
+	}
 	tx := new(craft.Transaction)
 	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
 
@@ -222,6 +239,10 @@ func SendRawTransaction(encodedTx acmn.Bytes) (cmn.Hash, error) {
 		log.Error("get chainId failed, err = %v", err)
 		return cmn.Hash{}, err
 	}
+	if err := checkChainID(tx, chainId); err != nil {
+		txSubmissions.Inc("eth_sendRawTransaction", txRejected)
+		return cmn.Hash{}, err
+	}
 
 	from, err := wtypes.Sender(wtypes.NewEIP155Signer(big.NewInt(int64(chainId))), tx)
 	if err != nil {
@@ -231,10 +252,20 @@ func SendRawTransaction(encodedTx acmn.Bytes) (cmn.Hash, error) {
 	from_tmp := craft.Address(from)
 	tx.Data.From = &from_tmp
 
-	// give an initValue when nonce is nil
+	// reject what would never be mined rather than return its hash
+	if err := validateTx(tx, from_tmp); err != nil {
+		log.Info("sendRawTransaction tx %x rejected, as: %v", types.TxHash(tx), err)
+		txSubmissions.Inc("eth_sendRawTransaction", txRejected)
+		return cmn.Hash{}, err
+	}
+
 	// Send Tx to gossip switch
-	swch <- tx
+	if err := submitTx(tx); err != nil {
+		txSubmissions.Inc("eth_sendRawTransaction", txDropped)
+		return cmn.Hash{}, err
+	}
 	monitor.JTMetrics.SwitchTakenTx.Add(1)
+	txSubmissions.Inc("eth_sendRawTransaction", txAccepted)
 	txHash := types.TxHash(tx)
 	log.Info("haitao raw tx: %x", txHash)
 
@@ -243,6 +274,7 @@ func SendRawTransaction(encodedTx acmn.Bytes) (cmn.Hash, error) {
 
 func SendCrossRawTransaction(encodedTx acmn.Bytes, url string) (cmn.Hash, error) {
 	monitor.JTMetrics.ApigatewayReceivedTx.Add(1)
+	txSubmissions.Inc("eth_sendCrossRawTransaction", txReceived)
 
 	tx := new(craft.Transaction)
 	if err := rlp.DecodeBytes(encodedTx, tx); err != nil {
@@ -278,8 +310,9 @@ func SendCrossRawTransaction(encodedTx acmn.Bytes, url string) (cmn.Hash, error)
 	return txHash, nil
 }
 
-func ReceiveCrossRawTransactionReq(encodedTx acmn.Bytes) (cmn.Hash, error) {
+func ReceiveCrossRawTransactionReq(encodedTx acmn.Bytes) (hash cmn.Hash, err error) {
 	monitor.JTMetrics.ApigatewayReceivedTx.Add(1)
+	txSubmissions.Inc("eth_receiveCrossRawTransactionReq", txReceived)
 
 	tx := new(craft.Transaction)
 	rlp.DecodeBytes(encodedTx, tx)
@@ -297,15 +330,16 @@ func ReceiveCrossRawTransactionReq(encodedTx acmn.Bytes) (cmn.Hash, error) {
 	private := "29ad43a4ebb4a65436d9fb116d471d96516b3d5cc153e045b384664bed5371b9"
 
 	//get nonce
-	bc, _ := repository.NewLatestStateRepository()
-	noncePool := txpool.GetPoolNonce(*tx.Data.From)
-	nonceChain := bc.GetNonce(*tx.Data.From)
-	nonce := uint64(0)
-	if noncePool > nonceChain {
-		nonce = noncePool + 1
-	} else {
-		nonce = nonceChain
+	nonces := currentNonceManager()
+	nonce, err := nonces.Reserve(addr)
+	if err != nil {
+		return cmn.Hash{}, err
 	}
+	defer func() {
+		if err != nil {
+			nonces.Release(addr, nonce)
+		}
+	}()
 	tx.Data.AccountNonce = nonce
 	tx1 := new(craft.Transaction)
 	tx1.Data.AccountNonce = tx.Data.AccountNonce
@@ -387,6 +421,8 @@ func getPubliceAcccount() (craft.Address, error) {
 //- `to`: `DATA`, 20 Bytes - address of the receiver. `null` when its a contract creation transaction.
 //- `transactionIndex`: `QUANTITY` - integer of the transactions index position in the block. `null` when its pending.
 //- `value`: `QUANTITY` - value transferred in Wei.
+//- `type`: `QUANTITY` - the type of the transaction, always `0x0`, legacy.
+//- `chainId`: `QUANTITY` - the chain ID the transaction is signed for as of EIP-155, left out if signed for any chain.
 //- `v`: `QUANTITY` - ECDSA recovery id
 //- `r`: `DATA`, 32 Bytes - ECDSA signature r
 //- `s`: `DATA`, 32 Bytes - ECDSA signature s
@@ -412,6 +448,8 @@ func getPubliceAcccount() (craft.Address, error) {
 //    "to":"0xf02c1c8e6114b1dbe8937a39260b5b0a374432bb",
 //    "transactionIndex":"0x41", // 65
 //    "value":"0xf3dbb76162000", // 4290000000000000
+//    "type":"0x0",
+//    "chainId":"0x1",
 //    "v":"0x25", // 37
 //    "r":"0x1b5e176d927f8e9ab405058b2d2457392da3e20f328b16ddabcebc33eaac5fea",
 //    "s":"0x4ba69724e8f69de52f0125ad8b3c5c2cef33019bac3249e2c0a2192766d1721c"
@@ -434,57 +472,27 @@ func GetTransactionByHash(hash cmn.Hash) (*ctypes.RPCTransaction, error) {
 }
 
 func newRPCTransaction(tx *craft.Transaction, blockHash cmn.Hash, blockNumber uint64, index uint64) (*ctypes.RPCTransaction, error) {
-	var from *types.Address
-	from = (*types.Address)(tx.Data.From)
-
-	var gas cmn.Uint64
-	gas = (cmn.Uint64)(tx.Data.GasLimit)
-
-	var gasPrice *cmn.Big
-	gasPrice = (*cmn.Big)(tx.Data.Price)
-
-	var hash *cmn.Hash
-	h := (cmn.Hash)(types.TxHash(tx))
-	hash = &h
-
-	var input cmn.Bytes
-	input = cmn.Bytes(tx.Data.Payload)
-
-	var nonce *cmn.Uint64
-	nonce = (*cmn.Uint64)(&tx.Data.AccountNonce)
-
-	var to *types.Address
-	to = (*types.Address)(tx.Data.Recipient)
-
-	var value *cmn.Big
-	value = (*cmn.Big)(tx.Data.Amount)
-
-	var v *cmn.Big
-	v = (*cmn.Big)(tx.Data.V)
-
-	var r *cmn.Big
-	r = (*cmn.Big)(tx.Data.R)
-
-	var s *cmn.Big
-	s = (*cmn.Big)(tx.Data.S)
-
+	hash := (cmn.Hash)(types.TxHash(tx))
+	nonce := (cmn.Uint64)(tx.Data.AccountNonce)
 	result := &ctypes.RPCTransaction{
-		From:     from,
-		Gas:      gas,
-		GasPrice: gasPrice,
-		Hash:     hash,
-		Input:    input,
-		Nonce:    nonce,
-		To:       to,
-		Value:    value,
-		V:        v,
-		R:        r,
-		S:        s,
+		From:     (*types.Address)(tx.Data.From),
+		Gas:      (cmn.Uint64)(tx.Data.GasLimit),
+		GasPrice: (*cmn.Big)(tx.Data.Price),
+		Hash:     &hash,
+		Input:    cmn.Bytes(tx.Data.Payload),
+		Nonce:    &nonce,
+		To:       (*types.Address)(tx.Data.Recipient),
+		Value:    (*cmn.Big)(tx.Data.Amount),
+		ChainID:  (*cmn.Big)(signedChainID(tx)),
+		V:        (*cmn.Big)(tx.Data.V),
+		R:        (*cmn.Big)(tx.Data.R),
+		S:        (*cmn.Big)(tx.Data.S),
 	}
 	if blockHash != (cmn.Hash{}) {
-		result.BlockHash = blockHash
-		result.BlockNumber = cmn.Uint64(blockNumber)
-		result.TransactionIndex = cmn.Uint(index)
+		number, i := cmn.Uint64(blockNumber), cmn.Uint64(index)
+		result.BlockHash = &blockHash
+		result.BlockNumber = &number
+		result.TransactionIndex = &i
 	}
 	return result, nil
 }
@@ -515,6 +523,7 @@ func newRPCPendingTransaction(tx *craft.Transaction) (*ctypes.RPCTransaction, er
 //
 //`Object` - A transaction receipt object, or `null` when no receipt was found:
 //
+//- `type`: `QUANTITY` - the type of the transaction, always `0x0`, legacy.
 //- `transactionHash `: `DATA`, 32 Bytes - hash of the transaction.
 //- `transactionIndex`: `QUANTITY` - integer of the transactions index position in the block.
 //- `blockHash`: `DATA`, 32 Bytes - hash of the block where this transaction was in.
@@ -523,14 +532,20 @@ func newRPCPendingTransaction(tx *craft.Transaction) (*ctypes.RPCTransaction, er
 //- `to`: `DATA`, 20 Bytes - address of the receiver. null when its a contract creation transaction.
 //- `cumulativeGasUsed `: `QUANTITY ` - The total amount of gas used when this transaction was executed in the block.
 //- `gasUsed `: `QUANTITY ` - The amount of gas used by this specific transaction alone.
+//- `effectiveGasPrice`: `QUANTITY` - the gas price paid per unit of gas.
 //- `contractAddress `: `DATA`, 20 Bytes - The contract address created, if the transaction was a contract creation, otherwise `null`.
-//- `logs`: `Array` - Array of log objects, which this transaction generated.
+//- `logs`: `Array` - Array of log objects, which this transaction generated:
+//  - `removed`: `Boolean` - always `false`, blocks being final.
+//  - `logIndex`: `QUANTITY` - the index of the log in the block.
+//  - `transactionIndex`, `transactionHash`, `blockHash`, `blockNumber` - those of the receipt.
+//  - `address`: `DATA`, 20 Bytes - the address the log is from.
+//  - `data`: `DATA` - the non-indexed arguments of the log.
+//  - `topics`: `Array of DATA` - the indexed arguments of the log.
+//  - `transactionLogIndex`: `QUANTITY` - the index of the log in the transaction.
 //- `logsBloom`: `DATA`, 256 Bytes - Bloom filter for light clients to quickly retrieve related logs.
-//
-//It also returns _either_ :
-//
-//- `root` : `DATA` 32 bytes of post-transaction stateroot (pre Byzantium)
-//- `status`: `QUANTITY` either `1` (success) or `0` (failure)
+//- `root` : `DATA` 32 bytes of post-transaction stateroot, left out when none.
+//- `status`: `QUANTITY` the status of the transaction.
+//- `revertReason`: `String` - the reason a failed transaction reverted with, see [eth_call](#eth_call), or its bytes if not decoded. Left out unless the gateway replays failed transactions.
 //
 //
 //##### Example
@@ -549,6 +564,7 @@ func newRPCPendingTransaction(tx *craft.Transaction) (*ctypes.RPCTransaction, er
 //     blockHash: '0xc6ef2fc5426d6ad6fd9e2a26abeab0aa2411b7ab17f30a99d3cb96aed1d1055b',
 //     cumulativeGasUsed: '0x33bc', // 13244
 //     gasUsed: '0x4dc', // 1244
+//     effectiveGasPrice: '0x1',
 //     contractAddress: '0xb60e8dd61c5d32be8058bb8eb970870f07233155', // or null, if none was created
 //     logs: [{
 //         // logs as returned by getFilterLogs, etc.
@@ -566,80 +582,110 @@ func GetTransactionReceipt(hash cmn.Hash) (*ctypes.RPCReceipt, error) {
 	if tx, blockHash, blockNumber, index, _ := bc.GetTransactionByHash(TypeConvert(&hash)); tx != nil {
 		if receipt, _, _, _, _ := bc.GetReceiptByTxHash(TypeConvert(&hash)); receipt != nil {
 			log.Info("GetTransactionReceipt -- tx, blockNumber %d, index %d", blockNumber, index)
-			return newRPCReceipt(tx, receipt, (cmn.Hash)(blockHash), blockNumber, index)
+			// the logs of the receipt follow those of the transactions before it
+			var logIndex uint64
+			for i, r := range bc.GetReceiptByBlockHash(blockHash) {
+				if uint64(i) >= index {
+					break
+				}
+				logIndex += uint64(len(r.Logs))
+			}
+			result, err := newRPCReceipt(tx, receipt, (cmn.Hash)(blockHash), blockNumber, index, logIndex)
+			if err == nil && ReceiptRevertReason && receipt.Status == receiptStatusFailed {
+				reverted, err := replayTransaction(bc, blockHash, index)
+				if err != nil {
+					log.Warn("Failed to replay transaction %s, as: %v", hash.Hex(), err)
+				} else if reason, ok := revertReason(reverted); ok {
+					result.RevertReason = reason
+				} else if len(reverted) > 0 {
+					result.RevertReason = fmt.Sprintf("%#x", reverted)
+				}
+			}
+			return result, err
 		}
 	}
 	// Receipt unknown, return as such
 	return nil, nil
 }
 
-func newRPCReceipt(tx *craft.Transaction, receipt *craft.Receipt, blockHash cmn.Hash, blockNumber uint64, index uint64) (*ctypes.RPCReceipt, error) {
-	var hash *cmn.Hash
-	h := (cmn.Hash)(types.TxHash(tx))
-	hash = &h
+// receiptStatusFailed is the status of the receipts of failed transactions.
+const receiptStatusFailed uint64 = 0
 
-	var from *types.Address
-	from = (*types.Address)(tx.Data.From)
-
-	var to *types.Address
-	to = (*types.Address)(tx.Data.Recipient)
-
-	var root []byte
-	if receipt.PostState != nil {
-		root = receipt.PostState
-	} else {
-		root = nil
+// replayTransaction executes again the index-th transaction of the block of
+// hash blockHash, on the state of its parent after the transactions before it,
+// and returns its result.
+func replayTransaction(bc *repository.Repository, blockHash craft.Hash, index uint64) ([]byte, error) {
+	block, err := bc.GetBlockByHash(blockHash)
+	if err != nil {
+		return nil, err
 	}
-
-	var status *cmn.Uint64
-	s := cmn.Uint64(receipt.Status)
-	status = &s
-
-	var gasUsed *cmn.Uint64
-	g := cmn.Uint64(receipt.GasUsed)
-	gasUsed = &g
-
-	var cumulativeGasUsed *cmn.Uint64
-	c := cmn.Uint64(receipt.CumulativeGasUsed)
-	cumulativeGasUsed = &c
-
-	var logsBloom []byte
-	copy(logsBloom[:], receipt.Bloom[:])
-
-	var logs []*craft.Log
-	if receipt.Logs != nil {
-		logs = receipt.Logs
-	} else {
-		logs = nil
+	if block == nil || index >= uint64(len(block.Transactions)) {
+		return nil, errBlockNotFound
 	}
-
-	var contractAddress *types.Address
-	if receipt.ContractAddress != (craft.Address{}) {
-		contractAddress = (*types.Address)(&receipt.ContractAddress)
-	} else {
-		contractAddress = nil
+	state, err := repository.NewRepositoryByBlockHash(block.Header.PrevBlockHash)
+	if err != nil {
+		return nil, err
+	}
+	var result []byte
+	for _, tx := range block.Transactions[:index+1] {
+		gp := new(common.GasPool).AddGas(RPCGasCap)
+		result, _, _, err, _ = worker.ApplyTransaction(block.Header.Coinbase, block.Header, state, tx, gp)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return result, nil
+}
 
+// newRPCReceipt returns the receipt object of tx, the index-th transaction of
+// its block, whose logs follow logIndex logs of the block.
+func newRPCReceipt(tx *craft.Transaction, receipt *craft.Receipt, blockHash cmn.Hash, blockNumber uint64, index uint64, logIndex uint64) (*ctypes.RPCReceipt, error) {
+	hash := (cmn.Hash)(types.TxHash(tx))
 	result := &ctypes.RPCReceipt{
 		TransactionHash:   hash,
-		From:              from,
-		To:                to,
-		Root:              root,
-		Status:            status,
-		GasUsed:           gasUsed,
-		CumulativeGasUsed: cumulativeGasUsed,
-		LogsBloom:         logsBloom,
-		Logs:              logs,
-		ContractAddress:   contractAddress,
+		TransactionIndex:  cmn.Uint64(index),
+		BlockHash:         blockHash,
+		BlockNumber:       cmn.Uint64(blockNumber),
+		From:              (*types.Address)(tx.Data.From),
+		To:                (*types.Address)(tx.Data.Recipient),
+		CumulativeGasUsed: cmn.Uint64(receipt.CumulativeGasUsed),
+		GasUsed:           cmn.Uint64(receipt.GasUsed),
+		EffectiveGasPrice: (*cmn.Big)(tx.Data.Price),
+		Logs:              make([]*ctypes.RPCLog, 0, len(receipt.Logs)),
+		LogsBloom:         cmn.Bytes(receipt.Bloom[:]),
+		Root:              cmn.Bytes(receipt.PostState),
+		Status:            cmn.Uint64(receipt.Status),
 	}
-	if blockHash != (cmn.Hash{}) {
-		result.BlockHash = blockHash
-		result.BlockNumber = (*cmn.Big)(new(big.Int).SetUint64(blockNumber))
-		result.TransactionIndex = cmn.Uint(index)
+	if receipt.ContractAddress != (craft.Address{}) {
+		result.ContractAddress = (*types.Address)(&receipt.ContractAddress)
+	}
+	for i, l := range receipt.Logs {
+		result.Logs = append(result.Logs, newRPCLog(l, hash, blockHash, blockNumber, index, logIndex+uint64(i), uint64(i)))
 	}
 	return result, nil
 }
 
+// newRPCLog returns the log object of l, the txLogIndex-th log of the
+// transaction of hash txHash, the index-th of its block, and the logIndex-th
+// log of the block.
+func newRPCLog(l *craft.Log, txHash cmn.Hash, blockHash cmn.Hash, blockNumber uint64, index uint64, logIndex uint64, txLogIndex uint64) *ctypes.RPCLog {
+	topics := make([]cmn.Hash, len(l.Topics))
+	for i, topic := range l.Topics {
+		topics[i] = (cmn.Hash)(topic)
+	}
+	return &ctypes.RPCLog{
+		LogIndex:            cmn.Uint64(logIndex),
+		TransactionIndex:    cmn.Uint64(index),
+		TransactionHash:     txHash,
+		BlockHash:           blockHash,
+		BlockNumber:         cmn.Uint64(blockNumber),
+		Address:             (types.Address)(l.Address),
+		Data:                cmn.Bytes(l.Data),
+		Topics:              topics,
+		TransactionLogIndex: cmn.Uint64(txLogIndex),
+	}
+}
+
 func newRPCTransactionFromBlockIndex(b *craft.Block, index uint64) (*ctypes.RPCTransaction, error) {
 	txs := b.Transactions
 	if index >= uint64(len(txs)) {
@@ -692,7 +738,7 @@ func GetTransactionByBlockHashAndIndex(blockHash cmn.Hash, index cmn.Uint) (*cty
 //
 //##### Parameters
 //
-//1. `QUANTITY|TAG` - a block number, or the string `"earliest"`, `"latest"` or `"pending"`, as in the [default block parameter](#the-default-block-parameter).
+//1. `QUANTITY|TAG` - a block number, or the string `"earliest"`, `"latest"`, `"safe"`, `"finalized"` or `"pending"`, as in the [default block parameter](#the-default-block-parameter).
 //2. `QUANTITY` - the transaction index position.
 //
 //```js
@@ -717,17 +763,17 @@ func GetTransactionByBlockHashAndIndex(blockHash cmn.Hash, index cmn.Uint) (*cty
 //***
 func GetTransactionByBlockNumberAndIndex(blockNr types.BlockNumber, index cmn.Uint) (*ctypes.RPCTransaction, error) {
 	bc, err := repository.NewLatestStateRepository()
-	var block *craft.Block
-	if blockNr == types.LatestBlockNumber {
-		block = bc.GetCurrentBlock()
-	} else {
-		height := blockNr.Touint64()
-		block, err = bc.GetBlockByHeight(height)
+	if err != nil {
+		return nil, err
 	}
-	if block != nil {
-		return newRPCTransactionFromBlockIndex(block, uint64(index))
+	block, err := blockByNumber(bc, blockNr)
+	if err == errBlockNotFound {
+		return nil, nil
 	}
-	return nil, err
+	if err != nil {
+		return nil, err
+	}
+	return newRPCTransactionFromBlockIndex(block, uint64(index))
 }
 
 //#### eth_call
@@ -744,12 +790,14 @@ func GetTransactionByBlockNumberAndIndex(blockNr types.BlockNumber, index cmn.Ui
 //- `gasPrice`: `QUANTITY`  - (optional) Integer of the gasPrice used for each paid gas
 //- `value`: `QUANTITY`  - (optional) Integer of the value sent with this transaction
 //- `data`: `DATA`  - (optional) Hash of the method signature and encoded parameters. For details see [Ethereum Contract ABI](https://github.com/ethereum/wiki/wiki/Ethereum-Contract-ABI)
-//2. `QUANTITY|TAG` - integer block number, or the string `"latest"`, `"earliest"` or `"pending"`, see the [default block parameter](#the-default-block-parameter)
+//2. `QUANTITY|TAG` - integer block number, the string `"latest"`, `"earliest"`, `"safe"` or `"finalized"`, or a block hash, see the [default block parameter](#the-default-block-parameter). `"pending"` is rejected
 //
 //##### Returns
 //
 //`DATA` - the return value of executed contract.
 //
+//A call that reverts with data gives the error of code `3`, whose message is `execution reverted`, followed by the reason if decoded from an `Error(string)` or a `Panic(uint256)`. Its `data` holds the `reason` and the bytes the call reverted with, `data`. A call that fails without data, running out of gas for one, gives the error of code `-32000` and message `execution failed`.
+//
 //##### Example
 //```js
 //// Request
@@ -761,110 +809,151 @@ func GetTransactionByBlockNumberAndIndex(blockNr types.BlockNumber, index cmn.Ui
 //  "jsonrpc": "2.0",
 //  "result": "0x"
 //}
+//
+//// Result of a call reverting
+//{
+//  "id":1,
+//  "jsonrpc": "2.0",
+//  "error": {
+//    "code": 3,
+//    "message": "execution reverted: not allowed",
+//    "data": {
+//      "reason": "not allowed",
+//      "data": "0x08c379a00000000000000000000000000000000000000000000000000000000000000020000000000000000000000000000000000000000000000000000000000000000b6e6f7420616c6c6f776564000000000000000000000000000000000000000000"
+//    }
+//  }
+//}
 //```
 //
 //***
-func Call(args ctypes.SendTxArgs, blockNr types.BlockNumber) (cmn.Bytes, error) {
+func Call(ctx context.Context, args ctypes.SendTxArgs, blockNr types.BlockNumberOrHash) (cmn.Bytes, error) {
 	// to can not be nil
-	var to *types.Address
-	if &args.To == nil || *args.To == (types.Address{}) {
+	if args.To == nil || *args.To == (types.Address{}) {
 		return nil, errors.New("to is nil")
-	} else {
-		to = args.To
 	}
+	// give an initValue when gas is nil
+	var gas uint64
+	if args.Gas != nil {
+		gas = args.Gas.Touint64()
+	}
+	if gas == 0 || gas > RPCGasCap {
+		gas = RPCGasCap
+	}
+
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return cmn.Bytes{}, fmt.Errorf("new block chain failed")
+	}
+	result, _, failed, err := doCall(ctx, newCallTransaction(bc, args, gas), blockNr)
+	if err != nil {
+		return nil, err
+	}
+	if failed {
+		if len(result) > 0 {
+			return nil, newRevertError(result)
+		}
+		return nil, errExecutionFailed
+	}
+	return (cmn.Bytes)(result), nil
+}
 
+// newCallTransaction returns the transaction args describe, with gas, to
+// execute without sending it.
+func newCallTransaction(bc *repository.Repository, args ctypes.SendTxArgs, gas uint64) *craft.Transaction {
 	// value can be nil
 	var value *big.Int
 	if args.Value != nil {
 		value = args.Value.ToBigInt()
-	} else {
-		value = nil
 	}
 	// data can be nil
 	var data []byte
 	if args.Data != nil {
 		data = args.Data.Bytes()
-	} else {
-		data = nil
-	}
-	// give an initValue when gas is nil
-	var gas uint64
-	if args.Gas != nil {
-		gas = args.Gas.Touint64()
-		if gas == 0 {
-			gas = math.MaxUint64 / 2
-		}
-	} else {
-		gas = math.MaxUint64 / 2
 	}
 	// give an initValue when gasPrice is nil
 	var gasPrice *big.Int
 	if args.GasPrice == nil {
-		gasPrice = new(big.Int).SetUint64(types.DefaultGasPrice)
+		gasPrice = suggestGasPrice()
 	} else {
 		gasPrice = args.GasPrice.ToBigInt()
 		if gasPrice.Sign() == 0 {
-			gasPrice = new(big.Int).SetUint64(types.DefaultGasPrice)
+			gasPrice = suggestGasPrice()
 		}
 	}
 
 	// give an initValue when from is nil
-	var from types.Address
-	if &args.From == nil || args.From == (types.Address{}) {
+	from := args.From
+	if from == (types.Address{}) {
 		_, addr := wtypes.DefaultTestKey()
 		from = types.Address(addr)
-	} else {
-		from = args.From
 	}
 
-	bc, err := repository.NewLatestStateRepository()
-	if err != nil {
-		return cmn.Bytes{}, fmt.Errorf("new block chain failed")
-	}
 	// new types.Transaction base on SendTxArgs
-	tx := types.NewTransaction(
+	return types.NewTransaction(
 		bc.GetNonce(*types.TypeConvert(&from)),
-		to,
+		args.To,
 		value,
 		gas,
 		gasPrice,
 		data,
 		from,
 	)
-	result, _, _, err := doCall(tx, blockNr)
-	return (cmn.Bytes)(result), err
 }
 
-func doCall(tx *craft.Transaction, blockNr types.BlockNumber) ([]byte, uint64, bool, error) {
-	bc, err := repository.NewLatestStateRepository()
+// maxExecutions is the most executions of eth_call and eth_estimateGas in
+// flight, those given up on included.
+const maxExecutions = 32
+
+// executions holds a slot per execution in flight.
+var executions = make(chan struct{}, maxExecutions)
+
+// doCall executes tx against the state of blockNr. It gives up waiting for the
+// execution and returns ctx's error once ctx is done. The execution can't be
+// cancelled, it runs to its end, holding one of the maxExecutions slots until
+// then.
+func doCall(ctx context.Context, tx *craft.Transaction, blockNr types.BlockNumberOrHash) ([]byte, uint64, bool, error) {
+	bchash, block, err := stateByNumberOrHash(blockNr)
 	if err != nil {
 		return nil, 0, true, err
 	}
-	var block *craft.Block
-	if blockNr == types.LatestBlockNumber {
-		block = bc.GetCurrentBlock()
-	} else {
-		height := blockNr.Touint64()
-		block, err = bc.GetBlockByHeight(height)
-		if err != nil {
-			return nil, 0, true, err
-		}
-	}
 
-	bchash, err := repository.NewRepositoryByBlockHash(block.HeaderHash)
-	if err != nil {
+	if err := ctx.Err(); err != nil {
 		return nil, 0, true, err
 	}
 
-	gp := new(common.GasPool).AddGas(uint64(65536))
-	result, gas, failed, err, _ := worker.ApplyTransaction(block.Header.Coinbase, block.Header, bchash, tx, gp)
-	return result, gas, failed, err
+	type callResult struct {
+		result []byte
+		gas    uint64
+		failed bool
+		err    error
+	}
+	select {
+	case executions <- struct{}{}:
+	case <-ctx.Done():
+		return nil, 0, true, ctx.Err()
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		defer func() { <-executions }()
+		gp := new(common.GasPool).AddGas(RPCGasCap)
+		result, gas, failed, err, _ := worker.ApplyTransaction(block.Header.Coinbase, block.Header, bchash, tx, gp)
+		done <- callResult{result, gas, failed, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, 0, true, ctx.Err()
+	case res := <-done:
+		return res.result, res.gas, res.failed, res.err
+	}
 }
 
 //#### eth_gasPrice
 //
 //Returns the current price per gas in wei.
 //
+//With the gas price oracle of the gateway, it is a percentile of the prices of the transactions of the recent blocks and of the pool, within bounds. Otherwise it is the default price.
+//
 //##### Parameters
 //none
 //
@@ -887,7 +976,7 @@ func doCall(tx *craft.Transaction, blockNr types.BlockNumber) ([]byte, uint64, b
 //
 //***
 func GasPrice() (*cmn.Big, error) {
-	return (*cmn.Big)(new(big.Int).SetUint64(types.DefaultGasPrice)), nil
+	return (*cmn.Big)(suggestGasPrice()), nil
 }
 
 //#### eth_estimateGas
@@ -896,7 +985,10 @@ func GasPrice() (*cmn.Big, error) {
 //
 //##### Parameters
 //
-//See [eth_call](#eth_call) parameters, expect that all properties are optional. If no gas limit is specified geth uses the block gas limit from the pending block as an upper bound. As a result the returned estimate might not be enough to executed the call/transaction when the amount of gas is higher than the pending block gas limit.
+//1. `Object` - The transaction call object, see [eth_call](#eth_call) parameters, expect that all properties are optional. Without `to`, the gas of a contract creation is estimated.
+//2. `QUANTITY|TAG` - (optional, default: `"latest"`) integer block number, the string `"latest"`, `"earliest"`, `"safe"` or `"finalized"`, or a block hash, see the [default block parameter](#the-default-block-parameter). `"pending"` is rejected
+//
+//The estimate is the least gas the transaction succeeds with, searched up to `gas` if given, and at most `RPCGasCap`. Transactions that revert with it fail with the error of [eth_call](#eth_call).
 //
 //##### Returns
 //
@@ -916,14 +1008,145 @@ func GasPrice() (*cmn.Big, error) {
 //```
 //
 //***
-func EstimateGas(args ctypes.SendTxArgs) (cmn.Uint64, error) {
-	return cmn.Uint64(21000), nil
+func EstimateGas(ctx context.Context, args ctypes.SendTxArgs, blockNr *types.BlockNumberOrHash) (cmn.Uint64, error) {
+	number := types.BlockNumberOrHashWithNumber(types.LatestBlockNumber)
+	if blockNr != nil {
+		number = *blockNr
+	}
+	// binary search the gas between lo, which fails, and hi, which succeeds
+	lo, hi := txGas-1, RPCGasCap
+	if args.Gas != nil && args.Gas.Touint64() >= txGas && args.Gas.Touint64() < hi {
+		hi = args.Gas.Touint64()
+	}
+
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return 0, err
+	}
+	execute := func(gas uint64) ([]byte, uint64, bool, error) {
+		return doCall(ctx, newCallTransaction(bc, args, gas), number)
+	}
+
+	result, used, failed, err := execute(hi)
+	if err != nil {
+		return 0, err
+	}
+	if failed {
+		if len(result) > 0 {
+			return 0, newRevertError(result)
+		}
+		return 0, fmt.Errorf("gas required exceeds allowance (%d) or always failing transaction", hi)
+	}
+	// the gas used is a lower bound, refunds aside
+	if used > lo+1 && used-1 < hi {
+		lo = used - 1
+	}
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		_, _, failed, err := execute(mid)
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		// running out of gas may be reported as an error too
+		if failed || err != nil {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return cmn.Uint64(hi), nil
+}
+
+// txGas is the gas of a transaction without data, the least any needs.
+const txGas uint64 = 21000
+
+// RPCGasCap is the most gas eth_call and eth_estimateGas execute a
+// transaction with.
+var RPCGasCap uint64 = 50000000
+
+// ReceiptRevertReason tells eth_getTransactionReceipt to replay the failed
+// transactions to give the reason they reverted with, an execution of their
+// block up to them per receipt.
+var ReceiptRevertReason bool
+
+// errCodeReverted is the error code of the executions that revert.
+const errCodeReverted = 3
+
+// errExecutionFailed is the error of the executions that fail without
+// reverting with data.
+var errExecutionFailed = &rpctypes.RPCError{Code: -32000, Message: "execution failed"}
+
+// newRevertError returns the error of an execution that reverted with result.
+func newRevertError(result []byte) *rpctypes.RPCError {
+	message := "execution reverted"
+	reason, ok := revertReason(result)
+	if ok {
+		message += ": " + reason
+	}
+	return &rpctypes.RPCError{
+		Code:    errCodeReverted,
+		Message: message,
+		Data:    ctypes.RevertData{Reason: reason, Data: cmn.Bytes(result)},
+	}
+}
+
+var (
+	// revertSelector is the selector of Error(string), the revert reason of
+	// Solidity's require and revert.
+	revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0}
+	// panicSelector is the selector of Panic(uint256), the revert reason of
+	// Solidity's assert and of the checks the compiler adds.
+	panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71}
+)
+
+// panicReasons are the reasons of the panic codes of Solidity.
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// revertReason decodes the reason of a Solidity revert or panic from result.
+func revertReason(result []byte) (string, bool) {
+	if len(result) >= 4+32 && bytes.Equal(result[:4], panicSelector) {
+		code := new(big.Int).SetBytes(result[4 : 4+32])
+		if reason, ok := panicReasons[code.Uint64()]; code.IsUint64() && ok {
+			return reason, true
+		}
+		return fmt.Sprintf("unknown panic code: %#x", code), true
+	}
+	if len(result) < 4+32+32 || !bytes.Equal(result[:4], revertSelector) {
+		return "", false
+	}
+	data := result[4:]
+	offset := new(big.Int).SetBytes(data[:32])
+	if !offset.IsUint64() || offset.Uint64() > uint64(len(data)-32) {
+		return "", false
+	}
+	start := offset.Uint64() + 32
+	size := new(big.Int).SetBytes(data[start-32 : start])
+	if !size.IsUint64() || size.Uint64() > uint64(len(data))-start {
+		return "", false
+	}
+	return string(data[start : start+size.Uint64()]), true
 }
 
 func Accounts() ([]types.Address, error) {
 	addresses := make([]types.Address, 0) // return [] instead of nil if empty
-	_, addr := wtypes.DefaultTestKey()
-	addresses = append(addresses, types.Address(addr))
+	s, err := currentSigner()
+	if err != nil {
+		return addresses, nil
+	}
+	for _, addr := range s.Accounts() {
+		addresses = append(addresses, types.Address(addr))
+	}
 
 	return addresses, nil
 }
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/DSiSc/craft/rlp"
@@ -17,7 +18,9 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"encoding/hex"
 	cmn "github.com/DSiSc/apigateway/common"
@@ -29,6 +32,7 @@ import (
 	"github.com/DSiSc/repository"
 	wtypes "github.com/DSiSc/wallet/core/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // ------------------------
@@ -58,6 +62,8 @@ func TestETransaction_GetTxData(t *testing.T) {
 // package Test*
 
 func TestSendTransaction(t *testing.T) {
+	SetSigner(TestKeySigner())
+	defer SetSigner(nil)
 	// -------------------------
 	// Mock:  mockTransaction
 	nonce := uint64(16)
@@ -184,7 +190,7 @@ func TestSendTransaction(t *testing.T) {
 		} else {
 			assert.True(t, recv.Error.Code < 0, "#%d: not expecting a positive JSONRPC code", i)
 			// The wanted error is either in the message or the data
-			assert.Contains(t, recv.Error.Message+recv.Error.Data, tt.wantErr, "#%d: expected substring", i)
+			assert.Contains(t, recv.Error.Error(), tt.wantErr, "#%d: expected substring", i)
 		}
 	}
 
@@ -246,6 +252,10 @@ func TestSendRawTransaction(t *testing.T) {
 		return uint64(10)
 	})
 
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBalance", func(*repository.Repository, crafttypes.Address) *big.Int {
+		return big.NewInt(1000000)
+	})
+
 	encodedMockTx, _ := rlp.EncodeToBytes(mockTransaction)
 	mockTransaction.Size.Store(types.StorageSize(len(encodedMockTx)))
 	encodedMockTxStr := fmt.Sprintf("0x%x", encodedMockTx)
@@ -321,11 +331,12 @@ func TestSendRawTransaction(t *testing.T) {
 		} else {
 			assert.True(t, recv.Error.Code < 0, "#%d: not expecting a positive JSONRPC code", i)
 			// The wanted error is either in the message or the data
-			assert.Contains(t, recv.Error.Message+recv.Error.Data, tt.wantErr, "#%d: expected substring", i)
+			assert.Contains(t, recv.Error.Error(), tt.wantErr, "#%d: expected substring", i)
 		}
 	}
 
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetNonce")
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetBalance")
 	monkey.Unpatch(txpool.GetPoolNonce)
 	monkey.Unpatch(repository.NewLatestStateRepository)
 }
@@ -348,7 +359,7 @@ func TestGetTransactionByHash(t *testing.T) {
 
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getTransactionByHash", "id": 1, "params": [
               "0x95d191e78062c420e863df03311e5a09b28b431ced6e65048362d65515cd5770"]}`),
-			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0x5","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0x95d191e78062c420e863df03311e5a09b28b431ced6e65048362d65515cd5770","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x7","value":"0x0","v":"0x0","r":"0x0","s":"0x0"}}`},
+			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0x5","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0x95d191e78062c420e863df03311e5a09b28b431ced6e65048362d65515cd5770","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x7","value":"0x0","type":"0x0","v":"0x0","r":"0x0","s":"0x0"}}`},
 	}
 	// ------------------------
 	// httptest API
@@ -384,6 +395,9 @@ func TestGetTransactionReceipt(t *testing.T) {
 	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByTxHash", func(*repository.Repository, crafttypes.Hash) (*crafttypes.Receipt, crafttypes.Hash, uint64, uint64, error) {
 		return mockReturnReceipt, (crafttypes.Hash)(hashtest), 5, 7, nil
 	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash", func(*repository.Repository, crafttypes.Hash) []*crafttypes.Receipt {
+		return nil
+	})
 
 	// tests case
 	tests := []*Requestdata{
@@ -391,11 +405,12 @@ func TestGetTransactionReceipt(t *testing.T) {
 
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getTransactionReceipt", "id": 1, "params": [
               "0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99"]}`),
-			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0x5","transactionHash":"0x95d191e78062c420e863df03311e5a09b28b431ced6e65048362d65515cd5770","transactionIndex":"0x7","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","root":"e0ogr1SPXLN0gVeOE/bpYcUensG5k214HBBhMjmz6Sk=","status":"0x2","gasUsed":"0x5e6","cumulativeGasUsed":"0x4d7","logsBloom":null,"logs":null,"contractAddress":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b"}}`},
+			"", `{"jsonrpc":"2.0","id":1,"result":{"type":"0x0","transactionHash":"0x95d191e78062c420e863df03311e5a09b28b431ced6e65048362d65515cd5770","transactionIndex":"0x7","blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0x5","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","cumulativeGasUsed":"0x4d7","gasUsed":"0x5e6","effectiveGasPrice":"0x9184e72a0000","contractAddress":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","logs":[],"logsBloom":"0x` + strings.Repeat("00", 256) + `","root":"0x7b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e929","status":"0x2"}}`},
 	}
 	// ------------------------
 	// httptest API
 	doRpcTest(t, tests)
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash")
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByTxHash")
 	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetTransactionByHash")
 	monkey.Unpatch(repository.NewLatestStateRepository)
@@ -419,7 +434,7 @@ func TestGetTransactionByBlockHashAndIndex(t *testing.T) {
 
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getTransactionByBlockHashAndIndex", "id": 1, "params": [
               "0xc6ef2fc5426d6ad6fd9e2a26abeab0aa2411b7ab17f30a99d3cb96aed1d1055b", "0x0"]}`),
-			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0xc","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x0","value":"0x9184e72a","v":"0x0","r":"0x0","s":"0x0"}}`},
+			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0xc","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x0","value":"0x9184e72a","type":"0x0","v":"0x0","r":"0x0","s":"0x0"}}`},
 	}
 	// ------------------------
 	// httptest API
@@ -453,12 +468,12 @@ func TestGetTransactionByBlockNumberAndIndex(t *testing.T) {
 
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getTransactionByBlockNumberAndIndex", "id": 1, "params": [
               "0x1b4", "0x0"]}`),
-			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0xc","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x0","value":"0x9184e72a","v":"0x0","r":"0x0","s":"0x0"}}`},
+			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0xc","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x0","value":"0x9184e72a","type":"0x0","v":"0x0","r":"0x0","s":"0x0"}}`},
 		{
 
 			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_getTransactionByBlockNumberAndIndex", "id": 1, "params": [
               "latest", "0x0"]}`),
-			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0xc","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x0","value":"0x9184e72a","v":"0x0","r":"0x0","s":"0x0"}}`},
+			"", `{"jsonrpc":"2.0","id":1,"result":{"blockHash":"0x27b4a20af548f5cb37481578e13f6e961c51e9ec1b9936d781c10613239b3e99","blockNumber":"0xc","from":"0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b","gas":"0x76c0","gasPrice":"0x9184e72a0000","hash":"0xbedd625a813484aca74b38242fd7f439735be6211a033bf088c8b7b3656f4192","input":"0xd46e8dd67c5d32be8d46e8dd67c5d32be8058bb8eb970870f072445675058bb8eb970870f072445675","nonce":"0x10","to":"0xd46e8dd67c5d32be8058bb8eb970870f07244567","transactionIndex":"0x0","value":"0x9184e72a","type":"0x0","v":"0x0","r":"0x0","s":"0x0"}}`},
 	}
 	// ------------------------
 	// httptest API
@@ -539,7 +554,7 @@ func TestCall(t *testing.T) {
 		})
 
 		monkey.Patch(worker.ApplyTransaction, func(types.Address, *types.Header, *repository.Repository, *crafttypes.Transaction, *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
-			return getBytes("0x38"), uint64(0), true, nil, types.Address{}
+			return getBytes("0x38"), uint64(0), false, nil, types.Address{}
 		})
 
 		req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader(tt.payload))
@@ -611,12 +626,7 @@ func TestGasPrice(t *testing.T) {
 }
 
 func TestEstimateGas(t *testing.T) {
-
-	// tests case
-	tests := []*Requestdata{
-		{
-
-			fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_estimateGas", "id": 1, "params": [{
+	payload := fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_estimateGas", "id": 1, "params": [{
               "from": "%s",
               "to": "%s",
               "gas": "%s",
@@ -625,13 +635,244 @@ func TestEstimateGas(t *testing.T) {
 			  "nonce": "%s",
               "data": "%s"
               }]}`, request.from, request.to, request.gas, request.gasPrice,
-				request.value, request.nonce, request.data),
-			"", `{"jsonrpc":"2.0","id":1,"result":"0x5208"}`},
+		request.value, request.nonce, request.data)
+	// Error(string) of "not allowed"
+	reverted := getBytes("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"000000000000000000000000000000000000000000000000000000000000000b" +
+		"6e6f7420616c6c6f776564000000000000000000000000000000000000000000")
+
+	// tests case, the transaction succeeds with need gas, using 25000
+	tests := []struct {
+		need       uint64
+		result     []byte
+		wantReturn string
+	}{
+		{26000, nil, `{"jsonrpc":"2.0","id":1,"result":"0x6590"}`},
+		{25000, nil, `{"jsonrpc":"2.0","id":1,"result":"0x61a8"}`},
+		// above the gas of the request
+		{40000, nil, `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"Internal error","data":"gas required exceeds allowance (30400) or always failing transaction"}}`},
+		{40000, reverted, `{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted: not allowed","data":{"data":"` + cmn.Ghex.EncodeToString(reverted) + `","reason":"not allowed"}}}`},
 	}
-	// ------------------------
-	// httptest API
-	doRpcTest(t, tests)
 
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlock", func(*repository.Repository) *crafttypes.Block {
+		return getMockBlock()
+	})
+	monkey.Patch(repository.NewRepositoryByBlockHash, func(crafttypes.Hash) (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetNonce", func(*repository.Repository, types.Address) uint64 {
+		return uint64(0)
+	})
+
+	mux := testMux()
+	for i, tt := range tests {
+		tt := tt
+		monkey.Patch(worker.ApplyTransaction, func(_ types.Address, _ *types.Header, _ *repository.Repository, tx *crafttypes.Transaction, _ *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+			if tx.Data.GasLimit < tt.need {
+				return tt.result, tx.Data.GasLimit, true, nil, types.Address{}
+			}
+			return nil, 25000, false, nil, types.Address{}
+		})
+
+		req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader(payload))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		res := rec.Result()
+		assert.True(t, statusOK(res.StatusCode), "#%d: should always return 2XX", i)
+		blob, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Errorf("#%d: err reading body: %v", i, err)
+			continue
+		}
+		recv := new(rpctypes.RPCResponse)
+		json.Unmarshal(blob, recv)
+
+		b, _ := json.Marshal(recv)
+		assert.Equal(t, tt.wantReturn, string(b), "#%d", i)
+
+		monkey.Unpatch(worker.ApplyTransaction)
+	}
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetNonce")
+	monkey.UnpatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlock")
+	monkey.Unpatch(repository.NewRepositoryByBlockHash)
+	monkey.Unpatch(repository.NewLatestStateRepository)
+}
+
+func TestRevertReason(t *testing.T) {
+	reason, ok := revertReason(getBytes("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"6e6f000000000000000000000000000000000000000000000000000000000000"))
+	assert.True(t, ok)
+	assert.Equal(t, "no", reason)
+
+	// truncated
+	_, ok = revertReason(getBytes("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000040"))
+	assert.False(t, ok)
+	_, ok = revertReason(getBytes("0x4e487b71" +
+		"00000000000000000000000000000000000000000000000000000000000001"))
+	assert.False(t, ok)
+
+	// Panic(uint256)
+	reason, ok = revertReason(getBytes("0x4e487b71" +
+		"0000000000000000000000000000000000000000000000000000000000000012"))
+	assert.True(t, ok)
+	assert.Equal(t, "division or modulo by zero", reason)
+	reason, ok = revertReason(getBytes("0x4e487b71" +
+		"0100000000000000000000000000000000000000000000000000000000000001"))
+	assert.True(t, ok)
+	assert.Equal(t, "unknown panic code: 0x100000000000000000000000000000000000000000000000000000000000001", reason)
+}
+
+func TestDoCallExecutions(t *testing.T) {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlock", func(*repository.Repository) *crafttypes.Block {
+		return getMockBlock()
+	})
+	monkey.Patch(repository.NewRepositoryByBlockHash, func(crafttypes.Hash) (*repository.Repository, error) {
+		return b, nil
+	})
+	release := make(chan struct{})
+	var started int32
+	monkey.Patch(worker.ApplyTransaction, func(types.Address, *types.Header, *repository.Repository, *crafttypes.Transaction, *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+		atomic.AddInt32(&started, 1)
+		<-release
+		return nil, 21000, false, nil, types.Address{}
+	})
+	defer monkey.UnpatchAll()
+
+	latest := ctypes.BlockNumberOrHashWithNumber(ctypes.LatestBlockNumber)
+	call := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, _, err := doCall(ctx, getMockTx(), latest)
+		return err
+	}
+	// the executions given up on keep running, holding their slots
+	for i := 0; i < maxExecutions; i++ {
+		assert.Equal(t, context.DeadlineExceeded, call())
+	}
+	assert.Equal(t, context.DeadlineExceeded, call())
+	assert.Equal(t, int32(maxExecutions), atomic.LoadInt32(&started))
+
+	close(release)
+	for i := 0; len(executions) > 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Equal(t, 0, len(executions))
+	assert.NoError(t, call())
+}
+
+func TestCallReverted(t *testing.T) {
+	payload := fmt.Sprintf(`{"jsonrpc": "2.0", "method": "eth_call", "id": 1, "params": [{
+              "from": "%s",
+              "to": "%s"}, "latest"]}`, request.from, request.to)
+	// Panic(uint256) of assert(false)
+	panicked := getBytes("0x4e487b71" +
+		"0000000000000000000000000000000000000000000000000000000000000001")
+	tests := []struct {
+		result     []byte
+		wantReturn string
+	}{
+		{panicked, `{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted: assert(false)","data":{"data":"` + cmn.Ghex.EncodeToString(panicked) + `","reason":"assert(false)"}}}`},
+		{getBytes("0x01"), `{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted","data":{"data":"0x01"}}}`},
+		{nil, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"execution failed"}}`},
+	}
+
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetCurrentBlock", func(*repository.Repository) *crafttypes.Block {
+		return getMockBlock()
+	})
+	monkey.Patch(repository.NewRepositoryByBlockHash, func(crafttypes.Hash) (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetNonce", func(*repository.Repository, types.Address) uint64 {
+		return uint64(0)
+	})
+	defer monkey.UnpatchAll()
+
+	mux := testMux()
+	for i, tt := range tests {
+		tt := tt
+		monkey.Patch(worker.ApplyTransaction, func(types.Address, *types.Header, *repository.Repository, *crafttypes.Transaction, *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+			return tt.result, 21000, true, nil, types.Address{}
+		})
+
+		req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader(payload))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		recv := new(rpctypes.RPCResponse)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), recv), "#%d", i)
+		b, _ := json.Marshal(recv)
+		assert.Equal(t, tt.wantReturn, string(b), "#%d", i)
+	}
+}
+
+func TestReceiptRevertReason(t *testing.T) {
+	tx := getMockTx()
+	block := getMockBlock()
+	block.Transactions = []*crafttypes.Transaction{getMockTx(), tx}
+	reverted := getBytes("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"6e6f000000000000000000000000000000000000000000000000000000000000")
+
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetTransactionByHash", func(*repository.Repository, crafttypes.Hash) (*crafttypes.Transaction, crafttypes.Hash, uint64, uint64, error) {
+		return tx, block.HeaderHash, 12, 1, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByTxHash", func(*repository.Repository, crafttypes.Hash) (*crafttypes.Receipt, crafttypes.Hash, uint64, uint64, error) {
+		return &crafttypes.Receipt{Status: 0}, block.HeaderHash, 12, 1, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetReceiptByBlockHash", func(*repository.Repository, crafttypes.Hash) []*crafttypes.Receipt {
+		return nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBlockByHash", func(*repository.Repository, crafttypes.Hash) (*crafttypes.Block, error) {
+		return block, nil
+	})
+	var stateOf crafttypes.Hash
+	monkey.Patch(repository.NewRepositoryByBlockHash, func(hash crafttypes.Hash) (*repository.Repository, error) {
+		stateOf = hash
+		return b, nil
+	})
+	var replayed []*crafttypes.Transaction
+	monkey.Patch(worker.ApplyTransaction, func(_ types.Address, _ *types.Header, _ *repository.Repository, applied *crafttypes.Transaction, _ *common.GasPool) ([]byte, uint64, bool, error, types.Address) {
+		replayed = append(replayed, applied)
+		if applied == tx {
+			return reverted, 21000, true, nil, types.Address{}
+		}
+		return nil, 21000, false, nil, types.Address{}
+	})
+	defer monkey.UnpatchAll()
+
+	// left out unless failed transactions are replayed
+	receipt, err := GetTransactionReceipt(cmn.Hash{})
+	require.NoError(t, err)
+	assert.Empty(t, receipt.RevertReason)
+	assert.Empty(t, replayed)
+
+	ReceiptRevertReason = true
+	defer func() { ReceiptRevertReason = false }()
+	receipt, err = GetTransactionReceipt(cmn.Hash{})
+	require.NoError(t, err)
+	assert.Equal(t, "no", receipt.RevertReason)
+	// replayed on the state of the parent, after the transactions before it
+	assert.Equal(t, block.Header.PrevBlockHash, stateOf)
+	assert.Equal(t, block.Transactions, replayed)
 }
 
 func getBytes(input string) []byte {
@@ -0,0 +1,160 @@
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DSiSc/craft/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultTxQueueDepth is the number of submitted transactions queued for
+	// the gossip switch.
+	DefaultTxQueueDepth = 1024
+	// DefaultTxQueueTimeout is how long a submission waits for room in a
+	// full queue.
+	DefaultTxQueueTimeout = 2 * time.Second
+)
+
+var (
+	errSwitchUnavailable = errors.New("transaction switch unavailable")
+	errTxQueueFull       = errors.New("transaction queue full, try again later")
+)
+
+// TxQueue queues the submitted transactions for the gossip switch, so a
+// stalled switch fails submissions after a timeout instead of blocking them.
+type TxQueue struct {
+	queue   chan interface{}
+	timeout time.Duration
+
+	mtx  sync.Mutex
+	quit chan struct{} // stops the forwarding to the switch, nil without
+	done chan struct{}
+}
+
+// NewTxQueue returns a queue of depth transactions, whose submissions wait
+// for room for timeout.
+func NewTxQueue(depth int, timeout time.Duration) *TxQueue {
+	return &TxQueue{
+		queue:   make(chan interface{}, depth),
+		timeout: timeout,
+	}
+}
+
+// SetSwitch forwards the queued transactions to ch, in place of the previous
+// switch. A nil ch stops the forwarding, failing the submissions.
+func (q *TxQueue) SetSwitch(ch chan<- interface{}) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.quit != nil {
+		close(q.quit)
+		<-q.done
+		q.quit, q.done = nil, nil
+	}
+	if ch != nil {
+		q.quit, q.done = make(chan struct{}), make(chan struct{})
+		go q.forward(ch, q.quit, q.done)
+	}
+}
+
+func (q *TxQueue) forward(ch chan<- interface{}, quit, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-quit:
+			return
+		case tx := <-q.queue:
+			select {
+			case ch <- tx:
+			case <-quit:
+				// the switch was replaced while stalled, leave tx to the next one
+				select {
+				case q.queue <- tx:
+				default:
+					log.Warn("Dropping queued transaction, as: %v", errTxQueueFull)
+				}
+				return
+			}
+		}
+	}
+}
+
+// Submit queues tx for the switch, waiting for room at most the timeout of
+// the queue.
+func (q *TxQueue) Submit(tx interface{}) error {
+	q.mtx.Lock()
+	available := q.quit != nil
+	q.mtx.Unlock()
+	if !available {
+		return errSwitchUnavailable
+	}
+	select {
+	case q.queue <- tx:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(q.timeout)
+	defer timer.Stop()
+	select {
+	case q.queue <- tx:
+		return nil
+	case <-timer.C:
+		return errTxQueueFull
+	}
+}
+
+// Len returns the number of transactions queued.
+func (q *TxQueue) Len() int {
+	return len(q.queue)
+}
+
+var (
+	txQueueMtx sync.Mutex
+	txQueue    = NewTxQueue(DefaultTxQueueDepth, DefaultTxQueueTimeout)
+	swch       chan<- interface{}
+)
+
+// SetSwCh sets the gossip switch the submitted transactions are forwarded
+// to.
+func SetSwCh(ch chan<- interface{}) {
+	txQueueMtx.Lock()
+	defer txQueueMtx.Unlock()
+	swch = ch
+	txQueue.SetSwitch(ch)
+}
+
+// SetTxQueue sets the depth of the queue of the submitted transactions and
+// how long submissions wait for room in it. The transactions queued are
+// moved over.
+func SetTxQueue(depth int, timeout time.Duration) {
+	txQueueMtx.Lock()
+	defer txQueueMtx.Unlock()
+	old := txQueue
+	old.SetSwitch(nil)
+	txQueue = NewTxQueue(depth, timeout)
+	for n := old.Len(); n > 0; n-- {
+		tx := <-old.queue
+		select {
+		case txQueue.queue <- tx:
+		default:
+			log.Warn("Dropping queued transaction, as: %v", errTxQueueFull)
+		}
+	}
+	txQueue.SetSwitch(swch)
+}
+
+// submitTx queues tx for the gossip switch.
+func submitTx(tx interface{}) error {
+	txQueueMtx.Lock()
+	q := txQueue
+	txQueueMtx.Unlock()
+	return q.Submit(tx)
+}
+
+// txQueueLen returns the number of transactions queued for the switch.
+func txQueueLen() float64 {
+	txQueueMtx.Lock()
+	defer txQueueMtx.Unlock()
+	return float64(txQueue.Len())
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitTaken waits for the forwarding of q to take what was queued.
+func waitTaken(t *testing.T, q *TxQueue) {
+	for i := 0; q.Len() > 0; i++ {
+		require.True(t, i < 100, "queue not drained")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTxQueue(t *testing.T) {
+	q := NewTxQueue(2, 50*time.Millisecond)
+	assert.Equal(t, errSwitchUnavailable, q.Submit(1))
+
+	// the switch stalls
+	ch := make(chan interface{})
+	q.SetSwitch(ch)
+	defer q.SetSwitch(nil)
+	require.NoError(t, q.Submit(1))
+	waitTaken(t, q)
+	require.NoError(t, q.Submit(2))
+	require.NoError(t, q.Submit(3))
+	assert.Equal(t, 2, q.Len())
+	begin := time.Now()
+	assert.Equal(t, errTxQueueFull, q.Submit(4))
+	assert.True(t, time.Since(begin) >= 50*time.Millisecond)
+
+	for _, want := range []int{1, 2, 3} {
+		assert.Equal(t, want, <-ch)
+	}
+	waitTaken(t, q)
+	require.NoError(t, q.Submit(4))
+	assert.Equal(t, 4, <-ch)
+}
+
+func TestTxQueueSwitchReplaced(t *testing.T) {
+	q := NewTxQueue(2, 50*time.Millisecond)
+	q.SetSwitch(make(chan interface{}))
+	require.NoError(t, q.Submit(1))
+	waitTaken(t, q)
+
+	// what the stalled switch didn't take goes to the next one
+	ch := make(chan interface{}, 1)
+	q.SetSwitch(ch)
+	defer q.SetSwitch(nil)
+	assert.Equal(t, 1, <-ch)
+
+	q.SetSwitch(nil)
+	assert.Equal(t, errSwitchUnavailable, q.Submit(2))
+}
+
+func TestSetTxQueue(t *testing.T) {
+	defer SetSwCh(nil)
+	defer SetTxQueue(DefaultTxQueueDepth, DefaultTxQueueTimeout)
+
+	SetSwCh(nil)
+	assert.Equal(t, errSwitchUnavailable, submitTx(1))
+
+	ch := make(chan interface{})
+	SetSwCh(ch)
+	SetTxQueue(1, 10*time.Millisecond)
+	require.NoError(t, submitTx(1))
+	assert.Equal(t, 1, <-ch)
+
+	// the queued transactions move to the new queue
+	SetSwCh(nil)
+	txQueue.queue <- 2
+	SetTxQueue(2, 10*time.Millisecond)
+	assert.Equal(t, float64(1), txQueueLen())
+	SetSwCh(ch)
+	assert.Equal(t, 2, <-ch)
+}
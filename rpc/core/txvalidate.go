@@ -0,0 +1,80 @@
+package core
+
+import (
+	"math/big"
+
+	apitypes "github.com/DSiSc/apigateway/core/types"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/repository"
+	"github.com/pkg/errors"
+)
+
+// The errors of the transactions rejected before reaching the switch, those
+// of Ethereum clients.
+var (
+	errOversizedData     = errors.New("oversized data")
+	errInvalidChainID    = errors.New("invalid chain id for signer")
+	errUnderpriced       = errors.New("transaction underpriced")
+	errNonceTooLow       = errors.New("nonce too low")
+	errNonceTooHigh      = errors.New("nonce too high")
+	errInsufficientFunds = errors.New("insufficient funds for gas * price + value")
+)
+
+// MaxTxSize is the size in bytes of the largest encoded transaction
+// accepted.
+var MaxTxSize uint64 = 32 * 1024
+
+// MinGasPrice is the lowest gas price of the transactions accepted.
+var MinGasPrice = new(big.Int).SetUint64(apitypes.DefaultGasPrice)
+
+// maxNonceGap is how far past the next nonce of its sender the nonce of a
+// transaction may be, the rest never being mined in time.
+const maxNonceGap = 64
+
+// checkChainID rejects tx if signed for another chain than chainID. Unsigned
+// and pre-EIP-155 transactions are left to the signer.
+func checkChainID(tx *crafttypes.Transaction, chainID uint64) error {
+	id := signedChainID(tx)
+	if id != nil && id.Cmp(new(big.Int).SetUint64(chainID)) != 0 {
+		return errInvalidChainID
+	}
+	return nil
+}
+
+// signedChainID returns the chain ID tx is signed for as of EIP-155, nil if
+// unsigned or signed for any chain.
+func signedChainID(tx *crafttypes.Transaction) *big.Int {
+	v := tx.Data.V
+	if v == nil || v.Cmp(big.NewInt(28)) <= 0 {
+		return nil
+	}
+	// V is chainID * 2 + 35 or 36
+	id := new(big.Int).Sub(v, big.NewInt(35))
+	return id.Rsh(id, 1)
+}
+
+// validateTx rejects tx, sent by from, if it can't be mined: underpriced,
+// with a nonce used or far ahead, or costing more than the balance of from.
+func validateTx(tx *crafttypes.Transaction, from crafttypes.Address) error {
+	if tx.Data.Price == nil || tx.Data.Price.Cmp(MinGasPrice) < 0 {
+		return errUnderpriced
+	}
+	bc, err := repository.NewLatestStateRepository()
+	if err != nil {
+		return err
+	}
+	if tx.Data.AccountNonce < bc.GetNonce(from) {
+		return errNonceTooLow
+	}
+	if tx.Data.AccountNonce > nextNonce(bc, from)+maxNonceGap {
+		return errNonceTooHigh
+	}
+	cost := new(big.Int).Mul(tx.Data.Price, new(big.Int).SetUint64(tx.Data.GasLimit))
+	if tx.Data.Amount != nil {
+		cost.Add(cost, tx.Data.Amount)
+	}
+	if balance := bc.GetBalance(from); balance == nil || balance.Cmp(cost) < 0 {
+		return errInsufficientFunds
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	crafttypes "github.com/DSiSc/craft/types"
+	"github.com/DSiSc/monkey"
+	"github.com/DSiSc/repository"
+	"github.com/DSiSc/txpool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckChainID(t *testing.T) {
+	tests := []struct {
+		v       *big.Int
+		chainID uint64
+		wantErr error
+	}{
+		{nil, 5, nil},
+		{big.NewInt(27), 5, nil}, // pre-EIP-155
+		{big.NewInt(5*2 + 35), 5, nil},
+		{big.NewInt(5*2 + 36), 5, nil},
+		{big.NewInt(6*2 + 35), 5, errInvalidChainID},
+		{big.NewInt(5*2 + 35), 6, errInvalidChainID},
+	}
+	for i, tt := range tests {
+		tx := &crafttypes.Transaction{Data: crafttypes.TxData{V: tt.v}}
+		assert.Equal(t, tt.wantErr, checkChainID(tx, tt.chainID), "#%d", i)
+	}
+}
+
+func TestValidateTx(t *testing.T) {
+	monkey.Patch(repository.NewLatestStateRepository, func() (*repository.Repository, error) {
+		return b, nil
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetNonce", func(*repository.Repository, crafttypes.Address) uint64 {
+		return 10
+	})
+	monkey.PatchInstanceMethod(reflect.TypeOf(b), "GetBalance", func(*repository.Repository, crafttypes.Address) *big.Int {
+		return big.NewInt(100000)
+	})
+	monkey.Patch(txpool.GetPoolNonce, func(crafttypes.Address) uint64 {
+		return 12
+	})
+	defer monkey.UnpatchAll()
+
+	tests := []struct {
+		nonce   uint64
+		price   int64
+		amount  int64
+		wantErr error
+	}{
+		{10, 1, 10, nil},
+		{9, 1, 10, errNonceTooLow},
+		{13 + maxNonceGap, 1, 10, nil}, // 13 after the pool
+		{14 + maxNonceGap, 1, 10, errNonceTooHigh},
+		{10, 0, 10, errUnderpriced},
+		{10, 4, 16000, nil},
+		{10, 4, 16001, errInsufficientFunds},
+	}
+	for i, tt := range tests {
+		tx := &crafttypes.Transaction{Data: crafttypes.TxData{
+			AccountNonce: tt.nonce,
+			Price:        big.NewInt(tt.price),
+			GasLimit:     21000,
+			Amount:       big.NewInt(tt.amount),
+		}}
+		assert.Equal(t, tt.wantErr, validateTx(tx, crafttypes.Address{0x01}), "#%d", i)
+	}
+}
+
+func TestSendRawTransactionOversized(t *testing.T) {
+	_, err := SendRawTransaction(make(cmn.Bytes, MaxTxSize+1))
+	assert.Equal(t, errOversizedData, err)
+}
@@ -1,8 +1,14 @@
 package core_types
 
 import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
 	"github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/apigateway/core/accounts"
 	"github.com/DSiSc/apigateway/core/types"
+	"github.com/pkg/errors"
 )
 
 // SendTxArgs represents the arguments to sumbit a new transaction into the transaction pool.
@@ -22,3 +28,102 @@ type SendTxArgs struct {
 type StringArgs struct {
 	From string `json:"from"`
 }
+
+// FilterArgs are the criteria of eth_getLogs.
+type FilterArgs struct {
+	BlockHash *common.Hash       `json:"blockHash"`
+	FromBlock *types.BlockNumber `json:"fromBlock"`
+	ToBlock   *types.BlockNumber `json:"toBlock"`
+	// Addresses is given as a single address or a list of them.
+	Addresses []types.Address `json:"address"`
+	// Topics holds the alternatives of each position, each given as null, a
+	// single topic or a list of them.
+	Topics [][]common.Hash `json:"topics"`
+}
+
+// UnmarshalJSON accepts the single values and nulls clients send in place
+// of lists of addresses and topics.
+func (args *FilterArgs) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		BlockHash *common.Hash       `json:"blockHash"`
+		FromBlock *types.BlockNumber `json:"fromBlock"`
+		ToBlock   *types.BlockNumber `json:"toBlock"`
+		Addresses json.RawMessage    `json:"address"`
+		Topics    []json.RawMessage  `json:"topics"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	args.BlockHash, args.FromBlock, args.ToBlock = raw.BlockHash, raw.FromBlock, raw.ToBlock
+
+	args.Addresses = nil
+	if err := unmarshalOneOrMany(raw.Addresses, &args.Addresses); err != nil {
+		return errors.Wrap(err, "invalid address")
+	}
+	args.Topics = make([][]common.Hash, len(raw.Topics))
+	for i, topic := range raw.Topics {
+		if err := unmarshalOneOrMany(topic, &args.Topics[i]); err != nil {
+			return errors.Wrapf(err, "invalid topic %d", i)
+		}
+	}
+	return nil
+}
+
+// unmarshalOneOrMany decodes data, a JSON value or list of values, to the
+// slice list points to. null or an empty data leave it empty.
+func unmarshalOneOrMany(data json.RawMessage, list interface{}) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if data[0] == '[' {
+		return json.Unmarshal(data, list)
+	}
+	slice := reflect.ValueOf(list).Elem()
+	elem := reflect.New(slice.Type().Elem())
+	if err := json.Unmarshal(data, elem.Interface()); err != nil {
+		return err
+	}
+	slice.Set(reflect.Append(slice, elem.Elem()))
+	return nil
+}
+
+// Seconds is a duration in seconds, given as a number or a hex quantity.
+type Seconds uint64
+
+// UnmarshalJSON accepts the numbers of web3 and the quantities of the other
+// clients.
+func (s *Seconds) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var q common.Uint64
+		if err := q.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		*s = Seconds(q)
+		return nil
+	}
+	var n uint64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return errors.Wrap(err, "invalid duration")
+	}
+	*s = Seconds(n)
+	return nil
+}
+
+// TypedDataArgs is the typed data of eth_signTypedData_v4, given as an
+// object or, as MetaMask sends it, as its JSON encoding.
+type TypedDataArgs struct {
+	accounts.TypedData
+}
+
+// UnmarshalJSON decodes the typed data or the string holding it.
+func (args *TypedDataArgs) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		data = []byte(s)
+	}
+	return json.Unmarshal(data, &args.TypedData)
+}
@@ -1,32 +1,65 @@
 package core_types
 
 import (
+	"encoding/json"
+
 	cmn "github.com/DSiSc/apigateway/common"
 	apitypes "github.com/DSiSc/apigateway/core/types"
-	"github.com/DSiSc/craft/types"
 )
 
 type ResultEcho struct {
 	Value string `json:"value"`
 }
 
+// Blockdata is the block object of the Ethereum JSON-RPC. Hash and nonce are
+// null for the pending block.
 type Blockdata struct {
-	Number           cmn.Uint64          `json:"number"`
-	Hash             cmn.Hash            `json:"hash"`
-	ParentHash       cmn.Hash            `json:"parentHash"`
-	MixHash          cmn.Hash            `json:"mixHash"`
-	StateRoot        cmn.Hash            `json:"stateRoot"`
-	Miner            apitypes.Address    `json:"miner"`
-	Timestamp        cmn.Uint64          `json:"timestamp"`
-	TransactionsRoot cmn.Hash            `json:"transactionsRoot"`
-	ReceiptsRoot     cmn.Hash            `json:"receiptsRoot"`
-	Transactions     []*BlockTransaction `json:"transactions"`
-	GasLimit         cmn.Uint64          `json:"gasLimit"`
+	Number           cmn.Uint64        `json:"number"`
+	Hash             *cmn.Hash         `json:"hash"`
+	ParentHash       cmn.Hash          `json:"parentHash"`
+	Nonce            *cmn.Bytes        `json:"nonce"`
+	Sha3Uncles       cmn.Hash          `json:"sha3Uncles"`
+	LogsBloom        cmn.Bytes         `json:"logsBloom"`
+	TransactionsRoot cmn.Hash          `json:"transactionsRoot"`
+	StateRoot        cmn.Hash          `json:"stateRoot"`
+	ReceiptsRoot     cmn.Hash          `json:"receiptsRoot"`
+	Miner            apitypes.Address  `json:"miner"`
+	Difficulty       *cmn.Big          `json:"difficulty"`
+	TotalDifficulty  *cmn.Big          `json:"totalDifficulty"`
+	ExtraData        cmn.Bytes         `json:"extraData"`
+	Size             cmn.Uint64        `json:"size"`
+	GasLimit         cmn.Uint64        `json:"gasLimit"`
+	GasUsed          cmn.Uint64        `json:"gasUsed"`
+	Timestamp        cmn.Uint64        `json:"timestamp"`
+	Transactions     BlockTransactions `json:"transactions"`
+	Uncles           []cmn.Hash        `json:"uncles"`
+	MixHash          cmn.Hash          `json:"mixHash"`
+}
+
+// BlockTransactions are the transactions of a block object, their hashes or
+// the full objects.
+type BlockTransactions struct {
+	Hashes []cmn.Hash
+	Full   []*RPCTransaction
+}
+
+// MarshalJSON encodes the full objects if any, else the hashes.
+func (t BlockTransactions) MarshalJSON() ([]byte, error) {
+	switch {
+	case len(t.Full) > 0:
+		return json.Marshal(t.Full)
+	case len(t.Hashes) > 0:
+		return json.Marshal(t.Hashes)
+	}
+	return []byte("[]"), nil
 }
 
+// RPCTransaction is the transaction object of the Ethereum JSON-RPC, a
+// legacy one. The block fields are null for pending transactions, and
+// chainId is left out of those not signed for a chain.
 type RPCTransaction struct {
-	BlockHash        cmn.Hash          `json:"blockHash"`
-	BlockNumber      cmn.Uint64        `json:"blockNumber"`
+	BlockHash        *cmn.Hash         `json:"blockHash"`
+	BlockNumber      *cmn.Uint64       `json:"blockNumber"`
 	From             *apitypes.Address `json:"from"`
 	Gas              cmn.Uint64        `json:"gas"`
 	GasPrice         *cmn.Big          `json:"gasPrice"`
@@ -34,41 +67,58 @@ type RPCTransaction struct {
 	Input            cmn.Bytes         `json:"input"`
 	Nonce            *cmn.Uint64       `json:"nonce"`
 	To               *apitypes.Address `json:"to"`
-	TransactionIndex cmn.Uint          `json:"transactionIndex"`
+	TransactionIndex *cmn.Uint64       `json:"transactionIndex"`
 	Value            *cmn.Big          `json:"value"`
+	Type             cmn.Uint64        `json:"type"`
+	ChainID          *cmn.Big          `json:"chainId,omitempty"`
 	V                *cmn.Big          `json:"v"`
 	R                *cmn.Big          `json:"r"`
 	S                *cmn.Big          `json:"s"`
 }
 
-type BlockTransaction struct {
-	From     *apitypes.Address `json:"from"`
-	Gas      cmn.Uint64        `json:"gas"`
-	GasPrice *cmn.Big          `json:"gasPrice"`
-	Hash     *cmn.Hash         `json:"hash"`
-	Input    cmn.Bytes         `json:"input"`
-	Nonce    *cmn.Uint64       `json:"nonce"`
-	To       *apitypes.Address `json:"to"`
-	Value    *cmn.Big          `json:"value"`
-	V        *cmn.Big          `json:"v"`
-	R        *cmn.Big          `json:"r"`
-	S        *cmn.Big          `json:"s"`
-}
-
+// RPCReceipt is the receipt object of the Ethereum JSON-RPC. Root is left
+// out of the receipts without a post state, and revertReason out of those not
+// replayed.
 type RPCReceipt struct {
+	Type              cmn.Uint64        `json:"type"`
+	TransactionHash   cmn.Hash          `json:"transactionHash"`
+	TransactionIndex  cmn.Uint64        `json:"transactionIndex"`
 	BlockHash         cmn.Hash          `json:"blockHash"`
-	BlockNumber       *cmn.Big          `json:"blockNumber"`
-	TransactionHash   *cmn.Hash         `json:"transactionHash"`
-	TransactionIndex  cmn.Uint          `json:"transactionIndex"`
+	BlockNumber       cmn.Uint64        `json:"blockNumber"`
 	From              *apitypes.Address `json:"from"`
 	To                *apitypes.Address `json:"to"`
-	Root              []byte            `json:"root"`
-	Status            *cmn.Uint64       `json:"status"`
-	GasUsed           *cmn.Uint64       `json:"gasUsed"`
-	CumulativeGasUsed *cmn.Uint64       `json:"cumulativeGasUsed"`
-	LogsBloom         []byte            `json:"logsBloom"`
-	Logs              []*types.Log      `json:"logs"`
+	CumulativeGasUsed cmn.Uint64        `json:"cumulativeGasUsed"`
+	GasUsed           cmn.Uint64        `json:"gasUsed"`
+	EffectiveGasPrice *cmn.Big          `json:"effectiveGasPrice"`
 	ContractAddress   *apitypes.Address `json:"contractAddress"`
+	Logs              []*RPCLog         `json:"logs"`
+	LogsBloom         cmn.Bytes         `json:"logsBloom"`
+	Root              cmn.Bytes         `json:"root,omitempty"`
+	Status            cmn.Uint64        `json:"status"`
+	RevertReason      string            `json:"revertReason,omitempty"`
+}
+
+// RPCLog is the log object of the Ethereum JSON-RPC. TransactionLogIndex is
+// the index of the log in its transaction, where LogIndex is that in its
+// block.
+type RPCLog struct {
+	Removed             bool             `json:"removed"`
+	LogIndex            cmn.Uint64       `json:"logIndex"`
+	TransactionIndex    cmn.Uint64       `json:"transactionIndex"`
+	TransactionHash     cmn.Hash         `json:"transactionHash"`
+	BlockHash           cmn.Hash         `json:"blockHash"`
+	BlockNumber         cmn.Uint64       `json:"blockNumber"`
+	Address             apitypes.Address `json:"address"`
+	Data                cmn.Bytes        `json:"data"`
+	Topics              []cmn.Hash       `json:"topics"`
+	TransactionLogIndex cmn.Uint64       `json:"transactionLogIndex"`
+}
+
+// RevertData is the data of the error of a reverted execution: the bytes it
+// reverted with, and the reason decoded from them if any.
+type RevertData struct {
+	Reason string    `json:"reason,omitempty"`
+	Data   cmn.Bytes `json:"data"`
 }
 
 type NodeInfo struct {
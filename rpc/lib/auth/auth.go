@@ -0,0 +1,220 @@
+// Package rpcauth authenticates RPC clients by API key or JWT and authorizes
+// the method namespaces each of them may call.
+package rpcauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	rpcserver "github.com/DSiSc/apigateway/rpc/lib/server"
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+	craftlog "github.com/DSiSc/craft/log"
+)
+
+const (
+	// APIKeyHeader is the HTTP header carrying a static API key.
+	APIKeyHeader = "X-API-Key"
+	// apiKeyParam and tokenParam carry credentials in the query of websocket
+	// upgrades, as browsers can't set headers on those.
+	apiKeyParam = "apikey"
+	tokenParam  = "token"
+)
+
+// Keys holds the credentials the gateway accepts, as read from the key file.
+//
+// Example:
+//
+//	{
+//	  "apiKeys": {"3b7e5c...": "indexer"},
+//	  "jwtSecret": "a shared HS256 secret",
+//	  "jwtPublicKey": "-----BEGIN PUBLIC KEY-----\n...\n-----END PUBLIC KEY-----\n"
+//	}
+type Keys struct {
+	APIKeys      map[string]string `json:"apiKeys"`      // API key to identity
+	JWTSecret    string            `json:"jwtSecret"`    // HS256 secret, no HS256 tokens if empty
+	JWTPublicKey string            `json:"jwtPublicKey"` // PEM encoded P-256 key, no ES256 tokens if empty
+}
+
+// Policy maps identities to the methods they may call, as read from the
+// policy file. An entry ending in "_" or "*" allows a whole namespace (e.g.
+// "eth_" or "eth_get*"), "*" allows everything and any other entry a single
+// method. Anonymous lists what clients without credentials may call.
+//
+// Example:
+//
+//	{
+//	  "anonymous": ["net_"],
+//	  "identities": {
+//	    "indexer": ["eth_get*", "eth_blockNumber", "net_"],
+//	    "operator": ["*"]
+//	  }
+//	}
+type Policy struct {
+	Anonymous  []string            `json:"anonymous"`
+	Identities map[string][]string `json:"identities"`
+}
+
+// Allowed reports whether identity may call method. The empty identity is
+// the anonymous one.
+func (p Policy) Allowed(identity, method string) bool {
+	namespaces := p.Anonymous
+	if identity != "" {
+		namespaces = p.Identities[identity]
+	}
+	for _, ns := range namespaces {
+		if rpcserver.MatchMethod(ns, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identifies the client of a request and checks its calls
+// against a Policy.
+type Authenticator struct {
+	apiKeys    map[string]string
+	hmacSecret []byte
+	ecKey      *ecdsa.PublicKey
+	policy     Policy
+	now        func() time.Time
+}
+
+// NewAuthenticator returns an Authenticator accepting keys and enforcing policy.
+func NewAuthenticator(keys Keys, policy Policy) (*Authenticator, error) {
+	a := &Authenticator{
+		apiKeys:    keys.APIKeys,
+		hmacSecret: []byte(keys.JWTSecret),
+		policy:     policy,
+		now:        time.Now,
+	}
+	if keys.JWTPublicKey != "" {
+		block, _ := pem.Decode([]byte(keys.JWTPublicKey))
+		if block == nil {
+			return nil, errors.New("jwtPublicKey is not PEM encoded")
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse jwtPublicKey")
+		}
+		ecKey, ok := pub.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return nil, errors.New("jwtPublicKey is not a P-256 key")
+		}
+		a.ecKey = ecKey
+	}
+	return a, nil
+}
+
+// LoadAuthenticator reads the keys and the policy from the given JSON files.
+func LoadAuthenticator(keyFile, policyFile string) (*Authenticator, error) {
+	var keys Keys
+	if err := readJSONFile(keyFile, &keys); err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := readJSONFile(policyFile, &policy); err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(keys, policy)
+}
+
+func readJSONFile(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", path)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errors.Wrapf(err, "failed to parse %s", path)
+	}
+	return nil
+}
+
+// Authenticate returns the identity behind the credentials of r: an API key
+// in the X-API-Key header or a JWT in the Authorization header, or the same
+// in the "apikey" or "token" query params. Requests without credentials
+// are anonymous, with the empty identity.
+func (a *Authenticator) Authenticate(r *http.Request) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return a.authenticateAPIKey(key)
+	}
+	if authz := r.Header.Get("Authorization"); authz != "" {
+		if !strings.HasPrefix(authz, "Bearer ") {
+			return "", errors.New("unsupported authorization scheme")
+		}
+		return verifyJWT(strings.TrimPrefix(authz, "Bearer "), a.hmacSecret, a.ecKey, a.now())
+	}
+	query := r.URL.Query()
+	if key := query.Get(apiKeyParam); key != "" {
+		return a.authenticateAPIKey(key)
+	}
+	if token := query.Get(tokenParam); token != "" {
+		return verifyJWT(token, a.hmacSecret, a.ecKey, a.now())
+	}
+	return "", nil
+}
+
+func (a *Authenticator) authenticateAPIKey(key string) (string, error) {
+	// compare against every key, so the time taken tells nothing about them
+	var identity string
+	for k, id := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			identity = id
+		}
+	}
+	if identity == "" {
+		return "", errors.New("invalid API key")
+	}
+	return identity, nil
+}
+
+// Interceptor authenticates the client of every call and rejects the calls
+// its identity is not allowed to make. The identity is passed on in the
+// context of the call, see IdentityFromContext.
+func (a *Authenticator) Interceptor() rpcserver.Interceptor {
+	return func(ctx context.Context, call *rpcserver.Call, next rpcserver.Handler) (interface{}, error) {
+		identity, err := a.Authenticate(call.HTTPRequest)
+		if err != nil {
+			return nil, types.RPCUnauthorizedError(call.Request.ID, err).Error
+		}
+		if !a.policy.Allowed(identity, call.Request.Method) {
+			craftlog.DebugKV("Denied RPC call", map[string]interface{}{"identity": identity, "method": call.Request.Method})
+			return nil, types.RPCForbiddenError(call.Request.ID, call.Request.Method).Error
+		}
+		return next(context.WithValue(ctx, identityKey{}, identity), call)
+	}
+}
+
+// UpgradeHandler rejects websocket upgrades with invalid credentials before
+// passing them on to next.
+func (a *Authenticator) UpgradeHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := a.Authenticate(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity of the client making a call, as
+// set by the Interceptor. It is empty for anonymous clients.
+func IdentityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey{}).(string)
+	return identity
+}
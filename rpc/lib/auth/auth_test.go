@@ -0,0 +1,199 @@
+package rpcauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/go-amino"
+
+	"github.com/DSiSc/apigateway/log"
+	rpcserver "github.com/DSiSc/apigateway/rpc/lib/server"
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+)
+
+const testSecret = "test-secret"
+
+var testPolicy = Policy{
+	Anonymous: []string{"net_"},
+	Identities: map[string][]string{
+		"indexer":  {"eth_get*", "eth_blockNumber"},
+		"operator": {"*"},
+	},
+}
+
+func signHS256(t *testing.T, claims map[string]interface{}) string {
+	signing := jwtSigningInput(t, "HS256", claims)
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(signing))
+	return signing + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, claims map[string]interface{}) string {
+	signing := jwtSigningInput(t, "ES256", claims)
+	digest := sha256.Sum256([]byte(signing))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	sig := make([]byte, 64)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(sig[32-len(rb):32], rb)
+	copy(sig[64-len(sb):], sb)
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func jwtSigningInput(t *testing.T, alg string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func newTestAuthenticator(t *testing.T) (*Authenticator, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	keys := Keys{
+		APIKeys:      map[string]string{"indexer-key": "indexer"},
+		JWTSecret:    testSecret,
+		JWTPublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+	a, err := NewAuthenticator(keys, testPolicy)
+	require.NoError(t, err)
+	return a, key
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	tests := []struct {
+		identity string
+		method   string
+		allowed  bool
+	}{
+		{"", "net_version", true},
+		{"", "eth_blockNumber", false},
+		{"indexer", "eth_getTransactionReceipt", true},
+		{"indexer", "eth_blockNumber", true},
+		{"indexer", "eth_blockNumberX", false},
+		{"indexer", "eth_sendTransaction", false},
+		{"indexer", "net_version", false},
+		{"operator", "eth_sendTransaction", true},
+		{"unknown", "net_version", false},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.allowed, testPolicy.Allowed(tt.identity, tt.method), "#%d: %s calling %s", i, tt.identity, tt.method)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a, key := newTestAuthenticator(t)
+	now := time.Unix(1500000000, 0)
+	a.now = func() time.Time { return now }
+
+	valid := map[string]interface{}{"sub": "operator", "exp": now.Unix() + 60}
+	expired := map[string]interface{}{"sub": "operator", "exp": now.Unix()}
+	early := map[string]interface{}{"sub": "operator", "nbf": now.Unix() + 60}
+	tampered := signHS256(t, valid)
+	tampered = tampered[:len(tampered)-2] + "AA"
+
+	tests := []struct {
+		header, value string
+		query         string
+		wantIdentity  string
+		wantErr       string
+	}{
+		{"", "", "", "", ""},
+		{APIKeyHeader, "indexer-key", "", "indexer", ""},
+		{APIKeyHeader, "wrong-key", "", "", "invalid API key"},
+		{"Authorization", "Bearer " + signHS256(t, valid), "", "operator", ""},
+		{"Authorization", "Bearer " + signES256(t, key, valid), "", "operator", ""},
+		{"Authorization", "Bearer " + signHS256(t, expired), "", "", "expired"},
+		{"Authorization", "Bearer " + signHS256(t, early), "", "", "not valid yet"},
+		{"Authorization", "Bearer " + signHS256(t, map[string]interface{}{}), "", "", "no subject"},
+		{"Authorization", "Bearer " + tampered, "", "", "invalid token signature"},
+		{"Authorization", "Basic Zm9vOmJhcg==", "", "", "unsupported authorization scheme"},
+		{"", "", "?apikey=indexer-key", "indexer", ""},
+		{"", "", "?token=" + signES256(t, key, valid), "operator", ""},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest("POST", "http://localhost/"+tt.query, nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		identity, err := a.Authenticate(r)
+		if tt.wantErr != "" {
+			require.Error(t, err, "#%d", i)
+			assert.Contains(t, err.Error(), tt.wantErr, "#%d", i)
+			continue
+		}
+		require.NoError(t, err, "#%d", i)
+		assert.Equal(t, tt.wantIdentity, identity, "#%d", i)
+	}
+}
+
+func TestInterceptor(t *testing.T) {
+	a, _ := newTestAuthenticator(t)
+	funcMap := map[string]*rpcserver.RPCFunc{
+		"eth_blockNumber":     rpcserver.NewRPCFunc(func() (string, error) { return "0x1", nil }, ""),
+		"eth_sendTransaction": rpcserver.NewRPCFunc(func() (string, error) { return "0x2", nil }, ""),
+	}
+	mux := http.NewServeMux()
+	rpcserver.RegisterRPCFuncs(mux, funcMap, amino.NewCodec(), log.TestingLogger(), rpcserver.HTTPInterceptors(a.Interceptor()))
+
+	tests := []struct {
+		method   string
+		apiKey   string
+		wantCode int
+	}{
+		{"eth_blockNumber", "indexer-key", 0},
+		{"eth_sendTransaction", "indexer-key", -32003},
+		{"eth_blockNumber", "", -32003},
+		{"eth_blockNumber", "wrong-key", -32001},
+	}
+	for i, tt := range tests {
+		body := `{"jsonrpc": "2.0", "id": "0", "method": "` + tt.method + `"}`
+		req := httptest.NewRequest("POST", "http://localhost/", strings.NewReader(body))
+		if tt.apiKey != "" {
+			req.Header.Set(APIKeyHeader, tt.apiKey)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		recv := new(types.RPCResponse)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), recv), "#%d", i)
+		if tt.wantCode == 0 {
+			assert.Nil(t, recv.Error, "#%d: not expecting an error", i)
+		} else {
+			require.NotNil(t, recv.Error, "#%d: expecting an error", i)
+			assert.Equal(t, tt.wantCode, recv.Error.Code, "#%d", i)
+		}
+	}
+}
+
+func TestUpgradeHandler(t *testing.T) {
+	a, _ := newTestAuthenticator(t)
+	handler := a.UpgradeHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusSwitchingProtocols)
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://localhost/websocket?apikey=wrong-key", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "http://localhost/websocket?apikey=indexer-key", nil))
+	assert.Equal(t, http.StatusSwitchingProtocols, rec.Code)
+}
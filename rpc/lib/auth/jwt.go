@@ -0,0 +1,92 @@
+package rpcauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// jwtClaims holds the registered claims the gateway looks at.
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+}
+
+// verifyJWT checks the signature and validity period of a compact serialized
+// JWT and returns its subject. Only HS256 tokens signed with hmacSecret and
+// ES256 tokens signed by ecKey are accepted.
+func verifyJWT(token string, hmacSecret []byte, ecKey *ecdsa.PublicKey, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return "", errors.Wrap(err, "malformed token header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.Wrap(err, "malformed token signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	switch header.Alg {
+	case "HS256":
+		if len(hmacSecret) == 0 {
+			return "", errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, hmacSecret)
+		mac.Write([]byte(parts[0] + "." + parts[1])) // nolint: errcheck
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return "", errors.New("invalid token signature")
+		}
+	case "ES256":
+		if ecKey == nil {
+			return "", errors.New("ES256 tokens are not accepted")
+		}
+		if len(sig) != 64 {
+			return "", errors.New("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return "", errors.New("invalid token signature")
+		}
+	default:
+		return "", errors.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return "", errors.Wrap(err, "malformed token claims")
+	}
+	unix := float64(now.Unix())
+	if claims.ExpiresAt != nil && unix >= *claims.ExpiresAt {
+		return "", errors.New("token is expired")
+	}
+	if claims.NotBefore != nil && unix < *claims.NotBefore {
+		return "", errors.New("token is not valid yet")
+	}
+	if claims.Subject == "" {
+		return "", errors.New("token has no subject")
+	}
+	return claims.Subject, nil
+}
+
+func decodeJWTSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
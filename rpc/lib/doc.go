@@ -45,11 +45,18 @@ With the above saved in file `data.json`, we can make the request with
 curl --data @data.json http://localhost:8008
 ```
 
+Several calls can be sent at once as a JSON array of such requests (a batch).
+Each call is answered by its own element of the response array; notifications
+(requests without an "id") are left out of the reply.
+
 ## WebSocket (JSONRPC)
 
 All requests are exposed over websocket in the same form as the POST JSONRPC.
 Websocket connections are available at their own endpoint, typically `/websocket`,
 though this is configurable when starting the server.
+Batches are accepted as well. Requests received on one connection are executed
+in parallel by a bounded pool of workers (see `MaxConcurrentRequests`), so
+responses may arrive out of order and must be matched by their "id".
 
 # Server Definition
 
@@ -94,6 +101,66 @@ Note that unix sockets are supported as well (eg. `/path/to/socket` instead of `
 Now see all available endpoints by sending a GET request to `0.0.0.0:8008`.
 Each route is available as a GET request, as a JSONRPCv2 POST request, and via JSONRPCv2 over websockets.
 
+Every call, whatever its transport, can be wrapped by interceptors, e.g. for
+authentication, metrics or caching:
+
+```
+logCalls := func(ctx context.Context, call *rpcserver.Call, next rpcserver.Handler) (interface{}, error) {
+	result, err := next(ctx, call)
+	fmt.Println(call.Transport, call.Request.Method, err)
+	return result, err
+}
+rpcserver.RegisterRPCFuncs(mux, Routes, cdc, logger, rpcserver.HTTPInterceptors(logCalls))
+wm := rpcserver.NewWebsocketManager(Routes, cdc, rpcserver.Interceptors(logCalls))
+```
+
+The rpcauth package provides such an interceptor: it identifies clients by an API key
+(`X-API-Key` header or `apikey` query param) or a HS256/ES256 JWT (`Authorization: Bearer`
+header or `token` query param), and checks the methods they call against a policy. Its
+`UpgradeHandler` rejects websocket upgrades carrying invalid credentials.
+
+```
+auth, err := rpcauth.LoadAuthenticator("keys.json", "policy.json")
+...
+rpcserver.RegisterRPCFuncs(mux, Routes, cdc, logger, rpcserver.HTTPInterceptors(auth.Interceptor()))
+wm := rpcserver.NewWebsocketManager(Routes, cdc, rpcserver.Interceptors(auth.Interceptor()))
+mux.HandleFunc("/websocket", auth.UpgradeHandler(wm.WebsocketHandler))
+```
+
+The rpclimit package limits the rate of calls with a token bucket per client and method
+class. Clients are keyed by remote IP, by the identity rpcauth found or by both, so its
+interceptor goes after the rpcauth one. Limited calls get a `-32005` error, plus a
+`Retry-After` header over HTTP; websocket messages take tokens from the same buckets.
+
+To serve only some of the methods on a listener, register a filtered function map with
+`rpcserver.FilterFuncMap(Routes, allow, deny)`, e.g. `allow` = `["eth_", "net_"]` and
+`deny` = `["eth_send*"]` for a public read only listener. Patterns are matched by
+`rpcserver.MatchMethod`.
+
+`rpcserver.StartServer` returns a `Server` that can be shut down gracefully: `Shutdown(ctx)`
+waits for the pending HTTP requests, and `WebsocketManager.Shutdown(ctx)` answers the
+pending websocket calls, ends their subscriptions and sends a close frame on every
+connection.
+
+The server records per-method call counts, error codes and latencies, open connections,
+active subscriptions and the websocket write backlog in `rpcmetrics.DefaultRegistry`. Its
+`Handler()` serves them in the Prometheus text format:
+
+```
+mux.Handle("/metrics", rpcmetrics.DefaultRegistry.Handler())
+```
+
+`rpcserver.NewOpenRPCDocument(info, Routes, docs)` describes the methods in an OpenRPC
+document, with the schemas of their params and results generated from the Go types.
+Register the schemas of types with custom JSON encodings with `rpcserver.RegisterSchema`.
+Serve the document with the `rpc.discover` method and at `/openrpc.json`:
+
+```
+doc := rpcserver.NewOpenRPCDocument(info, Routes, docs)
+Routes["rpc.discover"] = rpcserver.NewDiscoverFunc(doc)
+mux.Handle("/openrpc.json", rpcserver.OpenRPCHandler(doc))
+```
+
 
 # Examples
 
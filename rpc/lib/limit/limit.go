@@ -0,0 +1,269 @@
+// Package rpclimit rate limits RPC calls with token buckets per client and
+// method class.
+package rpclimit
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	rpcauth "github.com/DSiSc/apigateway/rpc/lib/auth"
+	rpcserver "github.com/DSiSc/apigateway/rpc/lib/server"
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+	craftlog "github.com/DSiSc/craft/log"
+)
+
+// What clients are told apart by.
+const (
+	KeyByIP     = "ip"     // remote IP address
+	KeyByAPIKey = "apikey" // authenticated identity, remote IP for anonymous clients
+	KeyByBoth   = "both"   // identity and remote IP
+)
+
+// sweepInterval is how often buckets that have filled up again are dropped.
+const sweepInterval = time.Minute
+
+// Rate is the refill rate and the capacity of a token bucket. A zero
+// PerSecond rate is unlimited.
+type Rate struct {
+	PerSecond float64 `json:"perSecond"`
+	Burst     int     `json:"burst"`
+}
+
+// validate returns an error if a bucket of r can't let requests through: a
+// limited rate needs a burst of a token at least.
+func (r Rate) validate() error {
+	if r.PerSecond < 0 {
+		return errors.Errorf("negative rate %v", r.PerSecond)
+	}
+	if r.PerSecond > 0 && r.Burst < 1 {
+		return errors.Errorf("burst %d of rate %v below 1", r.Burst, r.PerSecond)
+	}
+	return nil
+}
+
+// Config sets the limits of each method class. Methods maps methods to
+// their class, entries ending in "_" or "*" match whole namespaces like in
+// rpcauth.Policy. Methods in no class are limited by Default.
+//
+// Example:
+//
+//	{
+//	  "keyBy": "both",
+//	  "default": {"perSecond": 20, "burst": 40},
+//	  "classes": {"call": {"perSecond": 5, "burst": 10}},
+//	  "methods": {"eth_call": "call", "eth_estimateGas": "call"}
+//	}
+type Config struct {
+	KeyBy   string            `json:"keyBy"`
+	Default Rate              `json:"default"`
+	Classes map[string]Rate   `json:"classes"`
+	Methods map[string]string `json:"methods"`
+}
+
+// DefaultConfig returns limits for cheap reads, calls executing
+// transactions and transaction submission, per identity and IP.
+func DefaultConfig() Config {
+	return Config{
+		KeyBy:   KeyByBoth,
+		Default: Rate{PerSecond: 20, Burst: 40},
+		Classes: map[string]Rate{
+			"call":   {PerSecond: 5, Burst: 10},
+			"submit": {PerSecond: 2, Burst: 5},
+		},
+		Methods: map[string]string{
+			"eth_call":               "call",
+			"eth_estimateGas":        "call",
+			"eth_sendTransaction":    "submit",
+			"eth_sendRawTransaction": "submit",
+		},
+	}
+}
+
+// Limiter holds a token bucket for each client and method class.
+type Limiter struct {
+	config Config
+	now    func() time.Time
+
+	mtx       sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+type bucketKey struct {
+	client string
+	class  string
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter enforcing config.
+func NewLimiter(config Config) (*Limiter, error) {
+	switch config.KeyBy {
+	case KeyByIP, KeyByAPIKey, KeyByBoth:
+	case "":
+		config.KeyBy = KeyByBoth
+	default:
+		return nil, errors.Errorf("unknown keyBy %q", config.KeyBy)
+	}
+	if err := config.Default.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid default rate")
+	}
+	for class, rate := range config.Classes {
+		if err := rate.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid rate of class %s", class)
+		}
+	}
+	for method, class := range config.Methods {
+		if _, ok := config.Classes[class]; !ok {
+			return nil, errors.Errorf("method %s is in undefined class %s", method, class)
+		}
+	}
+	return &Limiter{
+		config:    config,
+		now:       time.Now,
+		buckets:   make(map[bucketKey]*bucket),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+// LoadLimiter reads the Config of a Limiter from a JSON file.
+func LoadLimiter(configFile string) (*Limiter, error) {
+	b, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", configFile)
+	}
+	var config Config
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", configFile)
+	}
+	return NewLimiter(config)
+}
+
+// classOf returns the class of method, the empty one for the default.
+// Exact entries win over namespaces, longer namespaces over shorter ones.
+func (l *Limiter) classOf(method string) string {
+	if class, ok := l.config.Methods[method]; ok {
+		return class
+	}
+	var class, longest string
+	for ns, c := range l.config.Methods {
+		if rpcserver.MatchMethod(ns, method) && len(ns) >= len(longest) {
+			class, longest = c, ns
+		}
+	}
+	return class
+}
+
+func (l *Limiter) rateOf(class string) Rate {
+	if class == "" {
+		return l.config.Default
+	}
+	return l.config.Classes[class]
+}
+
+// Take takes a token for a call of method by client. It returns zero if the
+// call may go ahead, or else how long until a token is available.
+func (l *Limiter) Take(client, method string) time.Duration {
+	class := l.classOf(method)
+	rate := l.rateOf(class)
+	if rate.PerSecond <= 0 {
+		return 0
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+	key := bucketKey{client, class}
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(rate.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.refill(now, rate)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / rate.PerSecond * float64(time.Second))
+}
+
+// sweep drops the buckets that are full again, a new bucket is the same.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		rate := l.rateOf(key.class)
+		b.refill(now, rate)
+		if b.tokens >= float64(rate.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (b *bucket) refill(now time.Time, rate Rate) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(rate.Burst), b.tokens+elapsed*rate.PerSecond)
+	}
+	b.last = now
+}
+
+// clientKey returns the key of the client making call. It must run after
+// the rpcauth interceptor to tell identities apart.
+func (l *Limiter) clientKey(ctx context.Context, call *rpcserver.Call) string {
+	ip := remoteIP(call)
+	identity := rpcauth.IdentityFromContext(ctx)
+	switch {
+	case l.config.KeyBy == KeyByIP:
+		return ip
+	case l.config.KeyBy == KeyByAPIKey && identity != "":
+		return "id:" + identity
+	case l.config.KeyBy == KeyByBoth && identity != "":
+		return "id:" + identity + "@" + ip
+	}
+	return ip
+}
+
+func remoteIP(call *rpcserver.Call) string {
+	addr := ""
+	if call.HTTPRequest != nil {
+		addr = call.HTTPRequest.RemoteAddr
+	} else if call.Conn != nil {
+		addr = call.Conn.GetRemoteAddr()
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// Interceptor rejects the calls of clients that ran out of tokens for the
+// class of the method, with a Retry-After header over HTTP. Websocket
+// messages are taken from the same buckets as HTTP requests.
+func (l *Limiter) Interceptor() rpcserver.Interceptor {
+	return func(ctx context.Context, call *rpcserver.Call, next rpcserver.Handler) (interface{}, error) {
+		client := l.clientKey(ctx, call)
+		wait := l.Take(client, call.Request.Method)
+		if wait == 0 {
+			return next(ctx, call)
+		}
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		craftlog.DebugKV("Rate limited RPC call", map[string]interface{}{"client": client, "method": call.Request.Method})
+		if call.ResponseHeader != nil {
+			call.ResponseHeader.Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+		return nil, types.RPCLimitExceededError(call.Request.ID, time.Duration(retryAfter)*time.Second).Error
+	}
+}
@@ -0,0 +1,126 @@
+package rpclimit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/go-amino"
+
+	"github.com/DSiSc/apigateway/log"
+	rpcserver "github.com/DSiSc/apigateway/rpc/lib/server"
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+)
+
+func newTestLimiter(t *testing.T, keyBy string) (*Limiter, *time.Time) {
+	config := DefaultConfig()
+	config.KeyBy = keyBy
+	config.Default = Rate{PerSecond: 1, Burst: 2}
+	config.Classes["free"] = Rate{}
+	config.Methods["net_"] = "free"
+	config.Methods["eth_get*"] = "call"
+	l, err := NewLimiter(config)
+	require.NoError(t, err)
+	now := time.Unix(1500000000, 0)
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+	return l, &now
+}
+
+func TestNewLimiter(t *testing.T) {
+	_, err := NewLimiter(Config{KeyBy: "cookie"})
+	assert.Error(t, err)
+	_, err = NewLimiter(Config{Methods: map[string]string{"eth_call": "call"}})
+	assert.Error(t, err)
+	// a limited rate without burst would reject every request
+	_, err = NewLimiter(Config{Default: Rate{PerSecond: 5}})
+	assert.EqualError(t, err, "invalid default rate: burst 0 of rate 5 below 1")
+	_, err = NewLimiter(Config{Classes: map[string]Rate{"call": {PerSecond: 0.5, Burst: 0}}})
+	assert.EqualError(t, err, "invalid rate of class call: burst 0 of rate 0.5 below 1")
+	_, err = NewLimiter(Config{Default: Rate{PerSecond: -1, Burst: 1}})
+	assert.Error(t, err)
+	l, err := NewLimiter(Config{})
+	require.NoError(t, err)
+	assert.Equal(t, KeyByBoth, l.config.KeyBy)
+}
+
+func TestClassOf(t *testing.T) {
+	l, _ := newTestLimiter(t, KeyByIP)
+	tests := map[string]string{
+		"eth_call":               "call",
+		"eth_getBlockByNumber":   "call",
+		"eth_sendRawTransaction": "submit",
+		"net_version":            "free",
+		"eth_blockNumber":        "",
+	}
+	for method, class := range tests {
+		assert.Equal(t, class, l.classOf(method), method)
+	}
+}
+
+func TestTake(t *testing.T) {
+	l, now := newTestLimiter(t, KeyByIP)
+
+	// the burst goes through, then one token per second
+	assert.Zero(t, l.Take("1.2.3.4", "eth_blockNumber"))
+	assert.Zero(t, l.Take("1.2.3.4", "eth_blockNumber"))
+	assert.Equal(t, time.Second, l.Take("1.2.3.4", "eth_blockNumber"))
+	*now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, 500*time.Millisecond, l.Take("1.2.3.4", "eth_blockNumber"))
+	*now = now.Add(500 * time.Millisecond)
+	assert.Zero(t, l.Take("1.2.3.4", "eth_blockNumber"))
+
+	// other clients and classes have buckets of their own
+	assert.Zero(t, l.Take("5.6.7.8", "eth_blockNumber"))
+	assert.Zero(t, l.Take("1.2.3.4", "eth_call"))
+	for i := 0; i < 10; i++ {
+		assert.Zero(t, l.Take("1.2.3.4", "net_version"))
+	}
+
+	// full buckets are swept
+	*now = now.Add(sweepInterval)
+	l.Take("1.2.3.4", "eth_call")
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestInterceptor(t *testing.T) {
+	l, _ := newTestLimiter(t, KeyByIP)
+	funcMap := map[string]*rpcserver.RPCFunc{
+		"eth_blockNumber": rpcserver.NewRPCFunc(func() (string, error) { return "0x1", nil }, ""),
+	}
+	mux := http.NewServeMux()
+	rpcserver.RegisterRPCFuncs(mux, funcMap, amino.NewCodec(), log.TestingLogger(), rpcserver.HTTPInterceptors(l.Interceptor()))
+
+	tests := []struct {
+		remoteAddr string
+		wantCode   int
+	}{
+		{"1.2.3.4:1000", 0},
+		{"1.2.3.4:1001", 0},
+		{"1.2.3.4:1002", -32005},
+		{"5.6.7.8:1000", 0},
+	}
+	for i, tt := range tests {
+		body := `{"jsonrpc": "2.0", "id": "0", "method": "eth_blockNumber"}`
+		req := httptest.NewRequest("POST", "http://localhost/", strings.NewReader(body))
+		req.RemoteAddr = tt.remoteAddr
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		recv := new(types.RPCResponse)
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), recv), "#%d", i)
+		if tt.wantCode == 0 {
+			assert.Nil(t, recv.Error, "#%d: not expecting an error", i)
+			assert.Empty(t, rec.Header().Get("Retry-After"), "#%d", i)
+		} else {
+			require.NotNil(t, recv.Error, "#%d: expecting an error", i)
+			assert.Equal(t, tt.wantCode, recv.Error.Code, "#%d", i)
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"), "#%d", i)
+		}
+	}
+}
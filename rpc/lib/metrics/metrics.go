@@ -0,0 +1,294 @@
+// Package rpcmetrics collects counters, gauges and histograms and serves
+// them in the Prometheus text exposition format.
+package rpcmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// labelSep separates label values in the keys of series.
+const labelSep = "\xff"
+
+// Registry holds metrics and writes them out.
+type Registry struct {
+	mtx     sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// DefaultRegistry is the Registry of the metrics of the gateway.
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) register(m metric) {
+	r.mtx.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mtx.Unlock()
+}
+
+// Write writes all metrics to w in the text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mtx.Lock()
+	metrics := make([]metric, len(r.metrics))
+	copy(metrics, r.metrics)
+	r.mtx.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the metrics of r.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.Write(w) // nolint: errcheck
+	})
+}
+
+// desc is the name, help and label names of a metric.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, strings.Replace(d.help, "\n", `\n`, -1))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// labelPairs formats the labels of a series, plus an extra pair if extra
+// isn't empty.
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(d.labels)+1)
+	for i, name := range d.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeLabel(extra[1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", d.name, len(d.labels), len(values)))
+	}
+	return strings.Join(values, labelSep)
+}
+
+func escapeLabel(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	return strings.Replace(v, "\n", `\n`, -1)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// valueVec is a set of float series, one per combination of label values.
+type valueVec struct {
+	desc
+	mtx    sync.Mutex
+	series map[string]*valueSeries
+}
+
+type valueSeries struct {
+	values []string
+	value  float64
+}
+
+func newValueVec(name, help, kind string, labels []string) *valueVec {
+	return &valueVec{
+		desc:   desc{name: name, help: help, kind: kind, labels: labels},
+		series: make(map[string]*valueSeries),
+	}
+}
+
+func (v *valueVec) update(labelValues []string, f func(float64) float64) {
+	key := v.key(labelValues)
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	s := v.series[key]
+	if s == nil {
+		s = &valueSeries{values: append([]string(nil), labelValues...)}
+		v.series[key] = s
+	}
+	s.value = f(s.value)
+}
+
+func (v *valueVec) write(w *bufio.Writer) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.writeHeader(w)
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := v.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(s.values), formatFloat(s.value))
+	}
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	*valueVec
+}
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newValueVec(name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// Inc increments the counter of labelValues.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the counter of labelValues.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.update(labelValues, func(v float64) float64 { return v + delta })
+}
+
+// GaugeVec is a gauge partitioned by labels.
+type GaugeVec struct {
+	*valueVec
+}
+
+// NewGaugeVec registers a gauge with the given label names.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newValueVec(name, help, "gauge", labels)}
+	r.register(g)
+	return g
+}
+
+// Add adds delta to the gauge of labelValues.
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.update(labelValues, func(v float64) float64 { return v + delta })
+}
+
+// Set sets the gauge of labelValues to v.
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return v })
+}
+
+// gaugeFunc is a gauge computed when written out.
+type gaugeFunc struct {
+	desc
+	f func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is computed by f on each scrape.
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(&gaugeFunc{desc{name: name, help: help, kind: "gauge"}, f})
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.f()))
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mtx     sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	values []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bounds of its
+// buckets, in increasing order, and label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds v to the histogram of labelValues.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{
+			values: append([]string(nil), labelValues...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.writeHeader(w)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.values, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(s.values), s.count)
+	}
+}
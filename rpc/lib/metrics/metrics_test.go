@@ -0,0 +1,65 @@
+package rpcmetrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("requests_total", "Requests by method.", "method")
+	conns := r.NewGaugeVec("open_connections", "Open connections.", "protocol")
+	latency := r.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "method")
+	r.NewGaugeFunc("backlog", "Backlog.", func() float64 { return 3 })
+
+	requests.Inc("eth_call")
+	requests.Add(2, `we"ird`)
+	conns.Add(2, "http")
+	conns.Add(-1, "http")
+	conns.Set(5, "websocket")
+	latency.Observe(0.05, "eth_call")
+	latency.Observe(0.5, "eth_call")
+	latency.Observe(5, "eth_call")
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, r.Write(buf))
+	assert.Equal(t, `# HELP requests_total Requests by method.
+# TYPE requests_total counter
+requests_total{method="eth_call"} 1
+requests_total{method="we\"ird"} 2
+# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections{protocol="http"} 1
+open_connections{protocol="websocket"} 5
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="eth_call",le="0.1"} 1
+latency_seconds_bucket{method="eth_call",le="1"} 2
+latency_seconds_bucket{method="eth_call",le="+Inf"} 3
+latency_seconds_sum{method="eth_call"} 5.55
+latency_seconds_count{method="eth_call"} 3
+# HELP backlog Backlog.
+# TYPE backlog gauge
+backlog 3
+`, buf.String())
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "Requests.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "requests_total 1\n")
+}
+
+func TestLabelValuesMismatch(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("requests_total", "Requests.", "method")
+	assert.Panics(t, func() { c.Inc() })
+}
@@ -0,0 +1,199 @@
+package rpcserver
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Defaults of CORSConfig.
+var (
+	defaultCORSMethods  = []string{"GET", "POST", "OPTIONS"}
+	defaultCORSHeaders  = []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "Authorization", "X-API-Key"}
+	defaultVirtualHosts = []string{"localhost", "127.0.0.1", "::1"}
+)
+
+// CORSConfig is the cross-origin resource sharing policy of the server.
+// Browsers may only make calls from the pages of AllowedOrigins, which are
+// exact origins like "https://dapp.example.com", wildcard subdomains like
+// "https://*.example.com" or "*" for any origin. The same origins may open
+// websocket connections, see WebsocketManager.SetCORS.
+//
+// Pages served by the server itself may call it as long as it is addressed
+// by one of VirtualHosts, "*" for any. Checking the Host header, whatever a
+// name resolves to, keeps DNS rebinding pages out.
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowedOrigins"`
+	AllowedMethods   []string `json:"allowedMethods"` // GET, POST and OPTIONS if empty
+	AllowedHeaders   []string `json:"allowedHeaders"` // common and auth headers if empty, "*" for any
+	AllowCredentials bool     `json:"allowCredentials"`
+	MaxAge           int      `json:"maxAge"`       // seconds preflight results may be cached
+	VirtualHosts     []string `json:"virtualHosts"` // localhost, 127.0.0.1 and ::1 if empty
+}
+
+// AllowsOrigin reports whether pages of origin may call the server. A nil
+// config allows no cross-origin calls.
+func (c *CORSConfig) AllowsOrigin(origin string) bool {
+	if c == nil {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.AllowedOrigins {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if i := strings.Index(allowed, "://*."); i >= 0 {
+			scheme, domain := allowed[:i+3], allowed[i+4:]
+			if strings.HasPrefix(origin, scheme) && strings.HasSuffix(origin, domain) &&
+				len(origin) > len(scheme)+len(domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckOrigin is a websocket.Upgrader CheckOrigin func. It accepts upgrades
+// without an Origin header, from the same origin and from allowed origins.
+func (c *CORSConfig) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || c.isSameOrigin(r, origin) || c.AllowsOrigin(origin)
+}
+
+func (c *CORSConfig) allowsAnyOrigin() bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORSConfig) methods() []string {
+	if c == nil || len(c.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return c.AllowedMethods
+}
+
+func (c *CORSConfig) headers() []string {
+	if c == nil || len(c.AllowedHeaders) == 0 {
+		return defaultCORSHeaders
+	}
+	return c.AllowedHeaders
+}
+
+func (c *CORSConfig) virtualHosts() []string {
+	if c == nil || len(c.VirtualHosts) == 0 {
+		return defaultVirtualHosts
+	}
+	return c.VirtualHosts
+}
+
+func (c *CORSConfig) allowsMethod(method string) bool {
+	for _, m := range c.methods() {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORSConfig) allowsHeader(header string) bool {
+	for _, h := range c.headers() {
+		if h == "*" || strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSameOrigin reports whether origin is the one r is addressed to, scheme
+// included, by one of the virtual hosts.
+func (c *CORSConfig) isSameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, r.Host) {
+		return false
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if !strings.EqualFold(u.Scheme, scheme) {
+		return false
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	for _, vhost := range c.virtualHosts() {
+		if vhost == "*" || strings.EqualFold(vhost, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSHandler applies the cors policy to the requests of handler. It answers
+// preflight requests itself and rejects requests from other origins than
+// allowed with 403 Forbidden, as some of them get executed without a
+// preflight. Requests without an Origin header are passed on untouched.
+func CORSHandler(handler http.Handler, cors *CORSConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || cors.isSameOrigin(r, origin) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if !cors.AllowsOrigin(origin) {
+			http.Error(w, "Origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		if cors.AllowCredentials || !cors.allowsAnyOrigin() {
+			header.Set("Access-Control-Allow-Origin", origin)
+		} else {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+		if cors.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != "OPTIONS" || requestMethod == "" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		// preflight
+		if !cors.allowsMethod(requestMethod) {
+			http.Error(w, "Method not allowed", http.StatusForbidden)
+			return
+		}
+		var requestHeaders []string
+		for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			if h = strings.TrimSpace(h); h == "" {
+				continue
+			}
+			if !cors.allowsHeader(h) {
+				http.Error(w, "Header not allowed", http.StatusForbidden)
+				return
+			}
+			requestHeaders = append(requestHeaders, h)
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(cors.methods(), ", "))
+		if len(requestHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+		}
+		if cors.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
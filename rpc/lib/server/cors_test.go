@@ -0,0 +1,127 @@
+package rpcserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testCORS = &CORSConfig{
+	AllowedOrigins: []string{"https://dapp.example.com", "https://*.example.org"},
+	MaxAge:         600,
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://dapp.example.com", true},
+		{"https://DAPP.example.com", true},
+		{"http://dapp.example.com", false},
+		{"https://evil.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org:8443", false},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.allowed, testCORS.AllowsOrigin(tt.origin), "#%d: %s", i, tt.origin)
+	}
+	assert.False(t, (*CORSConfig)(nil).AllowsOrigin("https://dapp.example.com"))
+	assert.True(t, (&CORSConfig{AllowedOrigins: []string{"*"}}).AllowsOrigin("https://any.where"))
+}
+
+func TestIsSameOrigin(t *testing.T) {
+	tests := []struct {
+		cors        *CORSConfig
+		url, origin string
+		want        bool
+	}{
+		{nil, "http://localhost:8545/", "http://localhost:8545", true},
+		{nil, "http://127.0.0.1:8545/", "http://127.0.0.1:8545", true},
+		{nil, "http://[::1]:8545/", "http://[::1]:8545", true},
+		{nil, "https://localhost/", "https://localhost", true},
+		// the scheme must match
+		{nil, "http://localhost/", "https://localhost", false},
+		{nil, "https://localhost/", "http://localhost", false},
+		{nil, "http://localhost:8545/", "http://localhost:8546", false},
+		// a rebound name is no virtual host
+		{nil, "http://attacker.example.com:8545/", "http://attacker.example.com:8545", false},
+		{&CORSConfig{VirtualHosts: []string{"node.example.com"}}, "http://node.example.com/", "http://node.example.com", true},
+		{&CORSConfig{VirtualHosts: []string{"node.example.com"}}, "http://localhost/", "http://localhost", false},
+		{&CORSConfig{VirtualHosts: []string{"*"}}, "http://node.example.com/", "http://node.example.com", true},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest("POST", tt.url, nil)
+		assert.Equal(t, tt.want, tt.cors.isSameOrigin(req, tt.origin), "#%d", i)
+	}
+}
+
+func TestCORSHandler(t *testing.T) {
+	handler := CORSHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), testCORS)
+
+	tests := []struct {
+		method, origin   string
+		preflightMethod  string
+		preflightHeaders string
+		wantCode         int
+		wantAllowOrigin  string
+	}{
+		{"POST", "", "", "", http.StatusOK, ""},
+		{"POST", "http://localhost", "", "", http.StatusOK, ""},
+		{"POST", "https://dapp.example.com", "", "", http.StatusOK, "https://dapp.example.com"},
+		{"POST", "https://evil.example.com", "", "", http.StatusForbidden, ""},
+		{"POST", "https://localhost", "", "", http.StatusForbidden, ""},
+		{"OPTIONS", "https://a.example.org", "POST", "content-type, x-api-key", http.StatusNoContent, "https://a.example.org"},
+		{"OPTIONS", "https://a.example.org", "DELETE", "", http.StatusForbidden, "https://a.example.org"},
+		{"OPTIONS", "https://a.example.org", "POST", "X-Custom", http.StatusForbidden, "https://a.example.org"},
+		{"OPTIONS", "https://evil.example.com", "POST", "", http.StatusForbidden, ""},
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(tt.method, "http://localhost/", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if tt.preflightMethod != "" {
+			req.Header.Set("Access-Control-Request-Method", tt.preflightMethod)
+		}
+		if tt.preflightHeaders != "" {
+			req.Header.Set("Access-Control-Request-Headers", tt.preflightHeaders)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tt.wantCode, rec.Code, "#%d", i)
+		assert.Equal(t, tt.wantAllowOrigin, rec.Header().Get("Access-Control-Allow-Origin"), "#%d", i)
+		if tt.wantCode == http.StatusNoContent {
+			assert.Equal(t, "GET, POST, OPTIONS", rec.Header().Get("Access-Control-Allow-Methods"), "#%d", i)
+			assert.Equal(t, "content-type, x-api-key", rec.Header().Get("Access-Control-Allow-Headers"), "#%d", i)
+			assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"), "#%d", i)
+		}
+	}
+}
+
+func TestWebsocketCheckOrigin(t *testing.T) {
+	wm := NewWebsocketManager(nil, nil)
+	check := func(origin string) bool {
+		req := httptest.NewRequest("GET", "http://localhost/websocket", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return wm.CheckOrigin(req)
+	}
+
+	assert.True(t, check(""))
+	assert.True(t, check("http://localhost"))
+	assert.False(t, check("https://localhost"))
+	assert.False(t, check("https://dapp.example.com"))
+
+	wm.SetCORS(testCORS)
+	assert.True(t, check("https://dapp.example.com"))
+	assert.False(t, check("https://evil.example.com"))
+}
@@ -0,0 +1,143 @@
+package rpcserver
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tendermint/go-amino"
+
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+	craftlog "github.com/DSiSc/craft/log"
+)
+
+// Transports a Call can come in on.
+const (
+	TransportHTTP      = "http"      // JSON-RPC over HTTP POST
+	TransportURI       = "uri"       // HTTP GET with URI encoded params
+	TransportWebsocket = "websocket" // JSON-RPC over websocket
+)
+
+// Call describes a single method call on its way through the interceptors.
+// Interceptors may rewrite the method and params of Request before passing
+// the call on.
+type Call struct {
+	// Transport is one of TransportHTTP, TransportURI or TransportWebsocket.
+	Transport string
+	// Request is the JSON-RPC request of the call. URI calls have no params,
+	// their arguments are read from the query of HTTPRequest instead.
+	Request types.RPCRequest
+	// HTTPRequest is the HTTP request of the call, or the upgrade request of
+	// the websocket connection it came in on.
+	HTTPRequest *http.Request
+	// Conn is the websocket connection of the call, nil over HTTP.
+	Conn types.WSRPCConnection
+	// ResponseHeader holds the headers of the HTTP response to the call, nil
+	// over websocket. Calls of a batch share the same response.
+	ResponseHeader http.Header
+}
+
+// Handler executes a call and returns its result. Errors of type
+// *types.RPCError are returned to the client as is, any other error is
+// reported as an internal error.
+type Handler func(ctx context.Context, call *Call) (interface{}, error)
+
+// Interceptor wraps the execution of every call, on all transports. It may
+// inspect or rewrite the call before passing it to next, answer it without
+// calling next at all, or post-process the result.
+type Interceptor func(ctx context.Context, call *Call, next Handler) (interface{}, error)
+
+// dispatcher runs calls through the interceptors and the RPCFunc they address.
+type dispatcher struct {
+	funcMap      map[string]*RPCFunc
+	cdc          *amino.Codec
+	interceptors []Interceptor
+}
+
+// HTTPInterceptors sets the interceptors wrapping the calls made through the
+// handlers of RegisterRPCFuncs. The first one is the outermost.
+func HTTPInterceptors(interceptors ...Interceptor) func(*dispatcher) {
+	return func(d *dispatcher) {
+		d.interceptors = append(d.interceptors, interceptors...)
+	}
+}
+
+// dispatch executes call and builds the response to it.
+func (d *dispatcher) dispatch(ctx context.Context, call *Call) (res types.RPCResponse) {
+	begin, method := time.Now(), call.Request.Method
+	if d.funcMap[method] == nil {
+		method = unknownMethod
+	}
+	defer func() { observeCall(method, call.Transport, begin, res) }()
+
+	handler := d.invoke
+	for i := len(d.interceptors) - 1; i >= 0; i-- {
+		handler = chainInterceptor(d.interceptors[i], handler)
+	}
+	result, err := handler(ctx, call)
+	if err != nil {
+		return rpcErrorResponse(call.Request.ID, err)
+	}
+	return types.NewRPCSuccessResponse(d.cdc, call.Request.ID, result)
+}
+
+func chainInterceptor(interceptor Interceptor, next Handler) Handler {
+	return func(ctx context.Context, call *Call) (interface{}, error) {
+		return interceptor(ctx, call, next)
+	}
+}
+
+// invoke is the innermost Handler: it fetches the RPCFunc addressed by call,
+// converts the params to arguments and runs it.
+func (d *dispatcher) invoke(ctx context.Context, call *Call) (interface{}, error) {
+	request := call.Request
+	rpcFunc := d.funcMap[request.Method]
+	if rpcFunc == nil || (rpcFunc.ws && call.Conn == nil) {
+		return nil, types.RPCMethodNotFoundError(request.ID).Error
+	}
+
+	var args []reflect.Value
+	var err error
+	switch {
+	case call.Transport == TransportURI:
+		args, err = httpParamsToArgs(rpcFunc, d.cdc, call.HTTPRequest)
+	case rpcFunc.ws:
+		wsCtx := types.WSRPCContext{Request: request, WSRPCConnection: call.Conn}
+		if len(request.Params) > 0 {
+			args, err = jsonParamsToArgsWS(rpcFunc, d.cdc, request.Params, wsCtx)
+		}
+	default:
+		if len(request.Params) > 0 {
+			args, err = jsonParamsToArgsRPC(rpcFunc, d.cdc, request.Params)
+		}
+	}
+	if err != nil {
+		return nil, types.RPCInvalidParamsError(request.ID, errors.Wrap(err, "Error converting params to arguments")).Error
+	}
+
+	ctx, cancel := rpcFunc.callContext(ctx)
+	defer cancel()
+	returns := rpcFunc.call(ctx, args)
+	// TODO: Need to encode args/returns to string if we want to log them
+	craftlog.DebugKV("RPC call", map[string]interface{}{"transport": call.Transport, "method": request.Method})
+
+	// a call that finished as the deadline passed keeps its result
+	result, err := unreflectResult(returns)
+	if err != nil && errors.Cause(err) == context.DeadlineExceeded {
+		return nil, types.RPCTimeoutError(request.ID).Error
+	}
+	return result, err
+}
+
+// rpcErrorResponse builds the error response to the request with id.
+func rpcErrorResponse(id interface{}, err error) types.RPCResponse {
+	switch rpcErr := errors.Cause(err).(type) {
+	case *types.RPCError:
+		return types.NewRPCErrorResponse(id, rpcErr.Code, rpcErr.Message, rpcErr.Data)
+	case types.RPCError:
+		return types.NewRPCErrorResponse(id, rpcErr.Code, rpcErr.Message, rpcErr.Data)
+	}
+	return types.RPCInternalError(id, err)
+}
@@ -0,0 +1,47 @@
+package rpcserver
+
+import "strings"
+
+// MatchMethod reports whether method matches pattern: "*" matches every
+// method, a pattern ending in "*" or "_" a whole namespace (e.g. "eth_get*"
+// or "eth_") and any other pattern just the method of that name.
+func MatchMethod(pattern, method string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(method, strings.TrimSuffix(pattern, "*"))
+	case strings.HasSuffix(pattern, "_"):
+		return strings.HasPrefix(method, pattern)
+	}
+	return pattern == method
+}
+
+func matchAny(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if MatchMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// MethodAllowed reports whether method matches a pattern of allow and none
+// of deny, see MatchMethod. An empty allow list allows everything.
+func MethodAllowed(method string, allow, deny []string) bool {
+	if len(allow) > 0 && !matchAny(allow, method) {
+		return false
+	}
+	return !matchAny(deny, method)
+}
+
+// FilterFuncMap returns the functions of funcMap MethodAllowed allows.
+func FilterFuncMap(funcMap map[string]*RPCFunc, allow, deny []string) map[string]*RPCFunc {
+	filtered := make(map[string]*RPCFunc)
+	for name, f := range funcMap {
+		if MethodAllowed(name, allow, deny) {
+			filtered[name] = f
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,83 @@
+package rpcserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tendermint/go-amino"
+
+	"github.com/DSiSc/apigateway/log"
+)
+
+func TestMatchMethod(t *testing.T) {
+	tests := []struct {
+		pattern, method string
+		match           bool
+	}{
+		{"*", "eth_call", true},
+		{"eth_", "eth_call", true},
+		{"eth_", "net_version", false},
+		{"eth_get*", "eth_getBalance", true},
+		{"eth_get*", "eth_gasPrice", false},
+		{"eth_call", "eth_call", true},
+		{"eth_call", "eth_callMany", false},
+	}
+	for i, tt := range tests {
+		assert.Equal(t, tt.match, MatchMethod(tt.pattern, tt.method), "#%d: %s ~ %s", i, tt.pattern, tt.method)
+	}
+}
+
+func TestFilterFuncMap(t *testing.T) {
+	f := NewRPCFunc(func() (string, error) { return "", nil }, "")
+	funcMap := map[string]*RPCFunc{
+		"eth_blockNumber":     f,
+		"eth_call":            f,
+		"eth_sendTransaction": f,
+		"net_version":         f,
+		"admin_peers":         f,
+	}
+	names := func(m map[string]*RPCFunc) []string {
+		var names []string
+		for name := range m {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, names(funcMap), names(FilterFuncMap(funcMap, nil, nil)))
+	assert.ElementsMatch(t, []string{"eth_blockNumber", "eth_call", "net_version"},
+		names(FilterFuncMap(funcMap, []string{"eth_", "net_"}, []string{"eth_send*"})))
+	assert.ElementsMatch(t, []string{"eth_blockNumber", "eth_call", "eth_sendTransaction", "net_version"},
+		names(FilterFuncMap(funcMap, nil, []string{"admin_"})))
+}
+
+func TestMethodAllowed(t *testing.T) {
+	assert.True(t, MethodAllowed("rpc.discover", nil, nil))
+	assert.False(t, MethodAllowed("rpc.discover", []string{"eth_*"}, nil))
+	assert.False(t, MethodAllowed("rpc.discover", nil, []string{"rpc.*"}))
+	assert.True(t, MethodAllowed("rpc.discover", []string{"eth_", "rpc.discover"}, []string{"eth_send*"}))
+}
+
+func TestListOfEndpoints(t *testing.T) {
+	f := NewRPCFunc(func() (string, error) { return "", nil }, "")
+	funcMap := map[string]*RPCFunc{
+		"eth_blockNumber":     f,
+		"eth_sendTransaction": f,
+		"eth_subscribe":       NewWSRPCFunc(func() (string, error) { return "", nil }, ""),
+	}
+	mux := http.NewServeMux()
+	RegisterRPCFuncs(mux, FilterFuncMap(funcMap, nil, []string{"eth_send*"}), amino.NewCodec(), log.TestingLogger())
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost/", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, "eth_blockNumber")
+	assert.NotContains(t, body, "eth_sendTransaction")
+	assert.NotContains(t, body, "eth_subscribe")
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost/eth_sendTransaction", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -2,6 +2,7 @@ package rpcserver
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -27,19 +28,26 @@ import (
 
 // RegisterRPCFuncs adds a route for each function in the funcMap, as well as general jsonrpc and websocket handlers for all functions.
 // "result" is the interface on which the result objects are registered, and is popualted with every RPCResponse
-func RegisterRPCFuncs(mux *http.ServeMux, funcMap map[string]*RPCFunc, cdc *amino.Codec, logger log.Logger) {
+func RegisterRPCFuncs(mux *http.ServeMux, funcMap map[string]*RPCFunc, cdc *amino.Codec, logger log.Logger, options ...func(*dispatcher)) {
+	d := &dispatcher{funcMap: funcMap, cdc: cdc}
+	for _, option := range options {
+		option(d)
+	}
+
 	// HTTP endpoints
-	for funcName, rpcFunc := range funcMap {
-		mux.HandleFunc("/"+funcName, makeHTTPHandler(rpcFunc, cdc, logger))
+	for funcName := range funcMap {
+		mux.HandleFunc("/"+funcName, makeHTTPHandler(d, funcName, logger))
 	}
 
 	// JSONRPC endpoints
-	mux.HandleFunc("/", handleInvalidJSONRPCPaths(makeJSONRPCHandler(funcMap, cdc, logger)))
+	mux.HandleFunc("/", handleInvalidJSONRPCPaths(makeJSONRPCHandler(d, logger)))
 }
 
 //-------------------------------------
 // function introspection
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 // RPCFunc contains the introspected type information for a function
 type RPCFunc struct {
 	f        reflect.Value  // underlying rpc function
@@ -47,31 +55,83 @@ type RPCFunc struct {
 	returns  []reflect.Type // type of each return arg
 	argNames []string       // name of each argument
 	ws       bool           // websocket only
+	ctx      bool           // first arg is a context.Context
+	timeout  time.Duration  // deadline of each call, none if zero
 }
 
 // NewRPCFunc wraps a function for introspection.
-// f is the function, args are comma separated argument names
-func NewRPCFunc(f interface{}, args string) *RPCFunc {
-	return newRPCFunc(f, args, false)
+// f is the function, args are comma separated argument names. If the first
+// parameter of f is a context.Context, it is not named in args and receives
+// the context of the request.
+func NewRPCFunc(f interface{}, args string, options ...func(*RPCFunc)) *RPCFunc {
+	return newRPCFunc(f, args, false, options...)
 }
 
 // NewWSRPCFunc wraps a function for introspection and use in the websockets.
-func NewWSRPCFunc(f interface{}, args string) *RPCFunc {
-	return newRPCFunc(f, args, true)
+func NewWSRPCFunc(f interface{}, args string, options ...func(*RPCFunc)) *RPCFunc {
+	return newRPCFunc(f, args, true, options...)
 }
 
-func newRPCFunc(f interface{}, args string, ws bool) *RPCFunc {
+func newRPCFunc(f interface{}, args string, ws bool, options ...func(*RPCFunc)) *RPCFunc {
 	var argNames []string
 	if args != "" {
 		argNames = strings.Split(args, ",")
 	}
-	return &RPCFunc{
+	argTypes := funcArgTypes(f)
+	rpcFunc := &RPCFunc{
 		f:        reflect.ValueOf(f),
-		args:     funcArgTypes(f),
+		args:     argTypes,
 		returns:  funcReturnTypes(f),
 		argNames: argNames,
 		ws:       ws,
+		ctx:      len(argTypes) > 0 && argTypes[0] == contextType,
+	}
+	for _, option := range options {
+		option(rpcFunc)
+	}
+	return rpcFunc
+}
+
+// CallTimeout sets the deadline of the context each call of the function
+// runs with. Calls exceeding it are answered with a timeout error.
+func CallTimeout(timeout time.Duration) func(*RPCFunc) {
+	return func(f *RPCFunc) {
+		f.timeout = timeout
+	}
+}
+
+// WithTimeout returns a copy of f whose calls have the deadline timeout,
+// none if zero.
+func (f *RPCFunc) WithTimeout(timeout time.Duration) *RPCFunc {
+	copied := *f
+	copied.timeout = timeout
+	return &copied
+}
+
+// callContext derives the context of a single call from parent, applying
+// the function's deadline if it has one.
+func (f *RPCFunc) callContext(parent context.Context) (context.Context, context.CancelFunc) {
+	if f.timeout > 0 {
+		return context.WithTimeout(parent, f.timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// ctxOffset returns the number of leading args filled in from the request
+// context rather than from the request params.
+func (f *RPCFunc) ctxOffset() int {
+	if f.ctx {
+		return 1
+	}
+	return 0
+}
+
+// call runs the function with args, prepending ctx if the function takes it.
+func (f *RPCFunc) call(ctx context.Context, args []reflect.Value) []reflect.Value {
+	if f.ctx {
+		args = append([]reflect.Value{reflect.ValueOf(ctx)}, args...)
 	}
+	return f.f.Call(args)
 }
 
 // return a function's argument types
@@ -101,7 +161,7 @@ func funcReturnTypes(f interface{}) []reflect.Type {
 // rpc.json
 
 // jsonrpc calls grab the given method's function info and runs reflect.Call
-func makeJSONRPCHandler(funcMap map[string]*RPCFunc, cdc *amino.Codec, logger log.Logger) http.HandlerFunc {
+func makeJSONRPCHandler(d *dispatcher, logger log.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -111,65 +171,80 @@ func makeJSONRPCHandler(funcMap map[string]*RPCFunc, cdc *amino.Codec, logger lo
 		// if its an empty request (like from a browser),
 		// just display a list of functions
 		if len(b) == 0 {
-			writeListOfEndpoints(w, r, funcMap)
+			writeListOfEndpoints(w, r, d.funcMap)
+			return
+		}
+		if len(r.URL.Path) > 1 {
+			WriteRPCResponseHTTP(w, types.RPCInvalidRequestError("", errors.Errorf("Path %s is invalid", r.URL.Path)))
 			return
 		}
 
-		var isArray bool
-		var request types.RPCRequest
-		err = json.Unmarshal(b, &request)
-		if err != nil {
-			//adaptor imtoken
-			//requests := make([]types.RPCRequest, 1)
-			var requests [1]types.RPCRequest
-			err = json.Unmarshal(b, &requests)
+		if !isBatchRequest(b) {
+			var request types.RPCRequest
+			err = json.Unmarshal(b, &request)
 			if err != nil {
 				WriteRPCResponseHTTP(w, types.RPCParseError("", errors.Wrap(err, "Error unmarshalling request")))
 				return
 			}
-			request = requests[0]
-			isArray = true
-		}
-		// A Notification is a Request object without an "id" member.
-		// The Server MUST NOT reply to a Notification, including those that are within a batch request
-		if request.ID == nil {
-			//logger.Debug("HTTPJSONRPC received a notification, skipping... (please send a non-empty ID if you want to call a method)")
-			craftlog.Debug("HTTPJSONRPC received a notification, skipping... (please send a non-empty ID if you want to call a method)")
+			if res, ok := executeJSONRPCRequest(d, w, r, request); ok {
+				WriteRPCResponseHTTP(w, res)
+			}
 			return
 		}
-		if len(r.URL.Path) > 1 {
-			WriteRPCResponseHTTP(w, types.RPCInvalidRequestError(request.ID, errors.Errorf("Path %s is invalid", r.URL.Path)))
+
+		var rawRequests []json.RawMessage
+		err = json.Unmarshal(b, &rawRequests)
+		if err != nil {
+			WriteRPCResponseHTTP(w, types.RPCParseError("", errors.Wrap(err, "Error unmarshalling batch request")))
 			return
 		}
-		rpcFunc := funcMap[request.Method]
-		if rpcFunc == nil || rpcFunc.ws {
-			WriteRPCResponseHTTP(w, types.RPCMethodNotFoundError(request.ID))
+		if len(rawRequests) == 0 {
+			WriteRPCResponseHTTP(w, types.RPCInvalidRequestError("", errors.New("Empty batch request")))
 			return
 		}
-		var args []reflect.Value
-		if len(request.Params) > 0 {
-			args, err = jsonParamsToArgsRPC(rpcFunc, cdc, request.Params)
-			if err != nil {
-				WriteRPCResponseHTTP(w, types.RPCInvalidParamsError(request.ID, errors.Wrap(err, "Error converting json params to arguments")))
-				return
-			}
-		}
-		returns := rpcFunc.f.Call(args)
-		//logger.Info("HTTPJSONRPC", "method", request.Method, "args", args, "returns", returns)
-		craftlog.DebugKV("HTTPJSONRPC", map[string]interface{}{"method": request.Method, "args": args, "returns": returns})
-		result, err := unreflectResult(returns)
-		if err != nil {
-			WriteRPCResponseHTTP(w, types.RPCInternalError(request.ID, err))
+		if len(rawRequests) > maxBatchRequests {
+			WriteRPCResponseHTTP(w, types.RPCInvalidRequestError("", errors.Errorf("Batch of %d requests exceeds the limit of %d", len(rawRequests), maxBatchRequests)))
 			return
 		}
 
-		if isArray {
-			WriteRPCResponseArrayHTTP(w, types.NewRPCSuccessResponse(cdc, request.ID, result))
-		} else {
-			WriteRPCResponseHTTP(w, types.NewRPCSuccessResponse(cdc, request.ID, result))
+		responses := make([]types.RPCResponse, 0, len(rawRequests))
+		for _, raw := range rawRequests {
+			var request types.RPCRequest
+			if err := json.Unmarshal(raw, &request); err != nil {
+				responses = append(responses, types.RPCInvalidRequestError(nil, errors.Wrap(err, "Error unmarshalling request")))
+				continue
+			}
+			if res, ok := executeJSONRPCRequest(d, w, r, request); ok {
+				responses = append(responses, res)
+			}
 		}
+		// If there are no Response objects contained within the Response array
+		// as it is to be sent to the client, the server MUST NOT return an empty Array.
+		if len(responses) > 0 {
+			WriteRPCResponseArrayHTTP(w, responses)
+		}
+	}
+}
 
+// executeJSONRPCRequest dispatches a single JSON-RPC request received with the
+// HTTP request r, to be answered through w. The returned bool is false if the request is a
+// notification, which must not be replied to.
+func executeJSONRPCRequest(d *dispatcher, w http.ResponseWriter, r *http.Request, request types.RPCRequest) (types.RPCResponse, bool) {
+	// A Notification is a Request object without an "id" member.
+	// The Server MUST NOT reply to a Notification, including those that are within a batch request
+	if request.ID == nil {
+		//logger.Debug("HTTPJSONRPC received a notification, skipping... (please send a non-empty ID if you want to call a method)")
+		craftlog.Debug("HTTPJSONRPC received a notification, skipping... (please send a non-empty ID if you want to call a method)")
+		return types.RPCResponse{}, false
 	}
+	call := &Call{Transport: TransportHTTP, Request: request, HTTPRequest: r, ResponseHeader: w.Header()}
+	return d.dispatch(r.Context(), call), true
+}
+
+// isBatchRequest reports whether the raw request body holds a JSON array.
+func isBatchRequest(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && b[0] == '['
 }
 
 func handleInvalidJSONRPCPaths(next http.HandlerFunc) http.HandlerFunc {
@@ -206,7 +281,7 @@ func mapParamsToArgs(rpcFunc *RPCFunc, cdc *amino.Codec, params map[string]json.
 }
 
 func paramsToArrayArgs(rpcFunc *RPCFunc, cdc *amino.Codec, param []byte, argsOffset int) ([]reflect.Value, error) {
-	if len(rpcFunc.args) <= 0 {
+	if len(rpcFunc.args) <= argsOffset {
 		return nil, errors.New("Argument is not slice type")
 	}
 
@@ -224,13 +299,15 @@ func paramsToArrayArgs(rpcFunc *RPCFunc, cdc *amino.Codec, param []byte, argsOff
 	return values, nil
 }
 
+// arrayParamsToArgs converts positional params. Trailing pointer params are
+// optional and nil when omitted.
 func arrayParamsToArgs(rpcFunc *RPCFunc, cdc *amino.Codec, params []json.RawMessage, argsOffset int) ([]reflect.Value, error) {
-	if len(rpcFunc.argNames) != len(params) {
+	if len(rpcFunc.argNames) < len(params) || len(rpcFunc.argNames) > len(params)+optionalParams(rpcFunc, argsOffset) {
 		return nil, errors.Errorf("Expected %v parameters (%v), got %v (%v)",
 			len(rpcFunc.argNames), rpcFunc.argNames, len(params), params)
 	}
 
-	values := make([]reflect.Value, len(params))
+	values := make([]reflect.Value, len(rpcFunc.argNames))
 	for i, p := range params {
 		argType := rpcFunc.args[i+argsOffset]
 		val := reflect.New(argType)
@@ -240,11 +317,24 @@ func arrayParamsToArgs(rpcFunc *RPCFunc, cdc *amino.Codec, params []json.RawMess
 		}
 		values[i] = val.Elem()
 	}
+	for i := len(params); i < len(values); i++ {
+		values[i] = reflect.Zero(rpcFunc.args[i+argsOffset])
+	}
 	return values, nil
 }
 
+// optionalParams returns the number of trailing pointer params of rpcFunc.
+func optionalParams(rpcFunc *RPCFunc, argsOffset int) int {
+	n := 0
+	for i := len(rpcFunc.argNames) - 1; i >= 0 && rpcFunc.args[i+argsOffset].Kind() == reflect.Ptr; i-- {
+		n++
+	}
+	return n
+}
+
 // `raw` is unparsed json (from json.RawMessage) encoding either a map or an array.
-// `argsOffset` should be 0 for RPC calls, and 1 for WS requests, where len(rpcFunc.args) != len(rpcFunc.argNames).
+// `argsOffset` should be 0 for RPC calls, and 1 for WS requests, where len(rpcFunc.args) != len(rpcFunc.argNames),
+// plus 1 if the function takes a context.Context.
 //
 // Example:
 //   rpcFunc.args = [rpctypes.WSRPCContext string]
@@ -277,12 +367,12 @@ func jsonParamsToArgs(rpcFunc *RPCFunc, cdc *amino.Codec, raw []byte, argsOffset
 
 // Convert a []interface{} OR a map[string]interface{} to properly typed values
 func jsonParamsToArgsRPC(rpcFunc *RPCFunc, cdc *amino.Codec, params json.RawMessage) ([]reflect.Value, error) {
-	return jsonParamsToArgs(rpcFunc, cdc, params, 0)
+	return jsonParamsToArgs(rpcFunc, cdc, params, rpcFunc.ctxOffset())
 }
 
 // Same as above, but with the first param the websocket connection
 func jsonParamsToArgsWS(rpcFunc *RPCFunc, cdc *amino.Codec, params json.RawMessage, wsCtx types.WSRPCContext) ([]reflect.Value, error) {
-	values, err := jsonParamsToArgs(rpcFunc, cdc, params, 1)
+	values, err := jsonParamsToArgs(rpcFunc, cdc, params, rpcFunc.ctxOffset()+1)
 	if err != nil {
 		return nil, err
 	}
@@ -294,41 +384,27 @@ func jsonParamsToArgsWS(rpcFunc *RPCFunc, cdc *amino.Codec, params json.RawMessa
 // rpc.http
 
 // convert from a function name to the http handler
-func makeHTTPHandler(rpcFunc *RPCFunc, cdc *amino.Codec, logger log.Logger) func(http.ResponseWriter, *http.Request) {
-	// Exception for websocket endpoints
-	if rpcFunc.ws {
-		return func(w http.ResponseWriter, r *http.Request) {
-			WriteRPCResponseHTTP(w, types.RPCMethodNotFoundError(""))
-		}
-	}
-	// All other endpoints
+func makeHTTPHandler(d *dispatcher, funcName string, logger log.Logger) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		//logger.Debug("HTTP HANDLER", "req", r)
 		craftlog.DebugKV("HTTP HANDLER", map[string]interface{}{"req": r})
-		args, err := httpParamsToArgs(rpcFunc, cdc, r)
-		if err != nil {
-			WriteRPCResponseHTTP(w, types.RPCInvalidParamsError("", errors.Wrap(err, "Error converting http params to arguments")))
-			return
-		}
-		returns := rpcFunc.f.Call(args)
-		//logger.Info("HTTPRestRPC", "method", r.URL.Path, "args", args, "returns", returns)
-		craftlog.InfoKV("HTTPRestRPC", map[string]interface{}{"method": r.URL.Path, "args": args, "returns": returns})
-		result, err := unreflectResult(returns)
-		if err != nil {
-			WriteRPCResponseHTTP(w, types.RPCInternalError("", err))
-			return
+		call := &Call{
+			Transport:      TransportURI,
+			Request:        types.NewRPCRequest("", funcName, nil),
+			HTTPRequest:    r,
+			ResponseHeader: w.Header(),
 		}
-		WriteRPCResponseHTTP(w, types.NewRPCSuccessResponse(cdc, "", result))
+		WriteRPCResponseHTTP(w, d.dispatch(r.Context(), call))
 	}
 }
 
 // Covert an http query to a list of properly typed values.
 // To be properly decoded the arg must be a concrete type from tendermint (if its an interface).
 func httpParamsToArgs(rpcFunc *RPCFunc, cdc *amino.Codec, r *http.Request) ([]reflect.Value, error) {
-	values := make([]reflect.Value, len(rpcFunc.args))
+	values := make([]reflect.Value, len(rpcFunc.args)-rpcFunc.ctxOffset())
 
 	for i, name := range rpcFunc.argNames {
-		argType := rpcFunc.args[i]
+		argType := rpcFunc.args[i+rpcFunc.ctxOffset()]
 
 		values[i] = reflect.Zero(argType) // set default for that type
 
@@ -451,6 +527,7 @@ const (
 	defaultWSWriteWait         = 10 * time.Second
 	defaultWSReadWait          = 30 * time.Second
 	defaultWSPingPeriod        = (defaultWSReadWait * 9) / 10
+	defaultWSMaxConcurrentReqs = 16
 )
 
 // WSConnEventEventSubscriber eventsubscriber implementation bounded by a single websocket connection
@@ -483,6 +560,7 @@ func (ws *WSConnEventEventSubscriber) Subscribe(eventTypes ...craftTypes.EventTy
 	ws.lock.Lock()
 	ws.subscribes[subscription.ID] = subscription
 	ws.lock.Unlock()
+	activeSubscriptions.Add(1, subscriptionType(eventTypes))
 	return subscription, nil
 
 }
@@ -496,6 +574,7 @@ func (ws *WSConnEventEventSubscriber) Unsubscribe(id string) error {
 		}
 		subscription.Stop()
 		delete(ws.subscribes, id)
+		activeSubscriptions.Add(-1, subscriptionTypeOf(subscription))
 		return nil
 	} else {
 		return fmt.Errorf("subscription with id %s not found", id)
@@ -511,6 +590,7 @@ func (ws *WSConnEventEventSubscriber) UnsubscribeAll() error {
 		}
 		subscription.Stop()
 		delete(ws.subscribes, subscription.ID)
+		activeSubscriptions.Add(-1, subscriptionTypeOf(subscription))
 	}
 	return nil
 }
@@ -524,7 +604,7 @@ type wsConnection struct {
 
 	remoteAddr string
 	baseConn   *websocket.Conn
-	writeChan  chan types.RPCResponse
+	writeChan  chan interface{} // types.RPCResponse or a batch of them
 
 	funcMap map[string]*RPCFunc
 	cdc     *amino.Codec
@@ -541,10 +621,40 @@ type wsConnection struct {
 	// Send pings to server with this period. Must be less than readWait, but greater than zero.
 	pingPeriod time.Duration
 
+	// Maximum number of requests executed in parallel. Must be greater than zero.
+	maxConcurrentReqs int
+
+	// worker pool slots, one per request being executed
+	workers chan struct{}
+
 	// object that is used to subscribe / unsubscribe from events
 	eventSub types.EventSubscriber
+
+	// context of the connection, cancelled when it stops
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// interceptors wrapping every call, the first one is the outermost
+	interceptors []Interceptor
+	dispatcher   *dispatcher
+
+	// request the connection was upgraded from
+	upgradeReq *http.Request
+
+	// requests being handled, and whether new ones are refused as the
+	// connection is shutting down
+	pending  sync.WaitGroup
+	drainMtx sync.Mutex
+	draining bool
 }
 
+// wsCloseFrame is sent through the writeChan to close the connection once
+// the responses before it are written.
+type wsCloseFrame struct{}
+
+// errShuttingDown answers the requests received while shutting down.
+var errShuttingDown = errors.New("Server is shutting down")
+
 // NewWSConnection wraps websocket.Conn.
 //
 // See the commentary on the func(*wsConnection) functions for a detailed
@@ -567,10 +677,15 @@ func NewWSConnection(
 		writeChanCapacity: defaultWSWriteChanCapacity,
 		readWait:          defaultWSReadWait,
 		pingPeriod:        defaultWSPingPeriod,
+		maxConcurrentReqs: defaultWSMaxConcurrentReqs,
 	}
 	for _, option := range options {
 		option(wsc)
 	}
+	wsc.dispatcher = &dispatcher{funcMap: funcMap, cdc: cdc, interceptors: wsc.interceptors}
+	wsc.writeChan = make(chan interface{}, wsc.writeChanCapacity)
+	wsc.workers = make(chan struct{}, wsc.maxConcurrentReqs)
+	wsc.ctx, wsc.cancel = context.WithCancel(context.Background())
 	wsc.BaseService = *cmn.NewBaseService(nil, "wsConnection", wsc)
 	return wsc
 }
@@ -616,11 +731,26 @@ func PingPeriod(pingPeriod time.Duration) func(*wsConnection) {
 	}
 }
 
+// MaxConcurrentRequests sets the number of requests the connection executes
+// in parallel. It should only be used in the constructor - not Goroutine-safe.
+func MaxConcurrentRequests(n int) func(*wsConnection) {
+	return func(wsc *wsConnection) {
+		wsc.maxConcurrentReqs = n
+	}
+}
+
+// Interceptors sets the interceptors wrapping every call made over the
+// connection. The first one is the outermost.
+// It should only be used in the constructor - not Goroutine-safe.
+func Interceptors(interceptors ...Interceptor) func(*wsConnection) {
+	return func(wsc *wsConnection) {
+		wsc.interceptors = append(wsc.interceptors, interceptors...)
+	}
+}
+
 // OnStart implements cmn.Service by starting the read and write routines. It
 // blocks until the connection closes.
 func (wsc *wsConnection) OnStart() error {
-	wsc.writeChan = make(chan types.RPCResponse, wsc.writeChanCapacity)
-
 	// Read subscriptions/unsubscriptions to events
 	go wsc.readRoutine()
 	// Write responses, BLOCKING.
@@ -633,11 +763,67 @@ func (wsc *wsConnection) OnStart() error {
 func (wsc *wsConnection) OnStop() {
 	// Both read and write loops close the websocket connection when they exit their loops.
 	// The writeChan is never closed, to allow WriteRPCResponse() to fail.
+	wsc.cancel()
 	if wsc.eventSub != nil {
 		wsc.eventSub.UnsubscribeAll()
 	}
 }
 
+// track registers a request being handled. It returns false if the
+// connection is shutting down and takes no new requests.
+func (wsc *wsConnection) track() bool {
+	wsc.drainMtx.Lock()
+	defer wsc.drainMtx.Unlock()
+	if wsc.draining {
+		return false
+	}
+	wsc.pending.Add(1)
+	return true
+}
+
+// Shutdown closes the connection gracefully: it refuses new requests, waits
+// for the pending ones to be answered, ends all subscriptions and sends a
+// close frame after the last response. If ctx expires first, the connection
+// is stopped right away.
+func (wsc *wsConnection) Shutdown(ctx context.Context) error {
+	wsc.drainMtx.Lock()
+	wsc.draining = true
+	wsc.drainMtx.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		wsc.pending.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-wsc.Quit():
+		return nil
+	case <-ctx.Done():
+		wsc.Stop() // nolint: errcheck
+		return ctx.Err()
+	}
+
+	if wsc.eventSub != nil {
+		wsc.eventSub.UnsubscribeAll() // nolint: errcheck
+	}
+	select {
+	case wsc.writeChan <- wsCloseFrame{}:
+	case <-wsc.Quit():
+		return nil
+	case <-ctx.Done():
+		wsc.Stop() // nolint: errcheck
+		return ctx.Err()
+	}
+	select {
+	case <-wsc.Quit():
+		return nil
+	case <-ctx.Done():
+		wsc.Stop() // nolint: errcheck
+		return ctx.Err()
+	}
+}
+
 // GetRemoteAddr returns the remote address of the underlying connection.
 // It implements WSRPCConnection
 func (wsc *wsConnection) GetRemoteAddr() string {
@@ -678,6 +864,15 @@ func (wsc *wsConnection) Codec() *amino.Codec {
 	return wsc.cdc
 }
 
+// writeRPCResponses pushes a batch response to the writeChan, and blocks until it is accepted.
+func (wsc *wsConnection) writeRPCResponses(resps []types.RPCResponse) {
+	select {
+	case <-wsc.Quit():
+		return
+	case wsc.writeChan <- resps:
+	}
+}
+
 // Read from the socket and subscribe to or unsubscribe from events
 func (wsc *wsConnection) readRoutine() {
 	defer func() {
@@ -714,6 +909,11 @@ func (wsc *wsConnection) readRoutine() {
 				return
 			}
 
+			if isBatchRequest(in) {
+				wsc.readBatch(in)
+				continue
+			}
+
 			var request types.RPCRequest
 			err = json.Unmarshal(in, &request)
 			if err != nil {
@@ -729,44 +929,120 @@ func (wsc *wsConnection) readRoutine() {
 				continue
 			}
 
-			// Now, fetch the RPCFunc and execute it.
+			wsc.dispatch(request, wsc.WriteRPCResponse)
+		}
+	}
+}
 
-			rpcFunc := wsc.funcMap[request.Method]
-			if rpcFunc == nil {
-				wsc.WriteRPCResponse(types.RPCMethodNotFoundError(request.ID))
-				continue
-			}
-			var args []reflect.Value
-			if rpcFunc.ws {
-				// Otherwise, try an array.
-				wsCtx := types.WSRPCContext{Request: request, WSRPCConnection: wsc}
-				if len(request.Params) > 0 {
-					args, err = jsonParamsToArgsWS(rpcFunc, wsc.cdc, request.Params, wsCtx)
-				}
-			} else {
-				if len(request.Params) > 0 {
-					args, err = jsonParamsToArgsRPC(rpcFunc, wsc.cdc, request.Params)
-				}
-			}
-			if err != nil {
-				wsc.WriteRPCResponse(types.RPCInternalError(request.ID, errors.Wrap(err, "Error converting json params to arguments")))
-				continue
-			}
-			returns := rpcFunc.f.Call(args)
+// readBatch dispatches every call of a batch request to the worker pool and
+// writes their responses back as a single array once all of them are done.
+func (wsc *wsConnection) readBatch(in []byte) {
+	var rawRequests []json.RawMessage
+	if err := json.Unmarshal(in, &rawRequests); err != nil {
+		wsc.WriteRPCResponse(types.RPCParseError("", errors.Wrap(err, "Error unmarshaling batch request")))
+		return
+	}
+	if len(rawRequests) == 0 {
+		wsc.WriteRPCResponse(types.RPCInvalidRequestError("", errors.New("Empty batch request")))
+		return
+	}
+	if len(rawRequests) > maxBatchRequests {
+		wsc.WriteRPCResponse(types.RPCInvalidRequestError("", errors.Errorf("Batch of %d requests exceeds the limit of %d", len(rawRequests), maxBatchRequests)))
+		return
+	}
 
-			// TODO: Need to encode args/returns to string if we want to log them
-			//wsc.Logger.Info("WSJSONRPC", "method", request.Method)
-			craftlog.InfoKV("WSJSONRPC", map[string]interface{}{"method": request.Method})
+	// the batch is pending until its response is written
+	if !wsc.track() {
+		wsc.WriteRPCResponse(types.RPCServerError("", errShuttingDown))
+		return
+	}
 
-			result, err := unreflectResult(returns)
-			if err != nil {
-				wsc.WriteRPCResponse(types.RPCInternalError(request.ID, err))
-				continue
+	responses := make([]*types.RPCResponse, len(rawRequests))
+	var wg sync.WaitGroup
+	for i, raw := range rawRequests {
+		var request types.RPCRequest
+		if err := json.Unmarshal(raw, &request); err != nil {
+			res := types.RPCInvalidRequestError(nil, errors.Wrap(err, "Error unmarshaling request"))
+			responses[i] = &res
+			continue
+		}
+		// notifications are left out of the batch response
+		if request.ID == nil {
+			continue
+		}
+		i := i
+		wg.Add(1)
+		dispatched := wsc.dispatch(request, func(res types.RPCResponse) {
+			responses[i] = &res
+			wg.Done()
+		})
+		if !dispatched {
+			wg.Done()
+			wsc.pending.Done()
+			return
+		}
+	}
+
+	go func() {
+		defer wsc.pending.Done()
+		wg.Wait()
+		batch := make([]types.RPCResponse, 0, len(responses))
+		for _, res := range responses {
+			if res != nil {
+				batch = append(batch, *res)
 			}
+		}
+		if len(batch) > 0 {
+			wsc.writeRPCResponses(batch)
+		}
+	}()
+}
+
+// dispatch executes request on the connection's worker pool and passes the
+// response to done. It blocks while all workers are busy, and returns false
+// without executing the request if the connection is stopped meanwhile.
+// Requests received while shutting down are answered with an error.
+func (wsc *wsConnection) dispatch(request types.RPCRequest, done func(types.RPCResponse)) bool {
+	if !wsc.track() {
+		done(types.RPCServerError(request.ID, errShuttingDown))
+		return true
+	}
+	select {
+	case <-wsc.Quit():
+		wsc.pending.Done()
+		return false
+	case wsc.workers <- struct{}{}:
+	}
+	go func() {
+		defer func() {
+			<-wsc.workers
+			wsc.pending.Done()
+		}()
+		done(wsc.execute(request))
+	}()
+	return true
+}
 
-			wsc.WriteRPCResponse(types.NewRPCSuccessResponse(wsc.cdc, request.ID, result))
+// execute dispatches a request received over the connection.
+func (wsc *wsConnection) execute(request types.RPCRequest) (res types.RPCResponse) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(error)
+			if !ok {
+				err = fmt.Errorf("WSJSONRPC: %v", r)
+			}
+			craftlog.ErrorKV("Panic in WSJSONRPC handler", map[string]interface{}{"err": err, "stack": string(debug.Stack())})
+			res = types.RPCInternalError(request.ID, err)
 		}
+	}()
+
+	call := &Call{
+		Transport:   TransportWebsocket,
+		Request:     request,
+		HTTPRequest: wsc.upgradeReq,
+		Conn:        wsc,
 	}
+	return wsc.dispatcher.dispatch(wsc.ctx, call)
 }
 
 // receives on a write channel and writes out on the socket
@@ -779,6 +1055,14 @@ func (wsc *wsConnection) writeRoutine() {
 	for {
 		select {
 		case msg := <-wsc.writeChan:
+			if _, ok := msg.(wsCloseFrame); ok {
+				closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, errShuttingDown.Error())
+				if err := wsc.writeMessageWithDeadline(websocket.CloseMessage, closeMsg); err != nil {
+					craftlog.ErrorKV("Failed to write close frame", map[string]interface{}{"err": err})
+				}
+				wsc.Stop() // nolint: errcheck
+				return
+			}
 			jsonBytes, err := json.MarshalIndent(msg, "", "  ")
 			if err != nil {
 				//wsc.Logger.Error("Failed to marshal RPCResponse to JSON", "err", err)
@@ -818,6 +1102,11 @@ type WebsocketManager struct {
 	cdc           *amino.Codec
 	logger        log.Logger
 	wsConnOptions []func(*wsConnection)
+
+	mtx          sync.Mutex
+	conns        map[*wsConnection]struct{}
+	shuttingDown bool
+	closed       sync.WaitGroup // one per open connection
 }
 
 // NewWebsocketManager returns a new WebsocketManager that passes a map of
@@ -827,13 +1116,11 @@ func NewWebsocketManager(funcMap map[string]*RPCFunc, cdc *amino.Codec, wsConnOp
 		funcMap: funcMap,
 		cdc:     cdc,
 		Upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				// TODO ???
-				return true
-			},
+			CheckOrigin: (*CORSConfig)(nil).CheckOrigin,
 		},
 		logger:        log.NewNopLogger(),
 		wsConnOptions: wsConnOptions,
+		conns:         make(map[*wsConnection]struct{}),
 	}
 }
 
@@ -842,9 +1129,23 @@ func (wm *WebsocketManager) SetLogger(l log.Logger) {
 	wm.logger = l
 }
 
+// SetCORS accepts upgrades from the origins cors allows, on top of the
+// same origin.
+func (wm *WebsocketManager) SetCORS(cors *CORSConfig) {
+	wm.CheckOrigin = cors.CheckOrigin
+}
+
 // WebsocketHandler upgrades the request/response (via http.Hijack) and starts
 // the wsConnection.
 func (wm *WebsocketManager) WebsocketHandler(w http.ResponseWriter, r *http.Request) {
+	wm.mtx.Lock()
+	shuttingDown := wm.shuttingDown
+	wm.mtx.Unlock()
+	if shuttingDown {
+		http.Error(w, errShuttingDown.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
 	wsConn, err := wm.Upgrade(w, r, nil)
 	if err != nil {
 		// TODO - return http error
@@ -855,7 +1156,13 @@ func (wm *WebsocketManager) WebsocketHandler(w http.ResponseWriter, r *http.Requ
 
 	// register connection
 	con := NewWSConnection(wsConn, wm.funcMap, wm.cdc, wm.wsConnOptions...)
+	con.upgradeReq = r
 	con.SetLogger(wm.logger.With("remote", wsConn.RemoteAddr()))
+	if !wm.register(con) {
+		wsConn.Close() // nolint: errcheck
+		return
+	}
+	defer wm.unregister(con)
 	//wm.logger.Info("New websocket connection", "remote", con.remoteAddr)
 	craftlog.InfoKV("New websocket connection", map[string]interface{}{"remote": con.remoteAddr})
 	err = con.Start() // Blocking
@@ -865,14 +1172,62 @@ func (wm *WebsocketManager) WebsocketHandler(w http.ResponseWriter, r *http.Requ
 	}
 }
 
+func (wm *WebsocketManager) register(con *wsConnection) bool {
+	wm.mtx.Lock()
+	defer wm.mtx.Unlock()
+	if wm.shuttingDown {
+		return false
+	}
+	wm.conns[con] = struct{}{}
+	wm.closed.Add(1)
+	liveConns.add(con)
+	return true
+}
+
+func (wm *WebsocketManager) unregister(con *wsConnection) {
+	wm.mtx.Lock()
+	delete(wm.conns, con)
+	wm.mtx.Unlock()
+	liveConns.remove(con)
+	wm.closed.Done()
+}
+
+// Shutdown refuses new connections and shuts all open ones down gracefully,
+// see wsConnection.Shutdown. It returns once all of them are closed, or
+// with the error of ctx if it expires first.
+func (wm *WebsocketManager) Shutdown(ctx context.Context) error {
+	wm.mtx.Lock()
+	wm.shuttingDown = true
+	conns := make([]*wsConnection, 0, len(wm.conns))
+	for con := range wm.conns {
+		conns = append(conns, con)
+	}
+	wm.mtx.Unlock()
+
+	for _, con := range conns {
+		go con.Shutdown(ctx) // nolint: errcheck
+	}
+	closed := make(chan struct{})
+	go func() {
+		wm.closed.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // rpc.websocket
 //-----------------------------------------------------------------------------
 
 // NOTE: assume returns is result struct and error. If error is not nil, return it
 func unreflectResult(returns []reflect.Value) (interface{}, error) {
 	errV := returns[1]
-	if errV.Interface() != nil {
-		return nil, errors.Errorf("%v", errV.Interface())
+	if err, ok := errV.Interface().(error); ok && err != nil {
+		return nil, err
 	}
 	rv := returns[0]
 	// the result is a registered interface,
@@ -887,7 +1242,11 @@ func writeListOfEndpoints(w http.ResponseWriter, r *http.Request, funcMap map[st
 	noArgNames := []string{}
 	argNames := []string{}
 	for name, funcData := range funcMap {
-		if len(funcData.args) == 0 {
+		if funcData.ws {
+			// websocket only, can't be called at a URI
+			continue
+		}
+		if len(funcData.argNames) == 0 {
 			noArgNames = append(noArgNames, name)
 		} else {
 			argNames = append(argNames, name)
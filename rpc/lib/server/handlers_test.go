@@ -2,12 +2,15 @@ package rpcserver_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
@@ -86,7 +89,7 @@ func TestRPCParams(t *testing.T) {
 		} else {
 			assert.True(t, recv.Error.Code < 0, "#%d: not expecting a positive JSONRPC code", i)
 			// The wanted error is either in the message or the data
-			assert.Contains(t, recv.Error.Message+recv.Error.Data, tt.wantErr, "#%d: expected substring", i)
+			assert.Contains(t, recv.Error.Error(), tt.wantErr, "#%d: expected substring", i)
 		}
 	}
 }
@@ -106,6 +109,219 @@ func TestRPCNotification(t *testing.T) {
 	require.Equal(t, len(blob), 0, "a notification SHOULD NOT be responded to by the server")
 }
 
+func TestRPCBatch(t *testing.T) {
+	mux := testMux()
+	tests := []struct {
+		payload string
+		wantIDs []string
+		wantErr []string
+	}{
+		// a single call wrapped in an array is still answered with an array
+		{`[{"jsonrpc": "2.0", "method": "c", "id": "0", "params": ["a", "10"]}]`, []string{"0"}, []string{""}},
+		// every call is executed, notifications are left out of the reply
+		{`[
+			{"jsonrpc": "2.0", "method": "c", "id": "0", "params": ["a", "10"]},
+			{"jsonrpc": "2.0", "method": "c", "params": ["a", "10"]},
+			{"jsonrpc": "2.0", "method": "y", "id": "1"},
+			1,
+			{"jsonrpc": "2.0", "method": "c", "id": "2", "params": ["a", "10"]}
+		]`, []string{"0", "1", "", "2"}, []string{"", "Method not found", "Invalid Request", ""}},
+	}
+
+	for i, tt := range tests {
+		req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader(tt.payload))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		res := rec.Result()
+		require.True(t, statusOK(res.StatusCode), "#%d: should always return 2XX", i)
+		blob, err := ioutil.ReadAll(res.Body)
+		require.Nil(t, err, "#%d: reading from the body should not give back an error", i)
+
+		var recv []types.RPCResponse
+		require.Nil(t, json.Unmarshal(blob, &recv), "#%d: expecting successful parsing of an RPCResponse array:\nblob: %s", i, blob)
+		require.Equal(t, len(tt.wantIDs), len(recv), "#%d: unexpected number of responses", i)
+		for j, resp := range recv {
+			if tt.wantIDs[j] == "" {
+				assert.Nil(t, resp.ID, "#%d.%d: not expecting an id", i, j)
+			} else {
+				assert.Equal(t, tt.wantIDs[j], resp.ID, "#%d.%d: unexpected id", i, j)
+			}
+			if tt.wantErr[j] == "" {
+				assert.Nil(t, resp.Error, "#%d.%d: not expecting an error", i, j)
+			} else {
+				require.NotNil(t, resp.Error, "#%d.%d: expecting an error", i, j)
+				assert.Contains(t, resp.Error.Error(), tt.wantErr[j], "#%d.%d: expected substring", i, j)
+			}
+		}
+	}
+}
+
+func TestRPCBatchNotifications(t *testing.T) {
+	mux := testMux()
+	body := strings.NewReader(`[{"jsonrpc": "2.0", "method": "c"}, {"jsonrpc": "2.0", "method": "c"}]`)
+	req, _ := http.NewRequest("POST", "http://localhost/", body)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	res := rec.Result()
+
+	require.True(t, statusOK(res.StatusCode), "should always return 2XX")
+	blob, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err, "reading from the body should not give back an error")
+	require.Equal(t, len(blob), 0, "a batch of notifications SHOULD NOT be responded to by the server")
+}
+
+func TestRPCBatchInvalid(t *testing.T) {
+	mux := testMux()
+	tooLarge := "[" + strings.Repeat(`{"jsonrpc": "2.0", "method": "c", "id": "0"},`, 1000) + `{"jsonrpc": "2.0", "method": "c", "id": "0"}]`
+	tests := []struct {
+		payload string
+		wantErr string
+	}{
+		{`[]`, "Empty batch"},
+		{`[{"jsonrpc": "2.0", "method": "c", "id": "0"}`, "Parse error"},
+		{tooLarge, "exceeds the limit"},
+	}
+
+	for i, tt := range tests {
+		req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader(tt.payload))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		res := rec.Result()
+		require.True(t, statusOK(res.StatusCode), "#%d: should always return 2XX", i)
+		blob, err := ioutil.ReadAll(res.Body)
+		require.Nil(t, err, "#%d: reading from the body should not give back an error", i)
+
+		recv := new(types.RPCResponse)
+		require.Nil(t, json.Unmarshal(blob, recv), "#%d: expecting successful parsing of an RPCResponse:\nblob: %s", i, blob)
+		require.NotNil(t, recv.Error, "#%d: expecting an error", i)
+		assert.Contains(t, recv.Error.Error(), tt.wantErr, "#%d: expected substring", i)
+	}
+}
+
+func TestRPCContext(t *testing.T) {
+	funcMap := map[string]*rs.RPCFunc{
+		"ctx": rs.NewRPCFunc(func(ctx context.Context, s string) (string, error) {
+			if _, ok := ctx.Deadline(); ok {
+				return "", errors.New("unexpected deadline")
+			}
+			return s, nil
+		}, "s"),
+		"timeout": rs.NewRPCFunc(func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}, "", rs.CallTimeout(10*time.Millisecond)),
+		"late": rs.NewRPCFunc(func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "done", nil
+		}, "", rs.CallTimeout(10*time.Millisecond)),
+	}
+	// a copy with a deadline leaves the original without
+	funcMap["deadline"] = funcMap["ctx"].WithTimeout(time.Minute)
+	mux := http.NewServeMux()
+	rs.RegisterRPCFuncs(mux, funcMap, amino.NewCodec(), log.TestingLogger())
+
+	tests := []struct {
+		payload    string
+		wantResult string
+		wantCode   int
+	}{
+		{`{"jsonrpc": "2.0", "method": "ctx", "id": "0", "params": ["a"]}`, `"a"`, 0},
+		{`{"jsonrpc": "2.0", "method": "ctx", "id": "0", "params": {"s": "b"}}`, `"b"`, 0},
+		{`{"jsonrpc": "2.0", "method": "timeout", "id": "0"}`, "", -32002},
+		{`{"jsonrpc": "2.0", "method": "late", "id": "0"}`, `"done"`, 0},
+		{`{"jsonrpc": "2.0", "method": "deadline", "id": "0", "params": ["c"]}`, "", -32603},
+	}
+	for i, tt := range tests {
+		req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader(tt.payload))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+
+		recv := new(types.RPCResponse)
+		require.Nil(t, json.Unmarshal(rec.Body.Bytes(), recv), "#%d: expecting successful parsing of an RPCResponse", i)
+		if tt.wantCode == 0 {
+			require.Nil(t, recv.Error, "#%d: not expecting an error", i)
+			assert.Equal(t, tt.wantResult, string(recv.Result), "#%d: unexpected result", i)
+		} else {
+			require.NotNil(t, recv.Error, "#%d: expecting an error", i)
+			assert.Equal(t, tt.wantCode, recv.Error.Code, "#%d: unexpected error code", i)
+		}
+	}
+}
+
+func TestRPCInterceptors(t *testing.T) {
+	funcMap := map[string]*rs.RPCFunc{
+		"c":      rs.NewRPCFunc(func(s string) (string, error) { return s, nil }, "s"),
+		"denied": rs.NewRPCFunc(func() (string, error) { return "", nil }, ""),
+		"ws":     rs.NewWSRPCFunc(func(wsCtx types.WSRPCContext, s string) (string, error) { return s, nil }, "s"),
+	}
+	var transports []string
+	record := func(ctx context.Context, call *rs.Call, next rs.Handler) (interface{}, error) {
+		transports = append(transports, call.Transport)
+		return next(ctx, call)
+	}
+	deny := func(ctx context.Context, call *rs.Call, next rs.Handler) (interface{}, error) {
+		if call.Request.Method == "denied" {
+			return nil, &types.RPCError{Code: -32010, Message: "Denied"}
+		}
+		result, err := next(ctx, call)
+		if s, ok := result.(*string); ok && err == nil {
+			upper := strings.ToUpper(*s)
+			return &upper, nil
+		}
+		return result, err
+	}
+
+	mux := http.NewServeMux()
+	rs.RegisterRPCFuncs(mux, funcMap, amino.NewCodec(), log.TestingLogger(), rs.HTTPInterceptors(record, deny))
+	wm := rs.NewWebsocketManager(funcMap, amino.NewCodec(), rs.Interceptors(record, deny))
+	wm.SetLogger(log.TestingLogger())
+	mux.HandleFunc("/websocket", wm.WebsocketHandler)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	post := func(payload string) *types.RPCResponse {
+		res, err := http.Post(s.URL, "application/json", strings.NewReader(payload))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		recv := new(types.RPCResponse)
+		require.NoError(t, json.NewDecoder(res.Body).Decode(recv))
+		return recv
+	}
+
+	recv := post(`{"jsonrpc": "2.0", "method": "c", "id": "0", "params": ["a"]}`)
+	require.Nil(t, recv.Error)
+	assert.Equal(t, `"A"`, string(recv.Result))
+
+	recv = post(`{"jsonrpc": "2.0", "method": "denied", "id": "0"}`)
+	require.NotNil(t, recv.Error)
+	assert.Equal(t, -32010, recv.Error.Code)
+	assert.Equal(t, "Denied", recv.Error.Message)
+
+	recv = post(`{"jsonrpc": "2.0", "method": "ws", "id": "0", "params": ["a"]}`)
+	require.NotNil(t, recv.Error)
+	assert.Equal(t, "Method not found", recv.Error.Message)
+
+	res, err := http.Get(s.URL + `/c?s="b"`)
+	require.NoError(t, err)
+	recv = new(types.RPCResponse)
+	require.NoError(t, json.NewDecoder(res.Body).Decode(recv))
+	res.Body.Close()
+	require.Nil(t, recv.Error)
+	assert.Equal(t, `"B"`, string(recv.Result))
+
+	d := websocket.Dialer{}
+	c, _, err := d.Dial("ws://"+s.Listener.Addr().String()+"/websocket", nil)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.WriteJSON(types.NewRPCRequest("0", "ws", json.RawMessage(`["c"]`))))
+	var resp types.RPCResponse
+	require.NoError(t, c.ReadJSON(&resp))
+	require.Nil(t, resp.Error)
+	assert.Equal(t, `"C"`, string(resp.Result))
+
+	assert.Equal(t, []string{rs.TransportHTTP, rs.TransportHTTP, rs.TransportHTTP, rs.TransportURI, rs.TransportWebsocket}, transports)
+}
+
 func TestUnknownRPCPath(t *testing.T) {
 	mux := testMux()
 	req, _ := http.NewRequest("GET", "http://localhost/unknownrpcpath", nil)
@@ -145,6 +361,105 @@ func TestWebsocketManagerHandler(t *testing.T) {
 	require.Nil(t, resp.Error)
 }
 
+func TestWebsocketBatch(t *testing.T) {
+	s := newWSServer()
+	defer s.Close()
+
+	d := websocket.Dialer{}
+	c, _, err := d.Dial("ws://"+s.Listener.Addr().String()+"/websocket", nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.WriteMessage(websocket.TextMessage, []byte(`[
+		{"jsonrpc": "2.0", "method": "c", "id": "0", "params": {"s": "a", "i": "10"}},
+		{"jsonrpc": "2.0", "method": "c", "params": {"s": "a", "i": "10"}},
+		{"jsonrpc": "2.0", "method": "y", "id": "1"}
+	]`))
+	require.NoError(t, err)
+
+	var resps []types.RPCResponse
+	err = c.ReadJSON(&resps)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(resps))
+	assert.Equal(t, "0", resps[0].ID)
+	assert.Nil(t, resps[0].Error)
+	assert.Equal(t, "1", resps[1].ID)
+	require.NotNil(t, resps[1].Error)
+	assert.Equal(t, "Method not found", resps[1].Error.Message)
+}
+
+func TestWebsocketConcurrentRequests(t *testing.T) {
+	release := make(chan struct{})
+	funcMap := map[string]*rs.RPCFunc{
+		"slow": rs.NewRPCFunc(func() (string, error) { <-release; return "slow", nil }, ""),
+		"fast": rs.NewRPCFunc(func() (string, error) { return "fast", nil }, ""),
+	}
+	wm := rs.NewWebsocketManager(funcMap, amino.NewCodec(), rs.MaxConcurrentRequests(2))
+	wm.SetLogger(log.TestingLogger())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/websocket", wm.WebsocketHandler)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	d := websocket.Dialer{}
+	c, _, err := d.Dial("ws://"+s.Listener.Addr().String()+"/websocket", nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.WriteJSON(types.NewRPCRequest("slow", "slow", nil)))
+	require.NoError(t, c.WriteJSON(types.NewRPCRequest("fast", "fast", nil)))
+
+	// the slow call must not hold back the fast one
+	var resp types.RPCResponse
+	require.NoError(t, c.ReadJSON(&resp))
+	assert.Equal(t, "fast", resp.ID)
+
+	close(release)
+	require.NoError(t, c.ReadJSON(&resp))
+	assert.Equal(t, "slow", resp.ID)
+}
+
+func TestWebsocketShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	funcMap := map[string]*rs.RPCFunc{
+		"slow": rs.NewRPCFunc(func() (string, error) { close(started); <-release; return "slow", nil }, ""),
+	}
+	wm := rs.NewWebsocketManager(funcMap, amino.NewCodec())
+	wm.SetLogger(log.TestingLogger())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/websocket", wm.WebsocketHandler)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	d := websocket.Dialer{}
+	c, _, err := d.Dial("ws://"+s.Listener.Addr().String()+"/websocket", nil)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.WriteJSON(types.NewRPCRequest("slow", "slow", nil)))
+	<-started
+
+	shutdown := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- wm.Shutdown(ctx)
+	}()
+
+	// the pending call is answered before the connection is closed
+	close(release)
+	var resp types.RPCResponse
+	require.NoError(t, c.ReadJSON(&resp))
+	assert.Equal(t, "slow", resp.ID)
+	_, _, err = c.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "expected a close frame, got %v", err)
+	assert.NoError(t, <-shutdown)
+
+	// new connections are refused
+	_, dialResp, err := d.Dial("ws://"+s.Listener.Addr().String()+"/websocket", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, dialResp.StatusCode)
+}
+
 func newWSServer() *httptest.Server {
 	funcMap := map[string]*rs.RPCFunc{
 		"c": rs.NewWSRPCFunc(func(wsCtx types.WSRPCContext, s string, i int) (string, error) { return "foo", nil }, "s,i"),
@@ -3,6 +3,7 @@ package rpcserver
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -22,22 +23,34 @@ import (
 // Config is an RPC server configuration.
 type Config struct {
 	MaxOpenConnections int
+	// CORS is the cross-origin policy, no cross-origin calls if nil.
+	CORS *CORSConfig
 }
 
 const (
 	// maxBodyBytes controls the maximum number of bytes the
 	// server will read parsing the request body.
 	maxBodyBytes = int64(1000000) // 1MB
+
+	// maxBatchRequests controls the maximum number of calls the
+	// server will accept in a single JSON-RPC batch request.
+	maxBatchRequests = 1000
 )
 
-// StartHTTPServer starts an HTTP server on listenAddr with the given handler.
-// It wraps handler with RecoverAndLogHandler.
-func StartHTTPServer(
+// Server is an RPC HTTP server that can be shut down gracefully.
+type Server struct {
+	server   *http.Server
+	listener net.Listener
+}
+
+// StartServer starts an HTTP server on listenAddr with the given handler.
+// It wraps handler with RecoverAndLogHandler and CORSHandler.
+func StartServer(
 	listenAddr string,
 	handler http.Handler,
 	logger log.Logger,
 	config Config,
-) (listener net.Listener, err error) {
+) (*Server, error) {
 	var proto, addr string
 	parts := strings.SplitN(listenAddr, "://", 2)
 	if len(parts) != 2 {
@@ -50,7 +63,7 @@ func StartHTTPServer(
 
 	//logger.Info(fmt.Sprintf("Starting RPC HTTP server on %s", listenAddr))
 	craftlog.Info(fmt.Sprintf("Starting RPC HTTP server on %s", listenAddr))
-	listener, err = net.Listen(proto, addr)
+	listener, err := net.Listen(proto, addr)
 	if err != nil {
 		return nil, errors.Errorf("Failed to listen on %v: %v", listenAddr, err)
 	}
@@ -58,20 +71,67 @@ func StartHTTPServer(
 		listener = netutil.LimitListener(listener, config.MaxOpenConnections)
 	}
 
+	s := &Server{
+		server: &http.Server{
+			Handler:   RecoverAndLogHandler(CORSHandler(maxBytesHandler{h: handler, n: maxBodyBytes}, config.CORS), logger),
+			ConnState: countHTTPConns,
+		},
+		listener: listener,
+	}
 	go func() {
-		err := http.Serve(
-			listener,
-			RecoverAndLogHandler(maxBytesHandler{h: handler, n: maxBodyBytes}, logger),
-		)
+		err := s.server.Serve(listener)
+		if err == http.ErrServerClosed {
+			craftlog.Info("RPC HTTP server stopped")
+			return
+		}
 		//logger.Error("RPC HTTP server stopped", "err", err)
 		craftlog.ErrorKV("RPC HTTP server stopped", map[string]interface{}{"err": err})
 	}()
-	return listener, nil
+	return s, nil
+}
+
+// countHTTPConns tracks the open HTTP connections. Hijacked ones are
+// counted as websocket connections by WebsocketManager.
+func countHTTPConns(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		openConnections.Add(1, protocolHTTP)
+	case http.StateHijacked, http.StateClosed:
+		openConnections.Add(-1, protocolHTTP)
+	}
+}
+
+// Listener returns the listener the server accepts connections on.
+func (s *Server) Listener() net.Listener {
+	return s.listener
+}
+
+// Shutdown stops accepting connections and waits for the pending HTTP
+// requests to be answered, or for ctx to expire. It doesn't wait for
+// websocket connections, see WebsocketManager.Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// StartHTTPServer starts an HTTP server on listenAddr with the given handler.
+// It wraps handler with RecoverAndLogHandler and CORSHandler. Closing the
+// listener stops the server, use StartServer to shut it down gracefully.
+func StartHTTPServer(
+	listenAddr string,
+	handler http.Handler,
+	logger log.Logger,
+	config Config,
+) (listener net.Listener, err error) {
+	s, err := StartServer(listenAddr, handler, logger, config)
+	if err != nil {
+		return nil, err
+	}
+	return s.listener, nil
 }
 
 // StartHTTPAndTLSServer starts an HTTPS server on listenAddr with the given
 // handler.
-// It wraps handler with RecoverAndLogHandler.
+// It wraps handler with RecoverAndLogHandler and CORSHandler.
 func StartHTTPAndTLSServer(
 	listenAddr string,
 	handler http.Handler,
@@ -114,7 +174,7 @@ func StartHTTPAndTLSServer(
 	go func() {
 		err := http.ServeTLS(
 			listener,
-			RecoverAndLogHandler(maxBytesHandler{h: handler, n: maxBodyBytes}, logger),
+			RecoverAndLogHandler(CORSHandler(maxBytesHandler{h: handler, n: maxBodyBytes}, config.CORS), logger),
 			certFile,
 			keyFile,
 		)
@@ -150,11 +210,8 @@ func WriteRPCResponseHTTP(w http.ResponseWriter, res types.RPCResponse) {
 	w.Write(jsonBytes) // nolint: errcheck, gas
 }
 
-func WriteRPCResponseArrayHTTP(w http.ResponseWriter, res types.RPCResponse) {
-	var obj [1]types.RPCResponse
-	obj[0] = res
-
-	jsonBytes, err := json.MarshalIndent(obj, "", "  ")
+func WriteRPCResponseArrayHTTP(w http.ResponseWriter, res []types.RPCResponse) {
+	jsonBytes, err := json.MarshalIndent(res, "", "  ")
 	if err != nil {
 		panic(err)
 	}
@@ -180,11 +237,8 @@ func RecoverAndLogHandler(handler http.Handler, logger log.Logger) http.Handler
 		//rww.Header().Set("Access-Control-Allow-Credentials", "true")
 		//rww.Header().Set("Access-Control-Expose-Headers", "X-Server-Time")
 		//rww.Header().Set("X-Server-Time", fmt.Sprintf("%v", begin.Unix()))
-		rww.Header().Set("Access-Control-Allow-Origin", "*")
-		rww.Header().Set("Access-Control-Allow-Methods", "*")
 		rww.Header().Set("Content-Type", "text/plain")
 		rww.Header().Set("Connections", "keep-alive")
-		rww.Header().Set("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept")
 
 		defer func() {
 			// Send a 500 error if a panic happens during a handler.
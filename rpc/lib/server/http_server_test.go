@@ -1,6 +1,7 @@
 package rpcserver
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -60,3 +61,50 @@ func TestMaxOpenConnections(t *testing.T) {
 		t.Errorf("%d requests failed within %d attempts", failed, attempts)
 	}
 }
+
+func TestServerShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		fmt.Fprint(w, "some body")
+	})
+	s, err := StartServer("tcp://127.0.0.1:0", mux, log.TestingLogger(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := make(chan string)
+	go func() {
+		r, err := http.Get("http://" + s.Listener().Addr().String())
+		if err != nil {
+			t.Error(err)
+			body <- ""
+			return
+		}
+		defer r.Body.Close()
+		b, _ := ioutil.ReadAll(r.Body)
+		body <- string(b)
+	}()
+	<-started
+
+	shutdown := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- s.Shutdown(ctx)
+	}()
+
+	// the pending request is answered before the server stops
+	close(release)
+	if b := <-body; b != "some body" {
+		t.Errorf("got body %q, want %q", b, "some body")
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+	if _, err := http.Get("http://" + s.Listener().Addr().String()); err == nil {
+		t.Error("server still accepts requests after shutdown")
+	}
+}
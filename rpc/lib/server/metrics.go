@@ -0,0 +1,120 @@
+package rpcserver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	rpcmetrics "github.com/DSiSc/apigateway/rpc/lib/metrics"
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+	craftTypes "github.com/DSiSc/craft/types"
+)
+
+// Protocols of open connections.
+const (
+	protocolHTTP      = "http"
+	protocolWebsocket = "websocket"
+)
+
+// unknownMethod labels calls of methods that aren't served, so clients
+// can't blow up the number of series.
+const unknownMethod = "unknown"
+
+var (
+	requestsTotal = rpcmetrics.DefaultRegistry.NewCounterVec(
+		"apigateway_rpc_requests_total",
+		"RPC calls, by method and transport.",
+		"method", "transport",
+	)
+	errorsTotal = rpcmetrics.DefaultRegistry.NewCounterVec(
+		"apigateway_rpc_errors_total",
+		"RPC calls answered with an error, by method and JSON-RPC error code.",
+		"method", "code",
+	)
+	requestDuration = rpcmetrics.DefaultRegistry.NewHistogramVec(
+		"apigateway_rpc_request_duration_seconds",
+		"Time taken to answer RPC calls, by method.",
+		rpcmetrics.DefBuckets,
+		"method",
+	)
+	openConnections = rpcmetrics.DefaultRegistry.NewGaugeVec(
+		"apigateway_open_connections",
+		"Open client connections, by protocol.",
+		"protocol",
+	)
+	activeSubscriptions = rpcmetrics.DefaultRegistry.NewGaugeVec(
+		"apigateway_active_subscriptions",
+		"Active websocket event subscriptions, by event types.",
+		"type",
+	)
+)
+
+func init() {
+	rpcmetrics.DefaultRegistry.NewGaugeFunc(
+		"apigateway_websocket_write_backlog",
+		"Messages waiting in the write channels of all websocket connections.",
+		liveConns.backlog,
+	)
+}
+
+// observeCall records a call of method answered with res after begin.
+func observeCall(method, transport string, begin time.Time, res types.RPCResponse) {
+	requestsTotal.Inc(method, transport)
+	requestDuration.Observe(time.Since(begin).Seconds(), method)
+	if res.Error != nil {
+		errorsTotal.Inc(method, strconv.Itoa(res.Error.Code))
+	}
+}
+
+// subscriptionType labels a subscription by its sorted event types.
+func subscriptionType(eventTypes []craftTypes.EventType) string {
+	names := make([]string, len(eventTypes))
+	for i, et := range eventTypes {
+		names[i] = fmt.Sprint(et)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func subscriptionTypeOf(subscription *types.Subscription) string {
+	var eventTypes []craftTypes.EventType
+	for et := range subscription.Subscribers() {
+		eventTypes = append(eventTypes, et)
+	}
+	return subscriptionType(eventTypes)
+}
+
+// connSet holds the open websocket connections of all managers.
+type connSet struct {
+	mtx   sync.Mutex
+	conns map[*wsConnection]struct{}
+}
+
+var liveConns = &connSet{conns: make(map[*wsConnection]struct{})}
+
+func (s *connSet) add(wsc *wsConnection) {
+	s.mtx.Lock()
+	s.conns[wsc] = struct{}{}
+	s.mtx.Unlock()
+	openConnections.Add(1, protocolWebsocket)
+}
+
+func (s *connSet) remove(wsc *wsConnection) {
+	s.mtx.Lock()
+	delete(s.conns, wsc)
+	s.mtx.Unlock()
+	openConnections.Add(-1, protocolWebsocket)
+}
+
+func (s *connSet) backlog() float64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var n int
+	for wsc := range s.conns {
+		n += len(wsc.writeChan)
+	}
+	return float64(n)
+}
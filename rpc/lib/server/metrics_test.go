@@ -0,0 +1,87 @@
+package rpcserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/go-amino"
+
+	"github.com/DSiSc/apigateway/log"
+	rpcmetrics "github.com/DSiSc/apigateway/rpc/lib/metrics"
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+)
+
+func scrape(t *testing.T) string {
+	buf := new(bytes.Buffer)
+	require.NoError(t, rpcmetrics.DefaultRegistry.Write(buf))
+	return buf.String()
+}
+
+// sample returns the value of series in metrics, zero if missing.
+func sample(t *testing.T, metrics, series string) float64 {
+	for _, line := range strings.Split(metrics, "\n") {
+		if strings.HasPrefix(line, series+" ") {
+			v, err := strconv.ParseFloat(strings.TrimPrefix(line, series+" "), 64)
+			require.NoError(t, err)
+			return v
+		}
+	}
+	return 0
+}
+
+func TestDispatchMetrics(t *testing.T) {
+	funcMap := map[string]*RPCFunc{
+		"metrics_ok":   NewRPCFunc(func() (string, error) { return "ok", nil }, ""),
+		"metrics_fail": NewRPCFunc(func() (string, error) { return "", errors.New("fail") }, ""),
+	}
+	mux := http.NewServeMux()
+	RegisterRPCFuncs(mux, funcMap, amino.NewCodec(), log.TestingLogger())
+
+	series := []string{
+		`apigateway_rpc_requests_total{method="metrics_ok",transport="http"}`,
+		`apigateway_rpc_requests_total{method="metrics_ok",transport="uri"}`,
+		`apigateway_rpc_errors_total{method="metrics_fail",code="-32603"}`,
+		`apigateway_rpc_request_duration_seconds_count{method="metrics_ok"}`,
+	}
+	before := scrape(t)
+
+	for _, method := range []string{"metrics_ok", "metrics_ok", "metrics_fail"} {
+		body := `{"jsonrpc": "2.0", "id": "0", "method": "` + method + `"}`
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "http://localhost/", strings.NewReader(body)))
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/metrics_ok", nil))
+
+	after := scrape(t)
+	for i, want := range []float64{2, 1, 1, 3} {
+		assert.Equal(t, want, sample(t, after, series[i])-sample(t, before, series[i]), series[i])
+	}
+}
+
+func TestWebsocketMetrics(t *testing.T) {
+	wm := NewWebsocketManager(map[string]*RPCFunc{}, amino.NewCodec())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/websocket", wm.WebsocketHandler)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	c, _, err := websocket.DefaultDialer.Dial("ws://"+s.Listener.Addr().String()+"/websocket", nil)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.WriteJSON(types.NewRPCRequest("0", "no_such_method", nil)))
+	var resp types.RPCResponse
+	require.NoError(t, c.ReadJSON(&resp))
+
+	// other tests share the metrics, their connections may still be closing
+	metrics := scrape(t)
+	assert.Regexp(t, `apigateway_open_connections\{protocol="websocket"\} [1-9]`, metrics)
+	assert.Regexp(t, `apigateway_rpc_requests_total\{method="unknown",transport="websocket"\} [1-9]`, metrics)
+	assert.Contains(t, metrics, "apigateway_websocket_write_backlog ")
+}
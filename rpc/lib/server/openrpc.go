@@ -0,0 +1,331 @@
+package rpcserver
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+)
+
+// OpenRPCVersion is the version of the OpenRPC specification the generated
+// documents follow.
+const OpenRPCVersion = "1.2.6"
+
+// Schema is a JSON schema.
+type Schema map[string]interface{}
+
+// Schemas of the hex encoded types of the common package.
+var (
+	hexDataSchema     = Schema{"type": "string", "pattern": "^0x([0-9a-fA-F]{2})*$", "title": "Hex encoded bytes"}
+	hexQuantitySchema = Schema{"type": "string", "pattern": "^0x(0|[1-9a-fA-F][0-9a-fA-F]*)$", "title": "Hex encoded unsigned integer"}
+	hashSchema        = Schema{"type": "string", "pattern": "^0x[0-9a-fA-F]{64}$", "title": "32 byte hex encoded hash"}
+)
+
+// Schemas of the 64 bit integers, which amino encodes as decimal strings.
+var (
+	decimalSchema         = Schema{"type": "string", "pattern": "^-?[0-9]+$", "title": "Decimal encoded integer"}
+	unsignedDecimalSchema = Schema{"type": "string", "pattern": "^[0-9]+$", "title": "Decimal encoded unsigned integer"}
+)
+
+// metaSchema is the schema of the result of rpc.discover, an OpenRPC
+// document.
+var metaSchema = Schema{"$ref": "https://raw.githubusercontent.com/open-rpc/meta-schema/master/schema.json"}
+
+var (
+	typeSchemasMtx sync.RWMutex
+	typeSchemas    = map[reflect.Type]Schema{
+		reflect.TypeOf(cmn.Hash{}):    hashSchema,
+		reflect.TypeOf(cmn.Bytes{}):   hexDataSchema,
+		reflect.TypeOf(cmn.Uint64(0)): hexQuantitySchema,
+		reflect.TypeOf(cmn.Uint(0)):   hexQuantitySchema,
+		reflect.TypeOf(cmn.Big{}):     hexQuantitySchema,
+	}
+)
+
+// RegisterSchema sets the schema of the values of t, for the types whose
+// JSON encoding can't be told by reflection, e.g. those with custom
+// (Un)MarshalJSON methods.
+func RegisterSchema(t reflect.Type, schema Schema) {
+	typeSchemasMtx.Lock()
+	typeSchemas[t] = schema
+	typeSchemasMtx.Unlock()
+}
+
+func registeredSchema(t reflect.Type) (Schema, bool) {
+	typeSchemasMtx.RLock()
+	defer typeSchemasMtx.RUnlock()
+	schema, ok := typeSchemas[t]
+	return schema, ok
+}
+
+// MethodDoc describes a method in the OpenRPC document.
+type MethodDoc struct {
+	Summary     string
+	Description string
+	// Result names the result, "result" if empty.
+	Result string
+}
+
+// OpenRPCInfo is the info object of an OpenRPC document.
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenRPCDocument describes the methods of a server.
+type OpenRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       OpenRPCInfo       `json:"info"`
+	Methods    []OpenRPCMethod   `json:"methods"`
+	Components OpenRPCComponents `json:"components"`
+}
+
+// OpenRPCMethod describes a single method.
+type OpenRPCMethod struct {
+	Name           string               `json:"name"`
+	Summary        string               `json:"summary,omitempty"`
+	Description    string               `json:"description,omitempty"`
+	ParamStructure string               `json:"paramStructure"`
+	Params         []OpenRPCContentDesc `json:"params"`
+	Result         OpenRPCContentDesc   `json:"result"`
+}
+
+// OpenRPCContentDesc describes a param or the result of a method.
+type OpenRPCContentDesc struct {
+	Name     string `json:"name"`
+	Required bool   `json:"required,omitempty"`
+	Schema   Schema `json:"schema"`
+}
+
+// OpenRPCComponents holds the schemas of the struct types used by methods.
+type OpenRPCComponents struct {
+	Schemas map[string]Schema `json:"schemas"`
+}
+
+// MarshalJSON encodes the document with encoding/json, as amino can't
+// encode schemas.
+func (doc OpenRPCDocument) MarshalJSON() ([]byte, error) {
+	type document OpenRPCDocument
+	return json.Marshal(document(doc))
+}
+
+// NewOpenRPCDocument documents the methods of funcMap by reflecting on
+// their argument and return types. docs holds the descriptions of methods.
+func NewOpenRPCDocument(info OpenRPCInfo, funcMap map[string]*RPCFunc, docs map[string]MethodDoc) *OpenRPCDocument {
+	g := &schemaGenerator{names: make(map[reflect.Type]string), schemas: make(map[string]Schema)}
+	names := make([]string, 0, len(funcMap))
+	for name := range funcMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	doc := &OpenRPCDocument{OpenRPC: OpenRPCVersion, Info: info}
+	for _, name := range names {
+		f := funcMap[name]
+		method := OpenRPCMethod{
+			Name:           name,
+			Summary:        docs[name].Summary,
+			Description:    docs[name].Description,
+			ParamStructure: "either",
+			Params:         []OpenRPCContentDesc{},
+		}
+		offset := f.ctxOffset()
+		if f.ws {
+			offset++ // types.WSRPCContext
+		}
+		for i, argName := range f.argNames {
+			if i+offset >= len(f.args) {
+				break
+			}
+			t := f.args[i+offset]
+			method.Params = append(method.Params, OpenRPCContentDesc{
+				Name:     strings.TrimSpace(argName),
+				Required: t.Kind() != reflect.Ptr,
+				Schema:   g.schema(t),
+			})
+		}
+		method.Result = OpenRPCContentDesc{Name: "result", Schema: Schema{}}
+		if docs[name].Result != "" {
+			method.Result.Name = docs[name].Result
+		}
+		if len(f.returns) > 0 {
+			method.Result.Schema = g.schema(f.returns[0])
+		}
+		doc.Methods = append(doc.Methods, method)
+	}
+	doc.Components.Schemas = g.schemas
+	return doc
+}
+
+// schemaGenerator builds the schemas of Go types. Named struct types go to
+// the components of the document and are referenced from there.
+type schemaGenerator struct {
+	names   map[reflect.Type]string
+	schemas map[string]Schema
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (g *schemaGenerator) schema(t reflect.Type) Schema {
+	if schema, ok := registeredSchema(t); ok {
+		return schema
+	}
+	if t.Kind() == reflect.Ptr {
+		return g.schema(t.Elem())
+	}
+	if t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return Schema{"type": "string"}
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		// can't tell what it encodes to
+		return Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return decimalSchema
+	case reflect.Uint, reflect.Uint64:
+		return unsignedDecimalSchema
+	case reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Schema{"type": "string", "contentEncoding": "base64"}
+		}
+		schema := Schema{"type": "array", "items": g.schema(t.Elem())}
+		if t.Kind() == reflect.Array {
+			schema["minItems"], schema["maxItems"] = t.Len(), t.Len()
+		}
+		return schema
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+	// interfaces and anything else
+	return Schema{}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) Schema {
+	if t.Name() == "" {
+		return g.objectSchema(t)
+	}
+	name, ok := g.names[t]
+	if !ok {
+		name = t.Name()
+		if _, taken := g.schemas[name]; taken {
+			name = path.Base(t.PkgPath()) + "." + name
+		}
+		g.names[t] = name
+		g.schemas[name] = Schema{} // placeholder for recursive types
+		g.schemas[name] = g.objectSchema(t)
+	}
+	return Schema{"$ref": "#/components/schemas/" + name}
+}
+
+func (g *schemaGenerator) objectSchema(t reflect.Type) Schema {
+	properties := Schema{}
+	var required []string
+	g.addFields(t, properties, &required)
+	schema := Schema{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// addFields adds the JSON encoded fields of struct type t to properties,
+// flattening embedded structs like encoding/json does.
+func (g *schemaGenerator) addFields(t reflect.Type, properties Schema, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(ft, properties, required)
+				continue
+			}
+		}
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// discoverResult is the result of rpc.discover.
+type discoverResult struct {
+	doc *OpenRPCDocument
+}
+
+func (r discoverResult) MarshalJSON() ([]byte, error) {
+	return r.doc.MarshalJSON()
+}
+
+// NewDiscoverFunc returns the rpc.discover method, answering with doc, and
+// documents it in doc.
+func NewDiscoverFunc(doc *OpenRPCDocument) *RPCFunc {
+	i := sort.Search(len(doc.Methods), func(i int) bool { return doc.Methods[i].Name >= "rpc.discover" })
+	if i == len(doc.Methods) || doc.Methods[i].Name != "rpc.discover" {
+		doc.Methods = append(doc.Methods, OpenRPCMethod{})
+		copy(doc.Methods[i+1:], doc.Methods[i:])
+		doc.Methods[i] = OpenRPCMethod{
+			Name:           "rpc.discover",
+			Summary:        "Returns the OpenRPC document of the server.",
+			ParamStructure: "either",
+			Params:         []OpenRPCContentDesc{},
+			Result:         OpenRPCContentDesc{Name: "OpenRPC Schema", Schema: metaSchema},
+		}
+	}
+	return NewRPCFunc(func() (discoverResult, error) { return discoverResult{doc}, nil }, "")
+}
+
+// OpenRPCHandler serves doc, e.g. at /openrpc.json.
+func OpenRPCHandler(doc *OpenRPCDocument) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		b, err := doc.MarshalJSON()
+		if err != nil {
+			WriteRPCResponseHTTP(w, types.RPCInternalError("", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(b) // nolint: errcheck, gas
+	}
+}
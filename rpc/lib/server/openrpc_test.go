@@ -0,0 +1,150 @@
+package rpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tendermint/go-amino"
+
+	cmn "github.com/DSiSc/apigateway/common"
+	"github.com/DSiSc/apigateway/log"
+	types "github.com/DSiSc/apigateway/rpc/lib/types"
+)
+
+type openrpcBase struct {
+	Hash cmn.Hash `json:"hash"`
+}
+
+type openrpcArgs struct {
+	openrpcBase
+	Gas      *cmn.Uint64    `json:"gas"`
+	Note     string         `json:"note,omitempty"`
+	Tags     []string       `json:"tags"`
+	Meta     map[string]int `json:"meta"`
+	Count    uint64         `json:"count,omitempty"`
+	Small    int32          `json:"small,omitempty"`
+	Children []*openrpcArgs `json:"children"`
+	Skipped  string         `json:"-"`
+	hidden   string
+	Any      interface{}       `json:"any"`
+	Raw      json.RawMessage   `json:"raw"`
+	Extra    map[string]string `json:"extra,omitempty"`
+}
+
+func openrpcFuncMap() map[string]*RPCFunc {
+	return map[string]*RPCFunc{
+		"test_get": NewRPCFunc(func(ctx context.Context, hash cmn.Hash, full *bool) (*openrpcArgs, error) {
+			return nil, nil
+		}, "hash, full"),
+		"test_send": NewRPCFunc(func(args openrpcArgs) (cmn.Uint64, error) { return 0, nil }, "args"),
+		"test_subscribe": NewWSRPCFunc(func(wsCtx types.WSRPCContext, topic string) (string, error) {
+			return "", nil
+		}, "topic"),
+	}
+}
+
+func openrpcDoc(t *testing.T, doc *OpenRPCDocument) map[string]interface{} {
+	b, err := doc.MarshalJSON()
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	return decoded
+}
+
+func TestOpenRPCDocument(t *testing.T) {
+	doc := NewOpenRPCDocument(OpenRPCInfo{Title: "test", Version: "1.0"}, openrpcFuncMap(), map[string]MethodDoc{
+		"test_get": {Summary: "Gets it.", Result: "thing"},
+	})
+	require.Len(t, doc.Methods, 3)
+	assert.Equal(t, []string{"test_get", "test_send", "test_subscribe"},
+		[]string{doc.Methods[0].Name, doc.Methods[1].Name, doc.Methods[2].Name})
+
+	get := doc.Methods[0]
+	assert.Equal(t, "Gets it.", get.Summary)
+	require.Len(t, get.Params, 2)
+	assert.Equal(t, OpenRPCContentDesc{Name: "hash", Required: true, Schema: hashSchema}, get.Params[0])
+	assert.Equal(t, OpenRPCContentDesc{Name: "full", Schema: Schema{"type": "boolean"}}, get.Params[1])
+	assert.Equal(t, "thing", get.Result.Name)
+	assert.Equal(t, Schema{"$ref": "#/components/schemas/openrpcArgs"}, get.Result.Schema)
+
+	send := doc.Methods[1]
+	assert.Equal(t, "args", send.Params[0].Name)
+	assert.Equal(t, Schema{"$ref": "#/components/schemas/openrpcArgs"}, send.Params[0].Schema)
+	assert.Equal(t, OpenRPCContentDesc{Name: "result", Schema: hexQuantitySchema}, send.Result)
+
+	// the websocket context isn't a param
+	subscribe := doc.Methods[2]
+	require.Len(t, subscribe.Params, 1)
+	assert.Equal(t, "topic", subscribe.Params[0].Name)
+
+	require.Len(t, doc.Components.Schemas, 1)
+	args := doc.Components.Schemas["openrpcArgs"]
+	assert.Equal(t, "object", args["type"])
+	assert.Equal(t, []string{"any", "children", "hash", "meta", "raw", "tags"}, args["required"])
+	assert.Equal(t, Schema{
+		"hash":     hashSchema,
+		"gas":      hexQuantitySchema,
+		"note":     Schema{"type": "string"},
+		"tags":     Schema{"type": "array", "items": Schema{"type": "string"}},
+		"meta":     Schema{"type": "object", "additionalProperties": decimalSchema},
+		"count":    unsignedDecimalSchema,
+		"small":    Schema{"type": "integer"},
+		"children": Schema{"type": "array", "items": Schema{"$ref": "#/components/schemas/openrpcArgs"}},
+		"any":      Schema{},
+		"raw":      Schema{},
+		"extra":    Schema{"type": "object", "additionalProperties": Schema{"type": "string"}},
+	}, args["properties"])
+}
+
+func TestRegisterSchema(t *testing.T) {
+	type tag string
+	RegisterSchema(reflect.TypeOf(tag("")), Schema{"enum": []string{"a", "b"}})
+	funcMap := map[string]*RPCFunc{
+		"test_tag": NewRPCFunc(func(t tag) (bool, error) { return true, nil }, "tag"),
+	}
+	doc := NewOpenRPCDocument(OpenRPCInfo{}, funcMap, nil)
+	assert.Equal(t, Schema{"enum": []string{"a", "b"}}, doc.Methods[0].Params[0].Schema)
+}
+
+func TestDiscover(t *testing.T) {
+	funcMap := openrpcFuncMap()
+	doc := NewOpenRPCDocument(OpenRPCInfo{Title: "test", Version: "1.0"}, funcMap, nil)
+	funcMap["rpc.discover"] = NewDiscoverFunc(doc)
+	mux := http.NewServeMux()
+	mux.Handle("/openrpc.json", OpenRPCHandler(doc))
+	RegisterRPCFuncs(mux, funcMap, amino.NewCodec(), log.TestingLogger())
+	want := openrpcDoc(t, doc)
+	assert.Equal(t, OpenRPCVersion, want["openrpc"])
+	// rpc.discover documents itself, in order
+	require.Len(t, doc.Methods, 4)
+	assert.Equal(t, "rpc.discover", doc.Methods[0].Name)
+	assert.Equal(t, metaSchema, doc.Methods[0].Result.Schema)
+	NewDiscoverFunc(doc)
+	assert.Len(t, doc.Methods, 4)
+	assert.Equal(t, map[string]interface{}{"title": "test", "version": "1.0"}, want["info"])
+
+	rec := httptest.NewRecorder()
+	body := `{"jsonrpc": "2.0", "id": "0", "method": "rpc.discover"}`
+	mux.ServeHTTP(rec, httptest.NewRequest("POST", "http://localhost/", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp struct {
+		Result map[string]interface{} `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, want, resp.Result)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "http://localhost/openrpc.json", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var served map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	assert.Equal(t, want, served)
+}
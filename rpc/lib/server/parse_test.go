@@ -176,6 +176,30 @@ func TestParseJSONRPC(t *testing.T) {
 	}
 }
 
+func TestParseJSONRPCOptional(t *testing.T) {
+	assert := assert.New(t)
+
+	demo := func(name string, height *int, tag *string) {}
+	call := NewRPCFunc(demo, "name,height,tag")
+	cdc := amino.NewCodec()
+
+	vals, err := jsonParamsToArgs(call, cdc, []byte(`["john", "22"]`), 0)
+	if assert.Nil(err) && assert.Equal(3, len(vals)) {
+		assert.Equal("john", vals[0].String())
+		assert.Equal(22, *vals[1].Interface().(*int))
+		assert.Nil(vals[2].Interface().(*string))
+	}
+	vals, err = jsonParamsToArgs(call, cdc, []byte(`["john"]`), 0)
+	if assert.Nil(err) && assert.Equal(3, len(vals)) {
+		assert.Nil(vals[1].Interface().(*int))
+	}
+	// only trailing pointers are optional
+	_, err = jsonParamsToArgs(call, cdc, []byte(`[]`), 0)
+	assert.NotNil(err)
+	_, err = jsonParamsToArgs(call, cdc, []byte(`["john", "22", "x", "y"]`), 0)
+	assert.NotNil(err)
+}
+
 func TestParseURI(t *testing.T) {
 
 	demo := func(height int, name string) {}
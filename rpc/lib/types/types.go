@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -72,16 +73,18 @@ func ArrayToRequest(cdc *amino.Codec, id interface{}, method string, params []in
 //----------------------------------------
 // RESPONSE
 
+// RPCError is the error of a response. Data may be any value encoding to JSON,
+// a string mostly; it is decoded as by encoding/json into interface{}.
 type RPCError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Data    string `json:"data,omitempty"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
 func (err RPCError) Error() string {
 	const baseFormat = "RPC error %v - %s"
-	if err.Data != "" {
-		return fmt.Sprintf(baseFormat+": %s", err.Code, err.Message, err.Data)
+	if err.Data != nil && err.Data != "" {
+		return fmt.Sprintf(baseFormat+": %v", err.Code, err.Message, err.Data)
 	}
 	return fmt.Sprintf(baseFormat, err.Code, err.Message)
 }
@@ -109,7 +112,12 @@ func NewRPCSuccessResponse(cdc *amino.Codec, id interface{}, res interface{}) RP
 	return RPCResponse{JSONRPC: "2.0", ID: id, Result: rawMsg}
 }
 
-func NewRPCErrorResponse(id interface{}, code int, msg string, data string) RPCResponse {
+// NewRPCErrorResponse returns the error response to the request with id. An
+// empty string data is left out, like nil.
+func NewRPCErrorResponse(id interface{}, code int, msg string, data interface{}) RPCResponse {
+	if data == "" {
+		data = nil
+	}
 	return RPCResponse{
 		JSONRPC: "2.0",
 		ID:      id,
@@ -168,6 +176,22 @@ func RPCServerError(id interface{}, err error) RPCResponse {
 	return NewRPCErrorResponse(id, -32000, "Server error", err.Error())
 }
 
+func RPCTimeoutError(id interface{}) RPCResponse {
+	return NewRPCErrorResponse(id, -32002, "Request timed out", "")
+}
+
+func RPCUnauthorizedError(id interface{}, err error) RPCResponse {
+	return NewRPCErrorResponse(id, -32001, "Unauthorized", err.Error())
+}
+
+func RPCForbiddenError(id interface{}, method string) RPCResponse {
+	return NewRPCErrorResponse(id, -32003, "Forbidden", fmt.Sprintf("Not allowed to call %s", method))
+}
+
+func RPCLimitExceededError(id interface{}, retryAfter time.Duration) RPCResponse {
+	return NewRPCErrorResponse(id, -32005, "Limit exceeded", fmt.Sprintf("Retry after %v", retryAfter))
+}
+
 //----------------------------------------
 
 // *wsConnection implements this interface.
@@ -33,6 +33,15 @@ func TestResponses(t *testing.T) {
 	h, _ := json.Marshal(g)
 	i := `{"jsonrpc":"2.0","id":"2","error":{"code":-32601,"message":"Method not found"}}`
 	assert.Equal(string(h), string(i))
+
+	j := NewRPCErrorResponse("3", 3, "execution reverted", &SampleResult{"0x"})
+	k, _ := json.Marshal(j)
+	l := `{"jsonrpc":"2.0","id":"3","error":{"code":3,"message":"execution reverted","data":{"Value":"0x"}}}`
+	assert.Equal(l, string(k))
+
+	var m RPCResponse
+	assert.NoError(json.Unmarshal(k, &m))
+	assert.Equal(map[string]interface{}{"Value": "0x"}, m.Error.Data)
 }
 
 func TestRPCError(t *testing.T) {
@@ -55,7 +55,7 @@ func TestSendTransactionCurl(t *testing.T) {
 ,"id":"1"}`,
 			statusCode: 200,
 			want:       "",
-			wantErr:    &rpctypes.RPCError{Code: -32601, Message: "Method not found", Data: ""},
+			wantErr:    &rpctypes.RPCError{Code: -32601, Message: "Method not found"},
 		},
 		// Test case 03: from address not begin with "0x"
 		{